@@ -0,0 +1,174 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var errInvalidAssignee = errors.New("assignee is not a member of the project")
+
+func updateIssueAssigneeHandler(c *gin.Context) {
+	issueID := c.Param("id")
+	issue, err := getIssueByID(issueID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Issue not found"})
+		return
+	}
+
+	// A null or missing assignee_id unassigns the issue
+	var body struct {
+		AssigneeID *string `json:"assignee_id"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	assignee := normalizeAssignee(body.AssigneeID)
+
+	if err := validateAssignee(issue.ProjectID, assignee); err != nil {
+		if errors.Is(err, errInvalidAssignee) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Assignee must be a member of the project"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate assignee"})
+		return
+	}
+
+	if !sameStringPtr(issue.AssignedTo, assignee) {
+		err := withTx(func(tx *Tx) error {
+			return setIssueAssignee(tx, issueID, issue.AssignedTo, assignee, c.GetString("user_id"))
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update assignee"})
+			return
+		}
+	}
+
+	issue, err = getIssueByID(issueID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch updated issue"})
+		return
+	}
+	c.JSON(http.StatusOK, issue)
+}
+
+func getIssueAssignmentsHandler(c *gin.Context) {
+	issueID := c.Param("id")
+	assignments, err := getIssueAssignments(issueID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assignments"})
+		return
+	}
+	if assignments == nil {
+		assignments = []IssueAssignment{}
+	}
+	c.JSON(http.StatusOK, gin.H{"assignments": assignments})
+}
+
+// normalizeAssignee treats an empty assignee ID the same as no assignee.
+func normalizeAssignee(assignee *string) *string {
+	if assignee == nil || *assignee == "" {
+		return nil
+	}
+	return assignee
+}
+
+// validateAssignee checks that a non-nil assignee belongs to the project.
+func validateAssignee(projectID string, assignee *string) error {
+	if assignee == nil {
+		return nil
+	}
+	if _, err := uuid.Parse(*assignee); err != nil {
+		return errInvalidAssignee
+	}
+	_, err := getProjectMemberRole(projectID, *assignee)
+	if err == sql.ErrNoRows {
+		return errInvalidAssignee
+	}
+	return err
+}
+
+// setIssueAssignee changes the assignee and records the change in the
+// assignment history as part of the caller's transaction.
+func setIssueAssignee(tx *Tx, issueID string, previous, assignee *string, changedBy string) error {
+	now := time.Now().Format(time.RFC3339)
+	query := `UPDATE issues SET assigned_to = $1, updated_at = $2 WHERE id = $3`
+	if _, err := tx.Exec(query, assignee, now, issueID); err != nil {
+		log.Printf("Database error updating assignee: %v", err)
+		return err
+	}
+	if err := recordAssignment(tx, issueID, previous, assignee, changedBy); err != nil {
+		return err
+	}
+	return emitIssueWebhook(tx, issueID, changedBy, "issue.assigned", gin.H{
+		"previous_assignee": previous,
+		"assignee":          assignee,
+	})
+}
+
+// recordAssignment records an assignment change and notifies the new
+// assignee.
+func recordAssignment(tx *Tx, issueID string, previous, assignee *string, changedBy string) error {
+	if err := insertAssignment(tx, issueID, previous, assignee, changedBy); err != nil || assignee == nil {
+		return err
+	}
+	return notifyUsers(tx, issueNotification{Reason: notifyAssigned, IssueID: issueID, ActorID: changedBy}, []string{*assignee})
+}
+
+// insertAssignment adds an assignment change to the issue's history and
+// timeline and makes the assignee a watcher, without notifying anyone.
+// Imports use it directly.
+func insertAssignment(tx *Tx, issueID string, previous, assignee *string, changedBy string) error {
+	query := `
+	INSERT INTO issue_assignments (id, issue_id, previous_assignee, assignee, changed_by, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := tx.Exec(query, uuid.New().String(), issueID, previous, assignee, changedBy, time.Now().Format(time.RFC3339))
+	if err != nil {
+		log.Printf("Database error recording assignment: %v", err)
+		return err
+	}
+	err = recordIssueEvent(tx, IssueEvent{
+		IssueID:   issueID,
+		ActorID:   strPtr(changedBy),
+		EventType: eventAssigneeChanged,
+		Field:     strPtr("assigned_to"),
+		OldValue:  previous,
+		NewValue:  assignee,
+	})
+	if err != nil || assignee == nil {
+		return err
+	}
+	return addIssueWatcher(tx, issueID, *assignee)
+}
+
+func getIssueAssignments(issueID string) ([]IssueAssignment, error) {
+	query := `
+	SELECT id, issue_id, previous_assignee, assignee, changed_by, created_at
+	FROM issue_assignments
+	WHERE issue_id = $1
+	ORDER BY created_at DESC
+	`
+	rows, err := db.Query(query, issueID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var assignments []IssueAssignment
+	for rows.Next() {
+		var assignment IssueAssignment
+		err := rows.Scan(&assignment.ID, &assignment.IssueID, &assignment.PreviousAssignee, &assignment.Assignee, &assignment.ChangedBy, &assignment.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, assignment)
+	}
+	return assignments, nil
+}
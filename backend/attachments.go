@@ -0,0 +1,534 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultMaxAttachmentSize = 25 << 20
+	attachmentURLTTL         = 15 * time.Minute
+	// attachmentReservationTTL bounds how long an upload may hold quota
+	// before it is stored
+	attachmentReservationTTL = time.Hour
+)
+
+// Issue event types for attachments
+const (
+	eventAttachmentAdded   = "attachment_added"
+	eventAttachmentRemoved = "attachment_removed"
+)
+
+var (
+	errAttachmentTooLarge = errors.New("attachment is too large")
+	errQuotaExceeded      = errors.New("project attachment quota exceeded")
+)
+
+// maxAttachmentSize is the largest accepted upload, from MAX_ATTACHMENT_SIZE
+// in bytes.
+func maxAttachmentSize() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("MAX_ATTACHMENT_SIZE"), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return defaultMaxAttachmentSize
+}
+
+func uploadIssueAttachmentHandler(c *gin.Context) {
+	uploadAttachment(c, c.GetString("project_id"), c.Param("id"), nil)
+}
+
+func uploadCommentAttachmentHandler(c *gin.Context) {
+	comment, err := getCommentByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+	// Only the author, or a moderator, can attach files to a comment
+	if comment.CreatedBy != c.GetString("user_id") && !authorize(c, c.GetString("project_id"), "comment:moderate") {
+		return
+	}
+	uploadAttachment(c, c.GetString("project_id"), comment.IssueID, &comment.ID)
+}
+
+// uploadAttachment reads the "file" part of a multipart upload, stores it and
+// records it against the issue and optional comment.
+func uploadAttachment(c *gin.Context, projectID, issueID string, commentID *string) {
+	maxSize := maxAttachmentSize()
+	// Leave room for the multipart framing around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+1<<20)
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a multipart/form-data upload"})
+		return
+	}
+
+	var upload *spooledUpload
+	var filename string
+	for upload == nil {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing file field"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid multipart upload"})
+			return
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+		filename = cleanAttachmentFilename(part.FileName())
+		upload, err = spoolUpload(part, maxSize)
+		part.Close()
+		if errors.Is(err, errAttachmentTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Attachments may be at most %d bytes", maxSize)})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read upload"})
+			return
+		}
+	}
+	defer upload.Close()
+
+	attachment := Attachment{
+		ID:          uuid.New().String(),
+		ProjectID:   projectID,
+		IssueID:     issueID,
+		CommentID:   commentID,
+		Filename:    filename,
+		ContentType: upload.contentType,
+		Size:        upload.size,
+		Checksum:    upload.checksum,
+		UploadedBy:  strPtr(c.GetString("user_id")),
+		CreatedAt:   time.Now().Format(time.RFC3339),
+	}
+	attachment.StorageKey = "projects/" + projectID + "/" + attachment.ID
+
+	if err := createAttachment(c, attachment, upload.file); err != nil {
+		if errors.Is(err, errQuotaExceeded) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Project attachment quota exceeded"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store attachment"})
+		return
+	}
+
+	attachment.DownloadURL = attachmentDownloadURL(attachment.ID, time.Now())
+	c.JSON(http.StatusCreated, attachment)
+}
+
+// spooledUpload is an upload buffered to a temporary file, so its size and
+// checksum are known before it is stored.
+type spooledUpload struct {
+	file        *os.File
+	size        int64
+	checksum    string
+	contentType string
+}
+
+func (u *spooledUpload) Close() {
+	u.file.Close()
+	os.Remove(u.file.Name())
+}
+
+// spoolUpload copies r to a temporary file, hashing it on the way and
+// sniffing its MIME type from the first bytes. Client-supplied content types
+// are ignored.
+func spoolUpload(r io.Reader, maxSize int64) (*spooledUpload, error) {
+	file, err := os.CreateTemp("", "trackmybugs-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	upload := &spooledUpload{file: file}
+
+	hash := sha256.New()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		upload.Close()
+		return nil, err
+	}
+	head = head[:n]
+	upload.contentType = http.DetectContentType(head)
+
+	body := io.MultiReader(bytes.NewReader(head), io.LimitReader(r, maxSize+1-int64(n)))
+	upload.size, err = io.Copy(io.MultiWriter(file, hash), body)
+	if err == nil && upload.size > maxSize {
+		err = errAttachmentTooLarge
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		upload.Close()
+		return nil, err
+	}
+	upload.checksum = hex.EncodeToString(hash.Sum(nil))
+	return upload, nil
+}
+
+// cleanAttachmentFilename keeps the base name of an uploaded file, without
+// control characters and within the column size.
+func cleanAttachmentFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	for utf8.RuneCountInString(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	return name
+}
+
+func getIssueAttachmentsHandler(c *gin.Context) {
+	attachments, err := getAttachmentsByIssue(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attachments"})
+		return
+	}
+	now := time.Now()
+	for i := range attachments {
+		attachments[i].DownloadURL = attachmentDownloadURL(attachments[i].ID, now)
+	}
+	if attachments == nil {
+		attachments = []Attachment{}
+	}
+	c.JSON(http.StatusOK, gin.H{"attachments": attachments})
+}
+
+func getAttachmentHandler(c *gin.Context) {
+	attachment, err := getAttachmentByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	attachment.DownloadURL = attachmentDownloadURL(attachment.ID, time.Now())
+	c.JSON(http.StatusOK, attachment)
+}
+
+// downloadAttachmentHandler serves an attachment to an authenticated member
+// of its project.
+func downloadAttachmentHandler(c *gin.Context) {
+	attachment, err := getAttachmentByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	serveAttachment(c, attachment)
+}
+
+// signedAttachmentHandler serves an attachment through a signed download URL,
+// for clients such as <img> tags that cannot send an Authorization header.
+func signedAttachmentHandler(c *gin.Context) {
+	attachmentID := c.Param("id")
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Download link has expired"})
+		return
+	}
+	expected := signAttachmentURL(attachmentID, expires)
+	if !hmac.Equal([]byte(expected), []byte(c.Query("signature"))) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid download signature"})
+		return
+	}
+
+	attachment, err := getAttachmentByID(attachmentID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	serveAttachment(c, attachment)
+}
+
+func serveAttachment(c *gin.Context, attachment Attachment) {
+	body, err := storage.Get(c.Request.Context(), attachment.StorageKey)
+	if errors.Is(err, errBlobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment contents not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Storage error reading attachment %s: %v", attachment.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read attachment"})
+		return
+	}
+	defer body.Close()
+
+	// Images are shown inline; everything else is downloaded. Uploaded files
+	// are never allowed to run scripts in our origin.
+	disposition := "attachment"
+	if strings.HasPrefix(attachment.ContentType, "image/") {
+		disposition = "inline"
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "sandbox")
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Header("ETag", `"`+attachment.Checksum+`"`)
+	c.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, body, nil)
+}
+
+func deleteAttachmentHandler(c *gin.Context) {
+	attachment, err := getAttachmentByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+
+	// Uploaders may delete their own attachments
+	perm := "attachment:delete"
+	if attachment.UploadedBy != nil && *attachment.UploadedBy == c.GetString("user_id") {
+		perm = "attachment:create"
+	}
+	if !authorize(c, attachment.ProjectID, perm) {
+		return
+	}
+
+	err = withTx(func(tx *Tx) error {
+		if _, err := tx.Exec(`DELETE FROM attachments WHERE id = $1`, attachment.ID); err != nil {
+			log.Printf("Database error deleting attachment: %v", err)
+			return err
+		}
+		return recordIssueEvent(tx, IssueEvent{
+			IssueID:   attachment.IssueID,
+			ActorID:   strPtr(c.GetString("user_id")),
+			EventType: eventAttachmentRemoved,
+			Field:     strPtr("attachment"),
+			OldValue:  strPtr(attachment.Filename),
+			CommentID: attachment.CommentID,
+		})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete attachment"})
+		return
+	}
+	removeAttachmentBlobs([]string{attachment.StorageKey})
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted successfully"})
+}
+
+func getAttachmentUsageHandler(c *gin.Context) {
+	used, quota, err := getAttachmentUsage(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attachment usage"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"used": used, "quota": quota})
+}
+
+func updateAttachmentQuotaHandler(c *gin.Context) {
+	var body struct {
+		Quota *int64 `json:"quota" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if *body.Quota < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quota cannot be negative"})
+		return
+	}
+
+	query := `UPDATE projects SET attachment_quota = $1 WHERE id = $2`
+	if _, err := db.Exec(query, *body.Quota, c.Param("id")); err != nil {
+		log.Printf("Database error updating attachment quota: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update quota"})
+		return
+	}
+
+	used, quota, err := getAttachmentUsage(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attachment usage"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"used": used, "quota": quota})
+}
+
+// attachmentDownloadURL returns a signed, short-lived download path.
+func attachmentDownloadURL(attachmentID string, now time.Time) string {
+	expires := now.Add(attachmentURLTTL).Unix()
+	return "/api/v1/attachments/" + attachmentID + "/content?expires=" + strconv.FormatInt(expires, 10) +
+		"&signature=" + signAttachmentURL(attachmentID, expires)
+}
+
+func signAttachmentURL(attachmentID string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("JWT_SECRET")))
+	fmt.Fprintf(mac, "attachment:%s:%d", attachmentID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// createAttachment stores the contents and records the attachment, refusing
+// uploads that would take the project over its quota.
+func createAttachment(c *gin.Context, attachment Attachment, contents io.Reader) error {
+	// Reserve the space first so the project row is only locked briefly and
+	// not for the whole upload
+	if err := reserveAttachmentSpace(attachment); err != nil {
+		return err
+	}
+	release := func() {
+		if _, err := db.Exec(`DELETE FROM attachment_reservations WHERE id = $1`, attachment.ID); err != nil {
+			log.Printf("Database error releasing attachment reservation: %v", err)
+		}
+	}
+
+	if err := storage.Put(c.Request.Context(), attachment.StorageKey, contents, attachment.Size, attachment.ContentType); err != nil {
+		log.Printf("Storage error writing attachment: %v", err)
+		release()
+		return err
+	}
+
+	err := withTx(func(tx *Tx) error {
+		query := `
+		INSERT INTO attachments (id, project_id, issue_id, comment_id, filename, content_type, size, checksum, storage_key, uploaded_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		`
+		_, err := tx.Exec(query, attachment.ID, attachment.ProjectID, attachment.IssueID, attachment.CommentID, attachment.Filename,
+			attachment.ContentType, attachment.Size, attachment.Checksum, attachment.StorageKey, attachment.UploadedBy, attachment.CreatedAt)
+		if err != nil {
+			log.Printf("Database error creating attachment: %v", err)
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM attachment_reservations WHERE id = $1`, attachment.ID); err != nil {
+			return err
+		}
+		return recordIssueEvent(tx, IssueEvent{
+			IssueID:   attachment.IssueID,
+			ActorID:   attachment.UploadedBy,
+			EventType: eventAttachmentAdded,
+			Field:     strPtr("attachment"),
+			NewValue:  strPtr(attachment.Filename),
+			CommentID: attachment.CommentID,
+		})
+	})
+	if err != nil {
+		removeAttachmentBlobs([]string{attachment.StorageKey})
+		release()
+	}
+	return err
+}
+
+// reserveAttachmentSpace counts an upload against its project's quota
+// before it is stored. Reservations of uploads that never finished expire
+// after attachmentReservationTTL.
+func reserveAttachmentSpace(attachment Attachment) error {
+	return withTx(func(tx *Tx) error {
+		var quota, used int64
+		err := tx.QueryRow(`SELECT attachment_quota FROM projects WHERE id = $1 FOR UPDATE`, attachment.ProjectID).Scan(&quota)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM attachment_reservations WHERE project_id = $1 AND expires_at <= NOW()`, attachment.ProjectID); err != nil {
+			return err
+		}
+		query := `
+		SELECT
+			(SELECT COALESCE(SUM(size), 0) FROM attachments WHERE project_id = $1) +
+			(SELECT COALESCE(SUM(size), 0) FROM attachment_reservations WHERE project_id = $1)
+		`
+		if err := tx.QueryRow(query, attachment.ProjectID).Scan(&used); err != nil {
+			return err
+		}
+		if used+attachment.Size > quota {
+			return errQuotaExceeded
+		}
+		query = `INSERT INTO attachment_reservations (id, project_id, size, expires_at) VALUES ($1, $2, $3, $4)`
+		_, err = tx.Exec(query, attachment.ID, attachment.ProjectID, attachment.Size, time.Now().Add(attachmentReservationTTL))
+		return err
+	})
+}
+
+// attachmentKeys lists the storage keys of attachments where column = id,
+// so their contents can be removed once the rows are gone.
+func attachmentKeys(tx *Tx, column, id string) ([]string, error) {
+	rows, err := tx.Query(`SELECT storage_key FROM attachments WHERE `+column+` = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// removeAttachmentBlobs deletes stored contents after their rows have been
+// deleted. Failures only leave orphaned blobs behind, so they are logged.
+func removeAttachmentBlobs(keys []string) {
+	for _, key := range keys {
+		if err := storage.Delete(context.Background(), key); err != nil {
+			log.Printf("Storage error deleting %s: %v", key, err)
+		}
+	}
+}
+
+const attachmentColumns = `id, project_id, issue_id, comment_id, filename, content_type, size, checksum, storage_key, uploaded_by, created_at`
+
+func scanAttachment(row rowScanner) (Attachment, error) {
+	var a Attachment
+	err := row.Scan(&a.ID, &a.ProjectID, &a.IssueID, &a.CommentID, &a.Filename, &a.ContentType, &a.Size, &a.Checksum, &a.StorageKey, &a.UploadedBy, &a.CreatedAt)
+	return a, err
+}
+
+func getAttachmentByID(attachmentID string) (Attachment, error) {
+	return scanAttachment(db.QueryRow(`SELECT `+attachmentColumns+` FROM attachments WHERE id = $1`, attachmentID))
+}
+
+func getAttachmentsByIssue(issueID string) ([]Attachment, error) {
+	rows, err := db.Query(`SELECT `+attachmentColumns+` FROM attachments WHERE issue_id = $1 ORDER BY created_at`, issueID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []Attachment
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, nil
+}
+
+func getAttachmentUsage(projectID string) (used, quota int64, err error) {
+	query := `
+	SELECT COALESCE((SELECT SUM(size) FROM attachments WHERE project_id = p.id), 0), p.attachment_quota
+	FROM projects p
+	WHERE p.id = $1
+	`
+	err = db.QueryRow(query, projectID).Scan(&used, &quota)
+	return used, quota, err
+}
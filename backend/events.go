@@ -0,0 +1,182 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Issue event types recorded in issue_events
+const (
+	eventIssueCreated    = "issue_created"
+	eventFieldChanged    = "field_changed"
+	eventAssigneeChanged = "assignee_changed"
+	eventLabelAdded      = "label_added"
+	eventLabelRemoved    = "label_removed"
+	eventLinkAdded       = "link_added"
+	eventLinkRemoved     = "link_removed"
+	eventCommitLinked    = "commit_linked"
+	eventCommentAdded    = "comment_added"
+	eventCommentEdited   = "comment_edited"
+	eventCommentDeleted  = "comment_deleted"
+)
+
+func getIssueActivityHandler(c *gin.Context) {
+	issueID := c.Param("id")
+	limit := 50
+	offset := 0
+	if l := c.Query("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if v, err := strconv.Atoi(o); err == nil && v >= 0 {
+			offset = v
+		}
+	}
+	newestFirst := c.Query("order") == "desc"
+
+	total, err := countIssueEvents(issueID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count activity"})
+		return
+	}
+	events, err := getIssueEventsPaginated(issueID, newestFirst, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch activity"})
+		return
+	}
+	if events == nil {
+		events = []IssueEvent{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"activity": events,
+		"total":    total,
+		"limit":    limit,
+		"offset":   offset,
+		"message":  "Activity fetched successfully",
+	})
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+// nilIfEmpty treats an empty optional string the same as a missing one.
+func nilIfEmpty(s *string) *string {
+	if s == nil || *s == "" {
+		return nil
+	}
+	return s
+}
+
+func sameStringPtr(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// recordIssueEvent appends an event to the issue's activity log as part of
+// the caller's transaction.
+func recordIssueEvent(tx *Tx, event IssueEvent) error {
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	if event.CreatedAt == "" {
+		event.CreatedAt = time.Now().Format(time.RFC3339)
+	}
+	query := `
+	INSERT INTO issue_events (id, issue_id, actor_id, event_type, field, old_value, new_value, comment_id, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err := tx.Exec(query, event.ID, event.IssueID, event.ActorID, event.EventType, event.Field, event.OldValue, event.NewValue, event.CommentID, event.CreatedAt)
+	if err != nil {
+		log.Printf("Database error recording issue event: %v", err)
+	}
+	return err
+}
+
+// recordIssueChanges writes one field_changed event per field that differs
+// between the old and new versions of an issue, and returns those fields.
+func recordIssueChanges(tx *Tx, before, after Issue, actorID string) ([]string, error) {
+	changes := []struct {
+		field    string
+		old, new *string
+	}{
+		{"title", &before.Title, &after.Title},
+		{"description", &before.Description, &after.Description},
+		{"status", &before.Status, &after.Status},
+		{"priority", &before.Priority, &after.Priority},
+		{"resolution", before.Resolution, after.Resolution},
+		{"milestone_id", before.MilestoneID, after.MilestoneID},
+		{"parent_id", before.ParentID, after.ParentID},
+	}
+	var changed []string
+	for _, change := range changes {
+		if sameStringPtr(change.old, change.new) {
+			continue
+		}
+		changed = append(changed, change.field)
+		err := recordIssueEvent(tx, IssueEvent{
+			IssueID:   after.ID,
+			ActorID:   nilIfEmpty(&actorID),
+			EventType: eventFieldChanged,
+			Field:     strPtr(change.field),
+			OldValue:  change.old,
+			NewValue:  change.new,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return changed, nil
+}
+
+func countIssueEvents(issueID string) (int, error) {
+	var total int
+	err := db.QueryRow(`SELECT COUNT(*) FROM issue_events WHERE issue_id = $1`, issueID).Scan(&total)
+	return total, err
+}
+
+// getIssueEventsPaginated returns the issue timeline with actor names and the
+// current text of any comment an event refers to.
+func getIssueEventsPaginated(issueID string, newestFirst bool, limit, offset int) ([]IssueEvent, error) {
+	order := "ASC"
+	if newestFirst {
+		order = "DESC"
+	}
+	query := `
+	SELECT e.id, e.issue_id, e.actor_id, u.first_name || ' ' || u.last_name, e.event_type, e.field, e.old_value, e.new_value, e.comment_id, cm.content, e.created_at
+	FROM issue_events e
+	LEFT JOIN users u ON u.id = e.actor_id
+	LEFT JOIN comments cm ON cm.id = e.comment_id
+	WHERE e.issue_id = $1
+	ORDER BY e.seq ` + order + `
+	LIMIT $2 OFFSET $3
+	`
+	rows, err := db.Query(query, issueID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []IssueEvent
+	for rows.Next() {
+		var event IssueEvent
+		err := rows.Scan(&event.ID, &event.IssueID, &event.ActorID, &event.ActorName, &event.EventType, &event.Field, &event.OldValue, &event.NewValue, &event.CommentID, &event.CommentContent, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
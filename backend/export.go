@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// exportBatchSize is how many issues are read before their labels and
+// comments are loaded and the batch is written out. Only one batch is held
+// in memory at a time.
+const exportBatchSize = 100
+
+var exportContentTypes = map[string]string{
+	"csv":    "text/csv; charset=utf-8",
+	"json":   "application/json",
+	"ndjson": "application/x-ndjson",
+}
+
+// exportColumns follow issueColumns in the export query and are read by
+// scanExportedIssue.
+const exportColumns = `,
+	(SELECT email FROM users WHERE users.id = issues.assigned_to),
+	COALESCE((SELECT email FROM users WHERE users.id = issues.created_by), ''),
+	(SELECT title FROM milestones WHERE milestones.id = issues.milestone_id),
+	(SELECT name FROM sprints WHERE sprints.id = issues.sprint_id),
+	(SELECT p.key || '-' || parent.number FROM issues parent JOIN projects p ON p.id = parent.project_id WHERE parent.id = issues.parent_id)`
+
+// exportIssuesHandler streams every issue in a project matching the same
+// filters as the issue list, as CSV, a JSON array or newline-delimited JSON.
+// Comments are included with ?include_comments=true.
+func exportIssuesHandler(c *gin.Context) {
+	projectID := c.Param("id")
+	format := c.DefaultQuery("format", "csv")
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be csv, json or ndjson"})
+		return
+	}
+	project, err := getProjectByID(projectID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+	filter, _, ok := issueFilterFromQuery(c, projectID)
+	if !ok {
+		return
+	}
+	filter.ProjectID = projectID
+	includeComments := c.Query("include_comments") == "true"
+
+	b := &sqlBuilder{}
+	query := `SELECT ` + issueColumns + exportColumns + ` FROM issues` + filter.whereSQL(b) + ` ORDER BY ` + filter.orderSQL()
+	rows, err := db.QueryContext(c.Request.Context(), query, b.args...)
+	if err != nil {
+		log.Printf("Database error exporting issues: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export issues"})
+		return
+	}
+	defer rows.Close()
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": project.Key + "-issues." + format}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	// Once the first byte is written the status cannot change, so a failure
+	// part way through leaves a truncated file and is only logged
+	out := newIssueExportWriter(format, c.Writer, includeComments)
+	batch := make([]ExportedIssue, 0, exportBatchSize)
+	writeBatch := func() error {
+		if err := attachExportDetails(batch, includeComments); err != nil {
+			return err
+		}
+		for _, issue := range batch {
+			if err := out.write(issue); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		if err := out.flush(); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+	err = func() error {
+		if err := out.begin(); err != nil {
+			return err
+		}
+		for rows.Next() {
+			issue, err := scanExportedIssue(rows)
+			if err != nil {
+				return err
+			}
+			batch = append(batch, issue)
+			if len(batch) == exportBatchSize {
+				if err := writeBatch(); err != nil {
+					return err
+				}
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if err := writeBatch(); err != nil {
+			return err
+		}
+		return out.end()
+	}()
+	if err != nil {
+		log.Printf("Error exporting issues for project %s: %v", projectID, err)
+		return
+	}
+	c.Writer.Flush()
+}
+
+// extraScanner appends more destinations to every Scan, so a query can select
+// columns after those a shared scan function reads.
+type extraScanner struct {
+	rowScanner
+	extra []interface{}
+}
+
+func (s extraScanner) Scan(dest ...interface{}) error {
+	return s.rowScanner.Scan(append(dest, s.extra...)...)
+}
+
+func scanExportedIssue(row rowScanner) (ExportedIssue, error) {
+	var exported ExportedIssue
+	issue, err := scanIssue(extraScanner{row, []interface{}{
+		&exported.AssigneeEmail, &exported.ReporterEmail, &exported.Milestone, &exported.Sprint, &exported.ParentKey,
+	}})
+	exported.Issue = issue
+	return exported, err
+}
+
+// attachExportDetails fills in the labels, and comments if asked for, of a
+// batch of exported issues.
+func attachExportDetails(batch []ExportedIssue, includeComments bool) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	issues := make([]Issue, len(batch))
+	ids := make([]string, len(batch))
+	for i := range batch {
+		issues[i] = batch[i].Issue
+		ids[i] = batch[i].ID
+	}
+	if err := attachIssueLabels(db, issues); err != nil {
+		return err
+	}
+	for i := range batch {
+		batch[i].Labels = issues[i].Labels
+	}
+	if !includeComments {
+		return nil
+	}
+
+	query := `
+	SELECT c.issue_id, c.id, c.created_by, u.email, c.content, c.created_at, c.updated_at
+	FROM comments c
+	JOIN users u ON u.id = c.created_by
+	WHERE c.issue_id = ANY($1::uuid[])
+	ORDER BY c.created_at ASC
+	`
+	rows, err := db.Query(query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	comments := map[string][]ExportedComment{}
+	for rows.Next() {
+		var issueID string
+		var comment ExportedComment
+		err := rows.Scan(&issueID, &comment.ID, &comment.AuthorID, &comment.AuthorEmail, &comment.Content, &comment.CreatedAt, &comment.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		comments[issueID] = append(comments[issueID], comment)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i := range batch {
+		batch[i].Comments = comments[batch[i].ID]
+		if batch[i].Comments == nil {
+			batch[i].Comments = []ExportedComment{}
+		}
+	}
+	return nil
+}
+
+// issueExportWriter writes exported issues in one format.
+type issueExportWriter interface {
+	begin() error
+	write(issue ExportedIssue) error
+	// flush pushes buffered output to the underlying writer
+	flush() error
+	end() error
+}
+
+func newIssueExportWriter(format string, w io.Writer, includeComments bool) issueExportWriter {
+	if format == "csv" {
+		return &csvIssueWriter{w: csv.NewWriter(w), includeComments: includeComments}
+	}
+	return &jsonIssueWriter{w: w, enc: json.NewEncoder(w), array: format == "json"}
+}
+
+// jsonIssueWriter writes issues as a JSON array, or one object per line for
+// NDJSON.
+type jsonIssueWriter struct {
+	w       io.Writer
+	enc     *json.Encoder
+	array   bool
+	written int
+}
+
+func (j *jsonIssueWriter) begin() error {
+	if !j.array {
+		return nil
+	}
+	_, err := io.WriteString(j.w, "[\n")
+	return err
+}
+
+func (j *jsonIssueWriter) write(issue ExportedIssue) error {
+	if j.array && j.written > 0 {
+		if _, err := io.WriteString(j.w, ","); err != nil {
+			return err
+		}
+	}
+	j.written++
+	return j.enc.Encode(issue)
+}
+
+func (j *jsonIssueWriter) flush() error { return nil }
+
+func (j *jsonIssueWriter) end() error {
+	if !j.array {
+		return nil
+	}
+	_, err := io.WriteString(j.w, "]\n")
+	return err
+}
+
+// csvIssueWriter writes one row per issue, for opening in a spreadsheet.
+type csvIssueWriter struct {
+	w               *csv.Writer
+	includeComments bool
+}
+
+func (c *csvIssueWriter) begin() error {
+	header := []string{"key", "id", "title", "description", "status", "priority", "resolution", "assignee", "reporter",
+		"milestone", "sprint", "parent", "labels", "created_at", "updated_at"}
+	if c.includeComments {
+		header = append(header, "comments")
+	}
+	return c.w.Write(header)
+}
+
+func (c *csvIssueWriter) write(issue ExportedIssue) error {
+	labels := make([]string, len(issue.Labels))
+	for i, label := range issue.Labels {
+		labels[i] = label.Name
+	}
+	record := []string{
+		issue.Key,
+		issue.ID,
+		issue.Title,
+		issue.Description,
+		issue.Status,
+		issue.Priority,
+		stringOrEmpty(issue.Resolution),
+		stringOrEmpty(issue.AssigneeEmail),
+		issue.ReporterEmail,
+		stringOrEmpty(issue.Milestone),
+		stringOrEmpty(issue.Sprint),
+		stringOrEmpty(issue.ParentKey),
+		strings.Join(labels, ", "),
+		issue.CreatedAt,
+		issue.UpdatedAt,
+	}
+	if c.includeComments {
+		comments := make([]string, len(issue.Comments))
+		for i, comment := range issue.Comments {
+			comments[i] = comment.CreatedAt + " " + comment.AuthorEmail + ": " + comment.Content
+		}
+		record = append(record, strings.Join(comments, "\n\n"))
+	}
+	for i := range record {
+		record[i] = csvSafe(record[i])
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvIssueWriter) flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvIssueWriter) end() error {
+	return c.flush()
+}
+
+// csvSafe stops a spreadsheet from treating user-supplied text as a formula
+// by prefixing a quote to cells that start like one.
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func getSavedFiltersHandler(c *gin.Context) {
+	filters, err := getSavedFiltersForUser(c.GetString("user_id"), c.Query("project_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch filters"})
+		return
+	}
+	if filters == nil {
+		filters = []SavedFilter{}
+	}
+	c.JSON(http.StatusOK, gin.H{"filters": filters})
+}
+
+func getSavedFilterHandler(c *gin.Context) {
+	filter, ok := loadVisibleSavedFilter(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, filter)
+}
+
+func createSavedFilterHandler(c *gin.Context) {
+	var body struct {
+		Name      string  `json:"name" binding:"required"`
+		ProjectID *string `json:"project_id"`
+		Query     string  `json:"query"`
+		Shared    bool    `json:"shared"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter := SavedFilter{
+		ID:        uuid.New().String(),
+		OwnerID:   c.GetString("user_id"),
+		ProjectID: nilIfEmpty(body.ProjectID),
+		Name:      strings.TrimSpace(body.Name),
+		Query:     strings.TrimSpace(body.Query),
+		Shared:    body.Shared,
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+	filter.UpdatedAt = filter.CreatedAt
+	if !validateSavedFilter(c, filter) {
+		return
+	}
+
+	if err := createSavedFilter(filter); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create filter"})
+		return
+	}
+	c.JSON(http.StatusCreated, filter)
+}
+
+func updateSavedFilterHandler(c *gin.Context) {
+	filter, ok := loadOwnedSavedFilter(c)
+	if !ok {
+		return
+	}
+
+	// A project_id of "" moves the filter out of its project
+	var body struct {
+		Name      *string `json:"name"`
+		ProjectID *string `json:"project_id"`
+		Query     *string `json:"query"`
+		Shared    *bool   `json:"shared"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if body.Name != nil {
+		filter.Name = strings.TrimSpace(*body.Name)
+	}
+	if body.ProjectID != nil {
+		filter.ProjectID = nilIfEmpty(body.ProjectID)
+	}
+	if body.Query != nil {
+		filter.Query = strings.TrimSpace(*body.Query)
+	}
+	if body.Shared != nil {
+		filter.Shared = *body.Shared
+	}
+	if !validateSavedFilter(c, filter) {
+		return
+	}
+
+	if err := updateSavedFilter(filter); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update filter"})
+		return
+	}
+
+	filter, err := getSavedFilterByID(filter.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch updated filter"})
+		return
+	}
+	c.JSON(http.StatusOK, filter)
+}
+
+func deleteSavedFilterHandler(c *gin.Context) {
+	filter, ok := loadOwnedSavedFilter(c)
+	if !ok {
+		return
+	}
+	if _, err := db.Exec(`DELETE FROM saved_filters WHERE id = $1`, filter.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete filter"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Filter deleted successfully"})
+}
+
+// canViewSavedFilter reports whether the current user may see and run a
+// filter: their own filters, and shared filters of projects they can view.
+func canViewSavedFilter(c *gin.Context, filter SavedFilter) (bool, error) {
+	principal := currentPrincipal(c)
+	if filter.OwnerID == principal.User.ID {
+		return true, nil
+	}
+	if !filter.Shared || filter.ProjectID == nil {
+		return false, nil
+	}
+	return principal.Can(*filter.ProjectID, "project:view")
+}
+
+// loadVisibleSavedFilter fetches a filter, writing a 404 if it does not exist
+// or is not visible to the current user.
+func loadVisibleSavedFilter(c *gin.Context, filterID string) (SavedFilter, bool) {
+	filter, err := getSavedFilterByID(filterID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Filter not found"})
+		return filter, false
+	}
+	visible, err := canViewSavedFilter(c, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return filter, false
+	}
+	if !visible {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Filter not found"})
+		return filter, false
+	}
+	return filter, true
+}
+
+// loadOwnedSavedFilter is loadVisibleSavedFilter for changes, which only the
+// owner may make.
+func loadOwnedSavedFilter(c *gin.Context) (SavedFilter, bool) {
+	filter, ok := loadVisibleSavedFilter(c, c.Param("id"))
+	if ok && filter.OwnerID != c.GetString("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can change this filter"})
+		return filter, false
+	}
+	return filter, ok
+}
+
+// validateSavedFilter checks the name, project access and query of a filter,
+// writing an error response when it is not valid.
+func validateSavedFilter(c *gin.Context, filter SavedFilter) bool {
+	if filter.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return false
+	}
+	if filter.Shared && filter.ProjectID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Shared filters must belong to a project"})
+		return false
+	}
+	if filter.ProjectID != nil {
+		if _, err := uuid.Parse(*filter.ProjectID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project_id"})
+			return false
+		}
+		if !authorize(c, *filter.ProjectID, "project:view") {
+			return false
+		}
+	}
+	if filter.Query != "" {
+		if _, err := parseIssueQuery(filter.Query, filter.OwnerID, time.Now()); err != nil {
+			writeQueryError(c, err)
+			return false
+		}
+	}
+	return true
+}
+
+const savedFilterColumns = `id, owner_id, project_id, name, query, shared, created_at, updated_at`
+
+func scanSavedFilter(row rowScanner) (SavedFilter, error) {
+	var filter SavedFilter
+	err := row.Scan(&filter.ID, &filter.OwnerID, &filter.ProjectID, &filter.Name, &filter.Query, &filter.Shared, &filter.CreatedAt, &filter.UpdatedAt)
+	return filter, err
+}
+
+func getSavedFilterByID(filterID string) (SavedFilter, error) {
+	return scanSavedFilter(db.QueryRow(`SELECT `+savedFilterColumns+` FROM saved_filters WHERE id = $1`, filterID))
+}
+
+// getSavedFiltersForUser lists the user's own filters and the filters shared
+// with projects they belong to, optionally limited to one project.
+func getSavedFiltersForUser(userID, projectID string) ([]SavedFilter, error) {
+	query := `
+	SELECT ` + savedFilterColumns + `
+	FROM saved_filters
+	WHERE (owner_id = $1 OR (shared AND project_id IN (SELECT project_id FROM project_members WHERE user_id = $1)))
+	`
+	args := []interface{}{userID}
+	if projectID != "" {
+		query += ` AND project_id = $2`
+		args = append(args, projectID)
+	}
+	query += ` ORDER BY name, created_at`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var filters []SavedFilter
+	for rows.Next() {
+		filter, err := scanSavedFilter(rows)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+func createSavedFilter(filter SavedFilter) error {
+	query := `
+	INSERT INTO saved_filters (id, owner_id, project_id, name, query, shared, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := db.Exec(query, filter.ID, filter.OwnerID, filter.ProjectID, filter.Name, filter.Query, filter.Shared, filter.CreatedAt, filter.UpdatedAt)
+	if err != nil {
+		log.Printf("Database error creating saved filter: %v", err)
+	}
+	return err
+}
+
+func updateSavedFilter(filter SavedFilter) error {
+	query := `
+	UPDATE saved_filters
+	SET project_id = $1, name = $2, query = $3, shared = $4, updated_at = $5
+	WHERE id = $6
+	`
+	_, err := db.Exec(query, filter.ProjectID, filter.Name, filter.Query, filter.Shared, time.Now().Format(time.RFC3339), filter.ID)
+	if err != nil {
+		log.Printf("Database error updating saved filter: %v", err)
+	}
+	return err
+}
@@ -0,0 +1,512 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxGitPayloadSize caps the body of an inbound Git webhook.
+const maxGitPayloadSize = 5 << 20
+
+// Git hosts that can send push and merge request webhooks
+var gitProviders = map[string]bool{"github": true, "gitlab": true, "gitea": true}
+
+// issueRefPattern finds issue keys such as PROJ-12 in commit messages and
+// branch names, with an optional closing keyword in front.
+var issueRefPattern = regexp.MustCompile(`(?i)(?:\b(fix(?:e[sd])?|close[sd]?|resolve[sd]?)\s*:?\s+)?\b([a-z][a-z0-9]{1,9}-[1-9][0-9]*)\b`)
+
+// gitEvent is a push or merged merge request, normalized across providers.
+type gitEvent struct {
+	Repository    string
+	Branch        string
+	DefaultBranch string
+	// Merged is set for a merge request that has just been merged
+	Merged  bool
+	Commits []gitCommit
+}
+
+type gitCommit struct {
+	SHA         string
+	Message     string
+	URL         string
+	AuthorName  string
+	AuthorEmail string
+	Timestamp   *string
+}
+
+// issueRef is an issue key mentioned in a commit, and whether a closing
+// keyword came before it.
+type issueRef struct {
+	Key    string
+	Closes bool
+}
+
+func getGitHooksHandler(c *gin.Context) {
+	hooks, err := getGitHooksByProject(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch Git hooks"})
+		return
+	}
+	if hooks == nil {
+		hooks = []GitHook{}
+	}
+	c.JSON(http.StatusOK, gin.H{"git_hooks": hooks})
+}
+
+func createGitHookHandler(c *gin.Context) {
+	var body struct {
+		Provider string `json:"provider" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !gitProviders[body.Provider] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provider must be one of github, gitlab or gitea"})
+		return
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+	hook := GitHook{
+		ID:        uuid.New().String(),
+		ProjectID: c.Param("id"),
+		Provider:  body.Provider,
+		Secret:    hex.EncodeToString(buf),
+		CreatedBy: strPtr(c.GetString("user_id")),
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+	hook.URL = gitHookURL(hook.ID)
+
+	query := `
+	INSERT INTO git_hooks (id, project_id, provider, secret, created_by, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	if _, err := db.Exec(query, hook.ID, hook.ProjectID, hook.Provider, hook.Secret, hook.CreatedBy, hook.CreatedAt); err != nil {
+		log.Printf("Database error creating Git hook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create Git hook"})
+		return
+	}
+
+	// The secret is only ever returned when the hook is created
+	c.JSON(http.StatusCreated, hook)
+}
+
+func deleteGitHookHandler(c *gin.Context) {
+	query := `DELETE FROM git_hooks WHERE id = $1 AND project_id = $2`
+	result, err := db.Exec(query, c.Param("hookId"), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Git hook not found"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Git hook not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Git hook deleted successfully"})
+}
+
+func getIssueCommitsHandler(c *gin.Context) {
+	query := `
+	SELECT issue_id, sha, repository, branch, message, url, author_name, author_email, committed_at, created_at
+	FROM issue_commits
+	WHERE issue_id = $1
+	ORDER BY COALESCE(committed_at, created_at) DESC, sha
+	`
+	rows, err := db.Query(query, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch commits"})
+		return
+	}
+	defer rows.Close()
+
+	commits := []IssueCommit{}
+	for rows.Next() {
+		var ic IssueCommit
+		err := rows.Scan(&ic.IssueID, &ic.SHA, &ic.Repository, &ic.Branch, &ic.Message, &ic.URL, &ic.AuthorName, &ic.AuthorEmail, &ic.CommittedAt, &ic.CreatedAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch commits"})
+			return
+		}
+		commits = append(commits, ic)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch commits"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"commits": commits})
+}
+
+// receiveGitHookHandler accepts push and merge request webhooks from a Git
+// host. The request carries no session; it is authenticated by the hook's
+// secret instead.
+func receiveGitHookHandler(c *gin.Context) {
+	hook, err := getGitHookByID(c.Param("hookId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Git hook not found"})
+		return
+	}
+	payload, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxGitPayloadSize))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Payload is too large"})
+		return
+	}
+	if !verifyGitSignature(hook, c.Request.Header, payload) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature"})
+		return
+	}
+
+	event, ok, err := parseGitEvent(hook.Provider, c.Request.Header, payload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"message": "Event ignored"})
+		return
+	}
+
+	project, err := getProjectByID(hook.ProjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load project"})
+		return
+	}
+	linked, closed, err := linkGitEvent(project, event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link commits"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Event processed successfully", "linked": linked, "closed": closed})
+}
+
+// verifyGitSignature checks the provider's proof that the payload was sent
+// by someone holding the hook's secret.
+func verifyGitSignature(hook GitHook, header http.Header, payload []byte) bool {
+	switch hook.Provider {
+	case "gitlab":
+		token := header.Get("X-Gitlab-Token")
+		return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(hook.Secret)) == 1
+	case "gitea":
+		return hmac.Equal([]byte(header.Get("X-Gitea-Signature")), []byte(gitHMAC(hook.Secret, payload)))
+	default:
+		return hmac.Equal([]byte(header.Get("X-Hub-Signature-256")), []byte("sha256="+gitHMAC(hook.Secret, payload)))
+	}
+}
+
+func gitHMAC(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// parseGitEvent reads a push or merged merge request from a provider's
+// payload. It returns false for any other kind of event.
+func parseGitEvent(provider string, header http.Header, payload []byte) (gitEvent, bool, error) {
+	type author struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+	type commit struct {
+		ID        string  `json:"id"`
+		Message   string  `json:"message"`
+		URL       string  `json:"url"`
+		Timestamp *string `json:"timestamp"`
+		Author    author  `json:"author"`
+	}
+
+	kind := header.Get("X-GitHub-Event")
+	switch provider {
+	case "gitlab":
+		kind = map[string]string{"Push Hook": "push", "Merge Request Hook": "merge_request"}[header.Get("X-Gitlab-Event")]
+	case "gitea":
+		kind = header.Get("X-Gitea-Event")
+	}
+
+	var event gitEvent
+	switch {
+	case kind == "push":
+		var body struct {
+			Ref        string   `json:"ref"`
+			Commits    []commit `json:"commits"`
+			Repository struct {
+				FullName      string `json:"full_name"`
+				DefaultBranch string `json:"default_branch"`
+			} `json:"repository"`
+			Project struct {
+				PathWithNamespace string `json:"path_with_namespace"`
+				DefaultBranch     string `json:"default_branch"`
+			} `json:"project"`
+		}
+		if err := json.Unmarshal(payload, &body); err != nil {
+			return event, false, err
+		}
+		if !strings.HasPrefix(body.Ref, "refs/heads/") {
+			return event, false, nil
+		}
+		event.Branch = strings.TrimPrefix(body.Ref, "refs/heads/")
+		event.Repository, event.DefaultBranch = body.Repository.FullName, body.Repository.DefaultBranch
+		if provider == "gitlab" {
+			event.Repository, event.DefaultBranch = body.Project.PathWithNamespace, body.Project.DefaultBranch
+		}
+		for _, cm := range body.Commits {
+			event.Commits = append(event.Commits, gitCommit{
+				SHA:         cm.ID,
+				Message:     cm.Message,
+				URL:         cm.URL,
+				AuthorName:  cm.Author.Name,
+				AuthorEmail: cm.Author.Email,
+				Timestamp:   nilIfEmpty(cm.Timestamp),
+			})
+		}
+		return event, true, nil
+
+	case provider == "gitlab" && kind == "merge_request":
+		var body struct {
+			User struct {
+				Name  string `json:"name"`
+				Email string `json:"email"`
+			} `json:"user"`
+			Project struct {
+				PathWithNamespace string `json:"path_with_namespace"`
+			} `json:"project"`
+			Attrs struct {
+				Action         string `json:"action"`
+				Title          string `json:"title"`
+				Description    string `json:"description"`
+				URL            string `json:"url"`
+				SourceBranch   string `json:"source_branch"`
+				MergeCommitSHA string `json:"merge_commit_sha"`
+			} `json:"object_attributes"`
+		}
+		if err := json.Unmarshal(payload, &body); err != nil {
+			return event, false, err
+		}
+		if body.Attrs.Action != "merge" || body.Attrs.MergeCommitSHA == "" {
+			return event, false, nil
+		}
+		event.Repository = body.Project.PathWithNamespace
+		event.Branch = body.Attrs.SourceBranch
+		event.Merged = true
+		event.Commits = []gitCommit{{
+			SHA:         body.Attrs.MergeCommitSHA,
+			Message:     strings.TrimSpace(body.Attrs.Title + "\n\n" + body.Attrs.Description),
+			URL:         body.Attrs.URL,
+			AuthorName:  body.User.Name,
+			AuthorEmail: body.User.Email,
+		}}
+		return event, true, nil
+
+	case provider != "gitlab" && kind == "pull_request":
+		var body struct {
+			Action      string `json:"action"`
+			PullRequest struct {
+				Title          string  `json:"title"`
+				Body           string  `json:"body"`
+				HTMLURL        string  `json:"html_url"`
+				Merged         bool    `json:"merged"`
+				MergeCommitSHA string  `json:"merge_commit_sha"`
+				MergedAt       *string `json:"merged_at"`
+				Head           struct {
+					Ref string `json:"ref"`
+				} `json:"head"`
+				User struct {
+					Login string `json:"login"`
+				} `json:"user"`
+			} `json:"pull_request"`
+			Repository struct {
+				FullName string `json:"full_name"`
+			} `json:"repository"`
+		}
+		if err := json.Unmarshal(payload, &body); err != nil {
+			return event, false, err
+		}
+		pr := body.PullRequest
+		if body.Action != "closed" || !pr.Merged || pr.MergeCommitSHA == "" {
+			return event, false, nil
+		}
+		event.Repository = body.Repository.FullName
+		event.Branch = pr.Head.Ref
+		event.Merged = true
+		event.Commits = []gitCommit{{
+			SHA:        pr.MergeCommitSHA,
+			Message:    strings.TrimSpace(pr.Title + "\n\n" + pr.Body),
+			URL:        pr.HTMLURL,
+			AuthorName: pr.User.Login,
+			Timestamp:  nilIfEmpty(pr.MergedAt),
+		}}
+		return event, true, nil
+	}
+	return event, false, nil
+}
+
+// parseIssueRefs returns the issue keys with the project's key that appear
+// in text, uppercased and in order of first appearance. A key counts as
+// closed if any mention of it follows a closing keyword.
+func parseIssueRefs(projectKey, text string) []issueRef {
+	index := map[string]int{}
+	var refs []issueRef
+	for _, match := range issueRefPattern.FindAllStringSubmatch(text, -1) {
+		key := strings.ToUpper(match[2])
+		if !strings.HasPrefix(key, projectKey+"-") {
+			continue
+		}
+		i, seen := index[key]
+		if !seen {
+			i = len(refs)
+			index[key] = i
+			refs = append(refs, issueRef{Key: key})
+		}
+		if match[1] != "" {
+			refs[i].Closes = true
+		}
+	}
+	return refs
+}
+
+// linkGitEvent records each commit against the project's issues it mentions,
+// in its message or in the branch name, and closes the issues named after a
+// closing keyword once the change lands: on a push to the default branch or
+// when a merge request is merged. It returns how many commit links were new
+// and how many issues were closed.
+func linkGitEvent(project Project, event gitEvent) (linked, closed int, err error) {
+	// A push whose payload does not name the default branch cannot be
+	// shown to have landed, so it links commits without closing issues
+	landed := event.Merged || (event.DefaultBranch != "" && event.Branch == event.DefaultBranch)
+	branchRefs := parseIssueRefs(project.Key, event.Branch)
+
+	err = withTx(func(tx *Tx) error {
+		for _, commit := range event.Commits {
+			if commit.SHA == "" {
+				continue
+			}
+			actorID, err := gitActorID(tx, project.ID, commit.AuthorEmail)
+			if err != nil {
+				return err
+			}
+			for _, ref := range append(parseIssueRefs(project.Key, commit.Message), branchRefs...) {
+				issueID, projectID, err := resolveIssueRef(ref.Key)
+				if err == sql.ErrNoRows {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				if projectID != project.ID {
+					continue
+				}
+
+				query := `
+				INSERT INTO issue_commits (issue_id, sha, repository, branch, message, url, author_name, author_email, committed_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+				ON CONFLICT DO NOTHING
+				`
+				result, err := tx.Exec(query, issueID, commit.SHA, event.Repository, event.Branch, commit.Message, commit.URL, commit.AuthorName, commit.AuthorEmail, commit.Timestamp)
+				if err != nil {
+					log.Printf("Database error linking commit: %v", err)
+					return err
+				}
+				if n, _ := result.RowsAffected(); n > 0 {
+					linked++
+					err := recordIssueEvent(tx, IssueEvent{
+						IssueID:   issueID,
+						ActorID:   nilIfEmpty(&actorID),
+						EventType: eventCommitLinked,
+						NewValue:  strPtr(commit.SHA),
+					})
+					if err != nil {
+						return err
+					}
+				}
+
+				if !ref.Closes || !landed {
+					continue
+				}
+				issue, err := scanIssue(tx.QueryRow(`SELECT `+issueColumns+` FROM issues WHERE id = $1 FOR UPDATE`, issueID))
+				if err != nil {
+					return err
+				}
+				ok, err := closeIssue(tx, issue, actorID)
+				if err != nil {
+					return err
+				}
+				if ok {
+					closed++
+				}
+			}
+		}
+		return nil
+	})
+	return linked, closed, err
+}
+
+// gitActorID finds the user a commit was written by, if their email belongs
+// to someone who can see the project. It returns "" otherwise.
+func gitActorID(tx *Tx, projectID, email string) (string, error) {
+	if email == "" {
+		return "", nil
+	}
+	query := `
+	SELECT u.id
+	FROM users u
+	WHERE LOWER(u.email) = LOWER($2)
+	AND ` + canViewProjectSQL("$1", "u.id", "u.role")
+	var userID string
+	err := tx.QueryRow(query, projectID, email).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return userID, err
+}
+
+// gitHookURL is the path a Git host should deliver a hook's events to.
+func gitHookURL(hookID string) string {
+	return "/api/v1/git-hooks/" + hookID
+}
+
+func getGitHookByID(hookID string) (GitHook, error) {
+	var hook GitHook
+	if _, err := uuid.Parse(hookID); err != nil {
+		return hook, sql.ErrNoRows
+	}
+	query := `SELECT id, project_id, provider, secret, created_by, created_at FROM git_hooks WHERE id = $1`
+	err := db.QueryRow(query, hookID).Scan(&hook.ID, &hook.ProjectID, &hook.Provider, &hook.Secret, &hook.CreatedBy, &hook.CreatedAt)
+	hook.URL = gitHookURL(hook.ID)
+	return hook, err
+}
+
+func getGitHooksByProject(projectID string) ([]GitHook, error) {
+	query := `SELECT id, project_id, provider, created_by, created_at FROM git_hooks WHERE project_id = $1 ORDER BY created_at`
+	rows, err := db.Query(query, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []GitHook
+	for rows.Next() {
+		var hook GitHook
+		if err := rows.Scan(&hook.ID, &hook.ProjectID, &hook.Provider, &hook.CreatedBy, &hook.CreatedAt); err != nil {
+			return nil, err
+		}
+		hook.URL = gitHookURL(hook.ID)
+		hooks = append(hooks, hook)
+	}
+	return hooks, rows.Err()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestResolveIssueRefOutOfRange(t *testing.T) {
+	// Rejected before reaching the database, where the number would not fit
+	// the integer column
+	for _, ref := range []string{"PROJ-2147483648", "PROJ-99999999999", "PROJ-99999999999999999999999"} {
+		if _, _, err := resolveIssueRef(ref); err != sql.ErrNoRows {
+			t.Errorf("resolveIssueRef(%q) error = %v, want sql.ErrNoRows", ref, err)
+		}
+	}
+}
+
+func TestVerifyGitSignature(t *testing.T) {
+	payload := []byte(`{"ref":"refs/heads/main"}`)
+	sign := func(secret string, payload []byte) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(payload)
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name     string
+		provider string
+		secret   string
+		header   string
+		value    string
+		want     bool
+	}{
+		{"github", "github", "s3cret", "X-Hub-Signature-256", "sha256=" + sign("s3cret", payload), true},
+		{"github without prefix", "github", "s3cret", "X-Hub-Signature-256", sign("s3cret", payload), false},
+		{"github wrong secret", "github", "s3cret", "X-Hub-Signature-256", "sha256=" + sign("other", payload), false},
+		{"github other payload", "github", "s3cret", "X-Hub-Signature-256", "sha256=" + sign("s3cret", []byte(`{}`)), false},
+		{"github missing", "github", "s3cret", "X-Gitea-Signature", sign("s3cret", payload), false},
+		{"gitea", "gitea", "s3cret", "X-Gitea-Signature", sign("s3cret", payload), true},
+		{"gitea with prefix", "gitea", "s3cret", "X-Gitea-Signature", "sha256=" + sign("s3cret", payload), false},
+		{"gitea wrong secret", "gitea", "s3cret", "X-Gitea-Signature", sign("other", payload), false},
+		{"gitea missing", "gitea", "s3cret", "X-Hub-Signature-256", "sha256=" + sign("s3cret", payload), false},
+		{"gitlab", "gitlab", "s3cret", "X-Gitlab-Token", "s3cret", true},
+		{"gitlab wrong token", "gitlab", "s3cret", "X-Gitlab-Token", "s3cre", false},
+		{"gitlab empty token", "gitlab", "", "X-Gitlab-Token", "", false},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		header.Set(tt.header, tt.value)
+		hook := GitHook{Provider: tt.provider, Secret: tt.secret}
+		if got := verifyGitSignature(hook, header, payload); got != tt.want {
+			t.Errorf("%s: verifyGitSignature = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseIssueRefs(t *testing.T) {
+	tests := []struct {
+		text string
+		want []issueRef
+	}{
+		{"fixes PROJ-12", []issueRef{{"PROJ-12", true}}},
+		{"Closes: proj-3", []issueRef{{"PROJ-3", true}}},
+		{"Resolved PROJ-4 after PROJ-5", []issueRef{{"PROJ-4", true}, {"PROJ-5", false}}},
+		{"feature/PROJ-7-login-page", []issueRef{{"PROJ-7", false}}},
+		{"Touch PROJ-8, then fix PROJ-8", []issueRef{{"PROJ-8", true}}},
+		{"fixes OTHER-5 and PROJX-6", nil},
+		{"refactor PROJ-0 and PROJ-", nil},
+	}
+	for _, tt := range tests {
+		if got := parseIssueRefs("PROJ", tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseIssueRefs(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParseGitEventMerged(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		header   string
+		kind     string
+		payload  string
+		ok       bool
+		merged   bool
+	}{
+		{
+			"github merged", "github", "X-GitHub-Event", "pull_request",
+			`{"action":"closed","pull_request":{"title":"Fix PROJ-1","merged":true,"merge_commit_sha":"abc","head":{"ref":"PROJ-1-login"}},"repository":{"full_name":"acme/app"}}`,
+			true, true,
+		},
+		{
+			"github closed unmerged", "github", "X-GitHub-Event", "pull_request",
+			`{"action":"closed","pull_request":{"merged":false,"merge_commit_sha":"abc"}}`,
+			false, false,
+		},
+		{
+			"github opened", "github", "X-GitHub-Event", "pull_request",
+			`{"action":"opened","pull_request":{"merged":false}}`,
+			false, false,
+		},
+		{
+			"gitea merged", "gitea", "X-Gitea-Event", "pull_request",
+			`{"action":"closed","pull_request":{"merged":true,"merge_commit_sha":"abc","head":{"ref":"PROJ-1-login"}},"repository":{"full_name":"acme/app"}}`,
+			true, true,
+		},
+		{
+			"gitlab merged", "gitlab", "X-Gitlab-Event", "Merge Request Hook",
+			`{"project":{"path_with_namespace":"acme/app"},"object_attributes":{"action":"merge","merge_commit_sha":"abc","source_branch":"PROJ-1-login"}}`,
+			true, true,
+		},
+		{
+			"gitlab closed", "gitlab", "X-Gitlab-Event", "Merge Request Hook",
+			`{"object_attributes":{"action":"close","merge_commit_sha":""}}`,
+			false, false,
+		},
+		{
+			"gitlab merge without commit", "gitlab", "X-Gitlab-Event", "Merge Request Hook",
+			`{"object_attributes":{"action":"merge"}}`,
+			false, false,
+		},
+		{
+			"github push", "github", "X-GitHub-Event", "push",
+			`{"ref":"refs/heads/main","commits":[{"id":"abc","message":"fix PROJ-1"}],"repository":{"full_name":"acme/app","default_branch":"main"}}`,
+			true, false,
+		},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		header.Set(tt.header, tt.kind)
+		event, ok, err := parseGitEvent(tt.provider, header, []byte(tt.payload))
+		if err != nil {
+			t.Errorf("%s: parseGitEvent: %v", tt.name, err)
+			continue
+		}
+		if ok != tt.ok || event.Merged != tt.merged {
+			t.Errorf("%s: parseGitEvent = ok %v, merged %v; want ok %v, merged %v", tt.name, ok, event.Merged, tt.ok, tt.merged)
+			continue
+		}
+		if tt.merged && (event.Repository != "acme/app" || event.Branch != "PROJ-1-login" || len(event.Commits) != 1 || event.Commits[0].SHA != "abc") {
+			t.Errorf("%s: parseGitEvent = %+v", tt.name, event)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"os"
@@ -11,6 +12,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -20,7 +22,6 @@ func registerHandler(c *gin.Context) {
 		Password  string `json:"password" binding:"required"`
 		FirstName string `json:"first_name" binding:"required"`
 		LastName  string `json:"last_name" binding:"required"`
-		Role      string `json:"role"`
 	}
 
 	if err := c.ShouldBindJSON(&registerData); err != nil {
@@ -28,17 +29,17 @@ func registerHandler(c *gin.Context) {
 		return
 	}
 
-	// Make the first registered user an admin
+	// Make the first registered user an admin. Everyone else starts as a
+	// user; only an admin can change that later
 	var userCount int
 	err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&userCount)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user count"})
 		return
 	}
+	role := "user"
 	if userCount == 0 {
-		registerData.Role = "admin"
-	} else if registerData.Role == "" {
-		registerData.Role = "user"
+		role = "admin"
 	}
 
 	// Hash password
@@ -55,7 +56,7 @@ func registerHandler(c *gin.Context) {
 		PasswordHash: string(hashedPassword),
 		FirstName:    registerData.FirstName,
 		LastName:     registerData.LastName,
-		Role:         registerData.Role,
+		Role:         role,
 		CreatedAt:    time.Now().Format(time.RFC3339),
 		UpdatedAt:    time.Now().Format(time.RFC3339),
 	}
@@ -104,16 +105,24 @@ func loginHandler(c *gin.Context) {
 		return
 	}
 
-	// Generate JWT token
-	token, err := generateJWT(user.ID)
+	// Start a session and issue its tokens
+	session, refreshToken, err := createSession(user.ID, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	token, err := generateJWT(user.ID, session.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"user":  user,
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int(accessTokenTTL.Seconds()),
+		"user":          user,
 	})
 }
 
@@ -128,10 +137,14 @@ func getUserByEmail(email string) (User, error) {
 	return user, err
 }
 
-func generateJWT(userID string) (string, error) {
+func generateJWT(userID, sessionID string) (string, error) {
+	now := time.Now()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"sub": userID,
-		"exp": time.Now().Add(time.Hour * 24).Unix(),
+		"sid": sessionID,
+		"jti": uuid.New().String(),
+		"iat": now.Unix(),
+		"exp": now.Add(accessTokenTTL).Unix(),
 	})
 	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
 }
@@ -177,11 +190,15 @@ func getProjectsHandler(c *gin.Context) {
 
 func countProjectsByUser(userID, search string) (int, error) {
 	var total int
-	query := `SELECT COUNT(*) FROM projects WHERE created_by = $1`
+	query := `
+	SELECT COUNT(*)
+	FROM projects p
+	JOIN project_members pm ON pm.project_id = p.id
+	WHERE pm.user_id = $1`
 	args := []interface{}{userID}
 	idx := 2
 	if search != "" {
-		query += ` AND (LOWER(name) LIKE $` + strconv.Itoa(idx) + ` OR LOWER(description) LIKE $` + strconv.Itoa(idx) + `)`
+		query += ` AND (LOWER(p.name) LIKE $` + strconv.Itoa(idx) + ` OR LOWER(p.description) LIKE $` + strconv.Itoa(idx) + `)`
 		searchTerm := "%" + search + "%"
 		args = append(args, strings.ToLower(searchTerm))
 		idx++
@@ -192,18 +209,19 @@ func countProjectsByUser(userID, search string) (int, error) {
 
 func getProjectsByUserPaginated(userID, search string, limit, offset int) ([]Project, error) {
 	query := `
-	SELECT id, name, description, created_by, created_at, updated_at
-	FROM projects
-	WHERE created_by = $1`
+	SELECT p.id, p.key, p.name, p.description, p.created_by, pm.role, p.prevent_close_with_open_blockers, p.parent_close_rule, p.created_at, p.updated_at
+	FROM projects p
+	JOIN project_members pm ON pm.project_id = p.id
+	WHERE pm.user_id = $1`
 	args := []interface{}{userID}
 	idx := 2
 	if search != "" {
-		query += ` AND (LOWER(name) LIKE $` + strconv.Itoa(idx) + ` OR LOWER(description) LIKE $` + strconv.Itoa(idx) + `)`
+		query += ` AND (LOWER(p.name) LIKE $` + strconv.Itoa(idx) + ` OR LOWER(p.description) LIKE $` + strconv.Itoa(idx) + `)`
 		searchTerm := "%" + search + "%"
 		args = append(args, strings.ToLower(searchTerm))
 		idx++
 	}
-	query += ` ORDER BY created_at DESC LIMIT $` + strconv.Itoa(idx) + ` OFFSET $` + strconv.Itoa(idx+1)
+	query += ` ORDER BY p.created_at DESC LIMIT $` + strconv.Itoa(idx) + ` OFFSET $` + strconv.Itoa(idx+1)
 	args = append(args, limit, offset)
 	rows, err := db.Query(query, args...)
 	if err != nil {
@@ -214,7 +232,7 @@ func getProjectsByUserPaginated(userID, search string, limit, offset int) ([]Pro
 	var projects []Project
 	for rows.Next() {
 		var project Project
-		err := rows.Scan(&project.ID, &project.Name, &project.Description, &project.CreatedBy, &project.CreatedAt, &project.UpdatedAt)
+		err := rows.Scan(&project.ID, &project.Key, &project.Name, &project.Description, &project.CreatedBy, &project.Role, &project.PreventCloseWithOpenBlockers, &project.ParentCloseRule, &project.CreatedAt, &project.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -231,12 +249,30 @@ func createProjectHandler(c *gin.Context) {
 		return
 	}
 
+	project.Key = strings.ToUpper(strings.TrimSpace(project.Key))
+	if project.Key != "" && !projectKeyPattern.MatchString(project.Key) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Key must be 2 to 10 letters and digits, starting with a letter"})
+		return
+	}
+	if project.ParentCloseRule == "" {
+		project.ParentCloseRule = parentCloseNone
+	}
+	if !parentCloseRules[project.ParentCloseRule] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Parent close rule must be one of none, block or auto_close"})
+		return
+	}
+
 	project.ID = uuid.New().String()
 	project.CreatedBy = c.GetString("user_id")
 	project.CreatedAt = time.Now().Format(time.RFC3339)
 	project.UpdatedAt = project.CreatedAt
 
-	if err := createProject(project); err != nil {
+	err := createProject(project)
+	if errors.Is(err, errProjectKeyTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A project with this key already exists"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create project"})
 		return
 	}
@@ -245,12 +281,27 @@ func createProjectHandler(c *gin.Context) {
 }
 
 func createProject(project Project) error {
-	query := `
-	INSERT INTO projects (id, name, description, created_by, created_at, updated_at)
-	VALUES ($1, $2, $3, $4, $5, $6)
-	`
-	_, err := db.Exec(query, project.ID, project.Name, project.Description, project.CreatedBy, project.CreatedAt, project.UpdatedAt)
-	return err
+	return withTx(func(tx *Tx) error {
+		var err error
+		if project.Key, err = allocateProjectKey(tx, project.Key, project.Name); err != nil {
+			return err
+		}
+
+		query := `
+		INSERT INTO projects (id, key, name, description, created_by, prevent_close_with_open_blockers, parent_close_rule, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`
+		if _, err := tx.Exec(query, project.ID, project.Key, project.Name, project.Description, project.CreatedBy, project.PreventCloseWithOpenBlockers, project.ParentCloseRule, project.CreatedAt, project.UpdatedAt); err != nil {
+			// Another project may have claimed the key since it was checked
+			if isUniqueViolation(err) {
+				return errProjectKeyTaken
+			}
+			return err
+		}
+
+		// The creator owns the new project
+		return addProjectMember(tx, project.ID, project.CreatedBy, "owner")
+	})
 }
 
 func getProjectHandler(c *gin.Context) {
@@ -260,17 +311,18 @@ func getProjectHandler(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
 		return
 	}
+	project.Role, _ = currentPrincipal(c).ProjectRole(projectID)
 	c.JSON(http.StatusOK, project)
 }
 
 func getProjectByID(projectID string) (Project, error) {
 	var project Project
 	query := `
-	SELECT id, name, description, created_by, created_at, updated_at
+	SELECT id, key, name, description, created_by, prevent_close_with_open_blockers, parent_close_rule, created_at, updated_at
 	FROM projects
 	WHERE id = $1
 	`
-	err := db.QueryRow(query, projectID).Scan(&project.ID, &project.Name, &project.Description, &project.CreatedBy, &project.CreatedAt, &project.UpdatedAt)
+	err := db.QueryRow(query, projectID).Scan(&project.ID, &project.Key, &project.Name, &project.Description, &project.CreatedBy, &project.PreventCloseWithOpenBlockers, &project.ParentCloseRule, &project.CreatedAt, &project.UpdatedAt)
 	return project, err
 }
 
@@ -282,14 +334,28 @@ func updateProjectHandler(c *gin.Context) {
 		return
 	}
 
+	key := project.Key
 	if err := c.ShouldBindJSON(&project); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Issue keys already handed out would stop resolving if this changed
+	if !strings.EqualFold(project.Key, key) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Project key cannot be changed"})
+		return
+	}
+	project.Key = key
+
+	if !parentCloseRules[project.ParentCloseRule] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Parent close rule must be one of none, block or auto_close"})
+		return
+	}
+
+	project.ID = projectID
 	project.UpdatedAt = time.Now().Format(time.RFC3339)
 
-	if err := updateProject(project); err != nil {
+	if err := updateProject(project, c.GetString("user_id")); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
 		return
 	}
@@ -297,14 +363,19 @@ func updateProjectHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Project updated successfully"})
 }
 
-func updateProject(project Project) error {
-	query := `
-	UPDATE projects
-	SET name = $1, description = $2, updated_at = $3
-	WHERE id = $4
-	`
-	_, err := db.Exec(query, project.Name, project.Description, project.UpdatedAt, project.ID)
-	return err
+func updateProject(project Project, updatedBy string) error {
+	return withTx(func(tx *Tx) error {
+		query := `
+		UPDATE projects
+		SET name = $1, description = $2, prevent_close_with_open_blockers = $3, parent_close_rule = $4, updated_at = $5
+		WHERE id = $6
+		`
+		if _, err := tx.Exec(query, project.Name, project.Description, project.PreventCloseWithOpenBlockers, project.ParentCloseRule, project.UpdatedAt, project.ID); err != nil {
+			return err
+		}
+		project.Role = ""
+		return enqueueWebhookEvent(tx, project.ID, updatedBy, "project.updated", gin.H{"project": project})
+	})
 }
 
 func deleteProjectHandler(c *gin.Context) {
@@ -317,36 +388,29 @@ func deleteProjectHandler(c *gin.Context) {
 }
 
 func deleteProject(projectID string) error {
-	query := `
-	DELETE FROM projects
-	WHERE id = $1
-	`
-	_, err := db.Exec(query, projectID)
-	return err
-}
-
-// RBAC middleware: only allow admins
-func adminOnly() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userID := c.GetString("user_id")
-		user, err := getUserByID(userID)
-		if err != nil || user.Role != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
-			c.Abort()
-			return
+	var blobs []string
+	err := withTx(func(tx *Tx) error {
+		var err error
+		if blobs, err = attachmentKeys(tx, "project_id", projectID); err != nil {
+			return err
 		}
-		c.Next()
+		query := `
+		DELETE FROM projects
+		WHERE id = $1
+		`
+		_, err = tx.Exec(query, projectID)
+		return err
+	})
+	if err == nil {
+		removeAttachmentBlobs(blobs)
 	}
+	return err
 }
 
 // Issues handlers
 func getIssuesHandler(c *gin.Context) {
 	userID := c.GetString("user_id")
 	projectID := c.Query("project_id")
-	status := c.Query("status")
-	priority := c.Query("priority")
-	assignedTo := c.Query("assigned_to")
-	search := c.Query("search")
 	limit := 10
 	offset := 0
 	if l := c.Query("limit"); l != "" {
@@ -360,20 +424,23 @@ func getIssuesHandler(c *gin.Context) {
 		}
 	}
 
-	var issues []Issue
-	var total int
-	var err error
-
+	filter, projectID, ok := issueFilterFromQuery(c, projectID)
+	if !ok {
+		return
+	}
 	if projectID != "" {
-		total, err = countIssuesByProjectFiltered(projectID, status, priority, assignedTo, search)
-		if err == nil {
-			issues, err = getIssuesByProjectPaginatedFiltered(projectID, status, priority, assignedTo, search, limit, offset)
+		if !authorize(c, projectID, "project:view") {
+			return
 		}
+		filter.ProjectID = projectID
 	} else {
-		total, err = countIssuesByUserFiltered(userID, status, priority, assignedTo, search)
-		if err == nil {
-			issues, err = getIssuesByUserPaginatedFiltered(userID, status, priority, assignedTo, search, limit, offset)
-		}
+		filter.MemberID = userID
+	}
+
+	total, err := countIssues(filter)
+	var issues []Issue
+	if err == nil {
+		issues, err = getIssuesPaginated(filter, limit, offset)
 	}
 
 	if err != nil {
@@ -392,162 +459,182 @@ func getIssuesHandler(c *gin.Context) {
 	})
 }
 
-func countIssuesByProjectFiltered(projectID, status, priority, assignedTo, search string) (int, error) {
-	query := `SELECT COUNT(*) FROM issues WHERE project_id = $1`
-	args := []interface{}{projectID}
-	idx := 2
-	if status != "" {
-		query += ` AND status = $` + strconv.Itoa(idx)
-		args = append(args, status)
-		idx++
+// issueFilterFromQuery builds an issue filter from the list query
+// parameters, writing the error response and returning false if they are
+// invalid. A saved filter's project is used when projectID is empty, and the
+// resolved project is returned.
+func issueFilterFromQuery(c *gin.Context, projectID string) (issueFilter, string, bool) {
+	userID := c.GetString("user_id")
+	filter := issueFilter{
+		Status:     c.Query("status"),
+		Priority:   c.Query("priority"),
+		AssignedTo: c.Query("assigned_to"),
+		Milestone:  c.Query("milestone"),
+		Sprint:     c.Query("sprint"),
+		Parent:     c.Query("parent"),
+		Search:     c.Query("search"),
+		LabelsAny:  labelNames(c.Query("labels_any")),
+		LabelsAll:  labelNames(c.Query("labels_all")),
+		LabelsNone: labelNames(c.Query("labels_none")),
+	}
+
+	// A saved filter supplies a stored query and project, which the request
+	// can narrow further
+	var queries []string
+	if filterID := c.Query("filter"); filterID != "" {
+		saved, ok := loadVisibleSavedFilter(c, filterID)
+		if !ok {
+			return filter, "", false
+		}
+		if projectID == "" && saved.ProjectID != nil {
+			projectID = *saved.ProjectID
+		}
+		queries = append(queries, saved.Query)
 	}
-	if priority != "" {
-		query += ` AND priority = $` + strconv.Itoa(idx)
-		args = append(args, priority)
-		idx++
+	queries = append(queries, c.Query("query"))
+	for _, q := range queries {
+		if q == "" {
+			continue
+		}
+		parsed, err := parseIssueQuery(q, userID, time.Now())
+		if err != nil {
+			writeQueryError(c, err)
+			return filter, "", false
+		}
+		filter.Queries = append(filter.Queries, parsed)
 	}
-	if assignedTo != "" {
-		query += ` AND assigned_to = $` + strconv.Itoa(idx)
-		args = append(args, assignedTo)
-		idx++
+	if filter.Milestone != "" && filter.Milestone != "none" {
+		if _, err := uuid.Parse(filter.Milestone); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Milestone must be a milestone ID or none"})
+			return filter, "", false
+		}
 	}
-	if search != "" {
-		query += ` AND (LOWER(title) LIKE $` + strconv.Itoa(idx) + ` OR LOWER(description) LIKE $` + strconv.Itoa(idx) + `)`
-		searchTerm := "%" + search + "%"
-		args = append(args, strings.ToLower(searchTerm))
-		idx++
+	if filter.Sprint != "" && filter.Sprint != "none" {
+		if _, err := uuid.Parse(filter.Sprint); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Sprint must be a sprint ID or none"})
+			return filter, "", false
+		}
 	}
-	var total int
-	if err := db.QueryRow(query, args...).Scan(&total); err != nil {
-		return 0, err
+	if filter.Parent != "" && filter.Parent != "none" {
+		if _, err := uuid.Parse(filter.Parent); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parent must be an issue ID or none"})
+			return filter, "", false
+		}
 	}
-	return total, nil
+	return filter, projectID, true
 }
 
-func getIssuesByProjectPaginatedFiltered(projectID, status, priority, assignedTo, search string, limit, offset int) ([]Issue, error) {
-	query := `
-	SELECT id, title, description, status, priority, project_id, created_by, assigned_to, created_at, updated_at
-	FROM issues
-	WHERE project_id = $1`
-	args := []interface{}{projectID}
-	idx := 2
-	if status != "" {
-		query += ` AND status = $` + strconv.Itoa(idx)
-		args = append(args, status)
-		idx++
+// issueFilter selects the issues shown in the issue list. Either ProjectID or
+// MemberID scopes the list; the remaining fields narrow it further.
+type issueFilter struct {
+	ProjectID  string
+	MemberID   string
+	Status     string
+	Priority   string
+	AssignedTo string
+	Milestone  string
+	Sprint     string
+	Parent     string
+	Search     string
+	LabelsAny  []string
+	LabelsAll  []string
+	LabelsNone []string
+	Queries    []*issueQuery
+	// ExcludeStatuses leaves out issues in any of these statuses
+	ExcludeStatuses []string
+}
+
+// whereSQL renders the filter as a WHERE clause, adding its arguments to b.
+func (f issueFilter) whereSQL(b *sqlBuilder) string {
+	var conds []string
+	if f.ProjectID != "" {
+		conds = append(conds, `project_id = `+b.arg(f.ProjectID))
 	}
-	if priority != "" {
-		query += ` AND priority = $` + strconv.Itoa(idx)
-		args = append(args, priority)
-		idx++
+	if f.MemberID != "" {
+		conds = append(conds, `project_id IN (SELECT project_id FROM project_members WHERE user_id = `+b.arg(f.MemberID)+`)`)
 	}
-	if assignedTo != "" {
-		query += ` AND assigned_to = $` + strconv.Itoa(idx)
-		args = append(args, assignedTo)
-		idx++
+	if f.Status != "" {
+		conds = append(conds, `status = `+b.arg(f.Status))
 	}
-	if search != "" {
-		query += ` AND (LOWER(title) LIKE $` + strconv.Itoa(idx) + ` OR LOWER(description) LIKE $` + strconv.Itoa(idx) + `)`
-		searchTerm := "%" + search + "%"
-		args = append(args, strings.ToLower(searchTerm))
-		idx++
+	if f.Priority != "" {
+		conds = append(conds, `priority = `+b.arg(f.Priority))
 	}
-	query += ` ORDER BY created_at DESC LIMIT $` + strconv.Itoa(idx) + ` OFFSET $` + strconv.Itoa(idx+1)
-	args = append(args, limit, offset)
-	rows, err := db.Query(query, args...)
-	if err != nil {
-		return nil, err
+	if f.AssignedTo != "" {
+		conds = append(conds, `assigned_to = `+b.arg(f.AssignedTo))
 	}
-	defer rows.Close()
-	var issues []Issue
-	for rows.Next() {
-		var issue Issue
-		err := rows.Scan(&issue.ID, &issue.Title, &issue.Description, &issue.Status, &issue.Priority, &issue.ProjectID, &issue.CreatedBy, &issue.AssignedTo, &issue.CreatedAt, &issue.UpdatedAt)
-		if err != nil {
-			return nil, err
-		}
-		issues = append(issues, issue)
+	if f.Milestone == "none" {
+		conds = append(conds, `milestone_id IS NULL`)
+	} else if f.Milestone != "" {
+		conds = append(conds, `milestone_id = `+b.arg(f.Milestone))
 	}
-	return issues, nil
-}
-
-func countIssuesByUserFiltered(userID, status, priority, assignedTo, search string) (int, error) {
-	query := `SELECT COUNT(*) FROM issues WHERE created_by = $1`
-	args := []interface{}{userID}
-	idx := 2
-	if status != "" {
-		query += ` AND status = $` + strconv.Itoa(idx)
-		args = append(args, status)
-		idx++
+	if f.Sprint == "none" {
+		conds = append(conds, `sprint_id IS NULL`)
+	} else if f.Sprint != "" {
+		conds = append(conds, `sprint_id = `+b.arg(f.Sprint))
 	}
-	if priority != "" {
-		query += ` AND priority = $` + strconv.Itoa(idx)
-		args = append(args, priority)
-		idx++
+	if f.Parent == "none" {
+		conds = append(conds, `parent_id IS NULL`)
+	} else if f.Parent != "" {
+		conds = append(conds, `parent_id = `+b.arg(f.Parent))
 	}
-	if assignedTo != "" {
-		query += ` AND assigned_to = $` + strconv.Itoa(idx)
-		args = append(args, assignedTo)
-		idx++
+	if len(f.ExcludeStatuses) > 0 {
+		conds = append(conds, `NOT (status = ANY(`+b.arg(pq.Array(f.ExcludeStatuses))+`))`)
 	}
-	if search != "" {
-		query += ` AND (LOWER(title) LIKE $` + strconv.Itoa(idx) + ` OR LOWER(description) LIKE $` + strconv.Itoa(idx) + `)`
-		searchTerm := "%" + search + "%"
-		args = append(args, strings.ToLower(searchTerm))
-		idx++
+	if tsQuery := buildTSQuery(f.Search); tsQuery != "" {
+		conds = append(conds, `search_vector @@ to_tsquery('english', `+b.arg(tsQuery)+`)`)
+	}
+	conds = append(conds, labelFilterSQL(b, f.LabelsAny, f.LabelsAll, f.LabelsNone)...)
+	for _, q := range f.Queries {
+		if q.where != nil {
+			conds = append(conds, q.where.sql(b))
+		}
 	}
+	if len(conds) == 0 {
+		return ""
+	}
+	return ` WHERE ` + strings.Join(conds, ` AND `)
+}
+
+// orderSQL renders the filter's sort order. The last query with an ORDER BY
+// decides it, otherwise the newest issues come first.
+func (f issueFilter) orderSQL() string {
+	order := `created_at DESC`
+	for _, q := range f.Queries {
+		if o := q.orderSQL(); o != "" {
+			order = o
+		}
+	}
+	return order
+}
+
+func countIssues(filter issueFilter) (int, error) {
+	b := &sqlBuilder{}
+	query := `SELECT COUNT(*) FROM issues` + filter.whereSQL(b)
 	var total int
-	if err := db.QueryRow(query, args...).Scan(&total); err != nil {
+	if err := db.QueryRow(query, b.args...).Scan(&total); err != nil {
 		return 0, err
 	}
 	return total, nil
 }
 
-func getIssuesByUserPaginatedFiltered(userID, status, priority, assignedTo, search string, limit, offset int) ([]Issue, error) {
-	query := `
-	SELECT id, title, description, project_id, created_by, created_at, updated_at
-	FROM issues
-	WHERE created_by = $1`
-	args := []interface{}{userID}
-	idx := 2
-	if status != "" {
-		query += ` AND status = $` + strconv.Itoa(idx)
-		args = append(args, status)
-		idx++
-	}
-	if priority != "" {
-		query += ` AND priority = $` + strconv.Itoa(idx)
-		args = append(args, priority)
-		idx++
-	}
-	if assignedTo != "" {
-		query += ` AND assigned_to = $` + strconv.Itoa(idx)
-		args = append(args, assignedTo)
-		idx++
-	}
-	if search != "" {
-		query += ` AND (LOWER(title) LIKE $` + strconv.Itoa(idx) + ` OR LOWER(description) LIKE $` + strconv.Itoa(idx) + `)`
-		searchTerm := "%" + search + "%"
-		args = append(args, strings.ToLower(searchTerm))
-		idx++
-	}
-	query += ` ORDER BY created_at DESC LIMIT $` + strconv.Itoa(idx) + ` OFFSET $` + strconv.Itoa(idx+1)
-	args = append(args, limit, offset)
-	rows, err := db.Query(query, args...)
+func getIssuesPaginated(filter issueFilter, limit, offset int) ([]Issue, error) {
+	b := &sqlBuilder{}
+	query := `SELECT ` + issueColumns + ` FROM issues` + filter.whereSQL(b)
+	query += ` ORDER BY ` + filter.orderSQL() + ` LIMIT ` + b.arg(limit) + ` OFFSET ` + b.arg(offset)
+	rows, err := db.Query(query, b.args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var issues []Issue
 	for rows.Next() {
-		var issue Issue
-		err := rows.Scan(&issue.ID, &issue.Title, &issue.Description, &issue.ProjectID, &issue.CreatedBy, &issue.CreatedAt, &issue.UpdatedAt)
+		issue, err := scanIssue(rows)
 		if err != nil {
 			return nil, err
 		}
 		issues = append(issues, issue)
 	}
-	return issues, nil
+	return issues, attachIssueLabels(db, issues)
 }
 
 func createIssueHandler(c *gin.Context) {
@@ -558,12 +645,69 @@ func createIssueHandler(c *gin.Context) {
 		return
 	}
 
+	if issue.ProjectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id is required"})
+		return
+	}
+	if _, err := getProjectByID(issue.ProjectID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+	if !authorize(c, issue.ProjectID, "issue:create") {
+		return
+	}
+
+	// New issues start in the workflow's initial status unless told otherwise
+	workflow, err := getProjectWorkflow(issue.ProjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load workflow"})
+		return
+	}
+	if issue.Status == "" {
+		issue.Status = workflow.InitialStatus()
+	} else if _, ok := workflow.Status(issue.Status); !ok {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Unknown status: " + issue.Status})
+		return
+	}
+	if !workflow.IsDone(issue.Status) {
+		issue.Resolution = nil
+	}
+	issue.AssignedTo = normalizeAssignee(issue.AssignedTo)
+
+	// Starting anywhere else counts as a transition out of the initial
+	// status, so its rules and required fields still apply
+	if issue.Status != workflow.InitialStatus() {
+		if err := workflow.CheckTransition(workflow.InitialStatus(), issue); err != nil {
+			writeTransitionError(c, err)
+			return
+		}
+	}
+
+	if issue.AssignedTo != nil {
+		if !authorize(c, issue.ProjectID, "issue:assign") {
+			return
+		}
+		if err := validateAssignee(issue.ProjectID, issue.AssignedTo); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Assignee must be a member of the project"})
+			return
+		}
+	}
+	issue.MilestoneID = nilIfEmpty(issue.MilestoneID)
+	if !checkIssueMilestone(c, issue.ProjectID, issue.MilestoneID) {
+		return
+	}
+	issue.ParentID = nilIfEmpty(issue.ParentID)
+
 	issue.ID = uuid.New().String()
 	issue.CreatedBy = c.GetString("user_id")
 	issue.CreatedAt = time.Now().Format(time.RFC3339)
 	issue.UpdatedAt = issue.CreatedAt
 
-	if err := createIssue(issue); err != nil {
+	err = createIssue(issue)
+	if writeParentError(c, err) {
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create issue"})
 		return
 	}
@@ -580,15 +724,51 @@ func createIssue(issue Issue) error {
 		issue.Priority = "medium"
 	}
 
-	query := `
-	INSERT INTO issues (id, title, description, status, priority, project_id, created_by, created_at, updated_at)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-	`
-	_, err := db.Exec(query, issue.ID, issue.Title, issue.Description, issue.Status, issue.Priority, issue.ProjectID, issue.CreatedBy, issue.CreatedAt, issue.UpdatedAt)
-	if err != nil {
-		log.Printf("Database error creating issue: %v", err)
-	}
-	return err
+	return withTx(func(tx *Tx) error {
+		if issue.ParentID != nil {
+			if err := lockProject(tx, issue.ProjectID); err != nil {
+				return err
+			}
+			if err := validateIssueParent(tx, issue.ProjectID, "", issue.ParentID); err != nil {
+				return err
+			}
+		}
+
+		number, err := nextIssueNumber(tx, issue.ProjectID)
+		if err != nil {
+			return err
+		}
+		query := `
+		INSERT INTO issues (id, number, title, description, status, priority, resolution, project_id, created_by, assigned_to, milestone_id, parent_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		`
+		_, err = tx.Exec(query, issue.ID, number, issue.Title, issue.Description, issue.Status, issue.Priority, issue.Resolution, issue.ProjectID, issue.CreatedBy, issue.AssignedTo, issue.MilestoneID, issue.ParentID, issue.CreatedAt, issue.UpdatedAt)
+		if err != nil {
+			log.Printf("Database error creating issue: %v", err)
+			return err
+		}
+
+		err = recordIssueEvent(tx, IssueEvent{
+			IssueID:   issue.ID,
+			ActorID:   strPtr(issue.CreatedBy),
+			EventType: eventIssueCreated,
+			NewValue:  strPtr(issue.Title),
+			CreatedAt: issue.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+		if err := addIssueWatcher(tx, issue.ID, issue.CreatedBy); err != nil {
+			return err
+		}
+
+		if issue.AssignedTo != nil {
+			if err := recordAssignment(tx, issue.ID, nil, issue.AssignedTo, issue.CreatedBy); err != nil {
+				return err
+			}
+		}
+		return emitIssueWebhook(tx, issue.ID, issue.CreatedBy, "issue.created", nil)
+	})
 }
 
 func getIssueHandler(c *gin.Context) {
@@ -598,36 +778,129 @@ func getIssueHandler(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Issue not found"})
 		return
 	}
-	c.JSON(http.StatusOK, issue)
+	issues := []Issue{issue}
+	if err := attachChildProgress(issue.ProjectID, issues); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch child issues"})
+		return
+	}
+	c.JSON(http.StatusOK, issues[0])
 }
 
-func getIssueByID(issueID string) (Issue, error) {
+// issueColumns lists the issue columns read by scanIssue, in order.
+const issueColumns = `id, (SELECT key FROM projects WHERE projects.id = issues.project_id), number, title, description, status, priority, resolution, project_id, created_by, assigned_to, milestone_id, sprint_id, parent_id, created_at, updated_at`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanIssue(row rowScanner) (Issue, error) {
 	var issue Issue
-	query := `
-	SELECT id, title, description, status, priority, project_id, created_by, assigned_to, created_at, updated_at
-	FROM issues
-	WHERE id = $1
-	`
-	err := db.QueryRow(query, issueID).Scan(&issue.ID, &issue.Title, &issue.Description, &issue.Status, &issue.Priority, &issue.ProjectID, &issue.CreatedBy, &issue.AssignedTo, &issue.CreatedAt, &issue.UpdatedAt)
+	var projectKey string
+	err := row.Scan(&issue.ID, &projectKey, &issue.Number, &issue.Title, &issue.Description, &issue.Status, &issue.Priority, &issue.Resolution, &issue.ProjectID, &issue.CreatedBy, &issue.AssignedTo, &issue.MilestoneID, &issue.SprintID, &issue.ParentID, &issue.CreatedAt, &issue.UpdatedAt)
+	issue.Key = issueKey(projectKey, issue.Number)
 	return issue, err
 }
 
-func updateIssueHandler(c *gin.Context) {
-	issueID := c.Param("id")
-	issue, err := getIssueByID(issueID)
+func getIssueByID(issueID string) (Issue, error) {
+	query := `SELECT ` + issueColumns + ` FROM issues WHERE id = $1`
+	issue, err := scanIssue(db.QueryRow(query, issueID))
+	if err != nil {
+		return issue, err
+	}
+	issues := []Issue{issue}
+	err = attachIssueLabels(db, issues)
+	return issues[0], err
+}
+
+// loadEditableIssue loads the issue named by the :id parameter and checks
+// that the caller may edit it. It writes the error response and returns
+// false otherwise.
+func loadEditableIssue(c *gin.Context) (Issue, bool) {
+	issue, err := getIssueByID(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Issue not found"})
+		return issue, false
+	}
+
+	// Reporters may be allowed to edit only the issues they created
+	perm := "issue:update"
+	if issue.CreatedBy == c.GetString("user_id") {
+		if ok, _ := currentPrincipal(c).Can(issue.ProjectID, "issue:update_own"); ok {
+			perm = "issue:update_own"
+		}
+	}
+	return issue, authorize(c, issue.ProjectID, perm)
+}
+
+func updateIssueHandler(c *gin.Context) {
+	issue, ok := loadEditableIssue(c)
+	if !ok {
 		return
 	}
 
+	previous := issue
 	if err := c.ShouldBindJSON(&issue); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// The body cannot move the issue or change who reported it
+	issue.ID = previous.ID
+	issue.Key = previous.Key
+	issue.Number = previous.Number
+	issue.ProjectID = previous.ProjectID
+	issue.SprintID = previous.SprintID
+	issue.CreatedBy = previous.CreatedBy
+	issue.CreatedAt = previous.CreatedAt
+
+	issue.AssignedTo = normalizeAssignee(issue.AssignedTo)
+	if !sameStringPtr(previous.AssignedTo, issue.AssignedTo) {
+		if !authorize(c, previous.ProjectID, "issue:assign") {
+			return
+		}
+		if err := validateAssignee(previous.ProjectID, issue.AssignedTo); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Assignee must be a member of the project"})
+			return
+		}
+	}
+	issue.MilestoneID = nilIfEmpty(issue.MilestoneID)
+	if !sameStringPtr(previous.MilestoneID, issue.MilestoneID) && !checkIssueMilestone(c, previous.ProjectID, issue.MilestoneID) {
+		return
+	}
+	issue.ParentID = nilIfEmpty(issue.ParentID)
+
+	workflow, err := getProjectWorkflow(previous.ProjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load workflow"})
+		return
+	}
+	if issue.Status != previous.Status {
+		if err := workflow.CheckTransition(previous.Status, issue); err != nil {
+			writeTransitionError(c, err)
+			return
+		}
+		if workflow.IsDone(issue.Status) && !workflow.IsDone(previous.Status) {
+			if !checkOpenBlockers(c, previous) || !checkOpenChildren(c, previous, workflow) {
+				return
+			}
+		}
+	}
+	if !workflow.IsDone(issue.Status) {
+		issue.Resolution = nil
+	}
 
 	issue.UpdatedAt = time.Now().Format(time.RFC3339)
 
-	if err := updateIssue(issue); err != nil {
+	err = updateIssue(issue, previous, c.GetString("user_id"))
+	if writeParentError(c, err) {
+		return
+	}
+	var transitionErr *transitionError
+	if errors.As(err, &transitionErr) {
+		writeTransitionError(c, transitionErr)
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update issue"})
 		return
 	}
@@ -635,31 +908,135 @@ func updateIssueHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Issue updated successfully"})
 }
 
-func updateIssue(issue Issue) error {
-	query := `
-	UPDATE issues
-	SET title = $1, description = $2, status = $3, priority = $4, updated_at = $5
-	WHERE id = $6
-	`
-	_, err := db.Exec(query, issue.Title, issue.Description, issue.Status, issue.Priority, issue.UpdatedAt, issue.ID)
-	return err
+func updateIssue(issue, previous Issue, changedBy string) error {
+	return withTx(func(tx *Tx) error {
+		parentChanged := !sameStringPtr(previous.ParentID, issue.ParentID)
+		statusChanged := issue.Status != previous.Status
+		if parentChanged || statusChanged {
+			if err := lockProject(tx, issue.ProjectID); err != nil {
+				return err
+			}
+		}
+		if parentChanged {
+			if err := validateIssueParent(tx, issue.ProjectID, issue.ID, issue.ParentID); err != nil {
+				return err
+			}
+		}
+		if statusChanged {
+			// Check the move again now that the workflow cannot change
+			// until this transaction ends
+			workflow, err := getProjectWorkflow(issue.ProjectID)
+			if err != nil {
+				return err
+			}
+			if err := workflow.CheckTransition(previous.Status, issue); err != nil {
+				return err
+			}
+		}
+
+		query := `
+		UPDATE issues
+		SET title = $1, description = $2, status = $3, priority = $4, resolution = $5, milestone_id = $6, parent_id = $7, updated_at = $8
+		WHERE id = $9
+		`
+		if _, err := tx.Exec(query, issue.Title, issue.Description, issue.Status, issue.Priority, issue.Resolution, issue.MilestoneID, issue.ParentID, issue.UpdatedAt, issue.ID); err != nil {
+			return err
+		}
+		changed, err := recordIssueChanges(tx, previous, issue, changedBy)
+		if err != nil {
+			return err
+		}
+
+		if !sameStringPtr(previous.AssignedTo, issue.AssignedTo) {
+			if err := setIssueAssignee(tx, issue.ID, previous.AssignedTo, issue.AssignedTo, changedBy); err != nil {
+				return err
+			}
+		}
+
+		var fields []string
+		for _, field := range changed {
+			if field == "status" {
+				if err := announceTransition(tx, issue.ID, previous.Status, issue.Status, changedBy); err != nil {
+					return err
+				}
+				continue
+			}
+			fields = append(fields, field)
+		}
+		if len(fields) > 0 {
+			if err := emitIssueWebhook(tx, issue.ID, changedBy, "issue.updated", gin.H{"changes": fields}); err != nil {
+				return err
+			}
+		}
+		if statusChanged {
+			return closeFinishedParents(tx, issue.ParentID, changedBy)
+		}
+		return nil
+	})
+}
+
+// announceTransition sends the webhook and watcher notifications for an
+// issue that has moved between statuses.
+func announceTransition(tx *Tx, issueID, from, to, actorID string) error {
+	err := emitIssueWebhook(tx, issueID, actorID, "issue.transitioned", gin.H{"from": from, "to": to})
+	if err != nil {
+		return err
+	}
+	return notifyIssueWatchers(tx, issueNotification{
+		Reason:    notifyStatusChanged,
+		IssueID:   issueID,
+		ActorID:   actorID,
+		OldStatus: from,
+		NewStatus: to,
+	})
 }
 
 func deleteIssueHandler(c *gin.Context) {
 	issueID := c.Param("id")
-	if err := deleteIssue(issueID); err != nil {
+	issue, err := getIssueByID(issueID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Issue not found"})
+		return
+	}
+
+	perm := "issue:delete"
+	if issue.CreatedBy == c.GetString("user_id") {
+		if ok, _ := currentPrincipal(c).Can(issue.ProjectID, "issue:delete_own"); ok {
+			perm = "issue:delete_own"
+		}
+	}
+	if !authorize(c, issue.ProjectID, perm) {
+		return
+	}
+
+	if err := deleteIssue(issueID, c.GetString("user_id")); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete issue"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Issue deleted successfully"})
 }
 
-func deleteIssue(issueID string) error {
-	query := `
-	DELETE FROM issues
-	WHERE id = $1
-	`
-	_, err := db.Exec(query, issueID)
+func deleteIssue(issueID, deletedBy string) error {
+	var blobs []string
+	err := withTx(func(tx *Tx) error {
+		// Queue the event first, while the issue can still be read
+		if err := emitIssueWebhook(tx, issueID, deletedBy, "issue.deleted", nil); err != nil {
+			return err
+		}
+		var err error
+		if blobs, err = attachmentKeys(tx, "issue_id", issueID); err != nil {
+			return err
+		}
+		query := `
+		DELETE FROM issues
+		WHERE id = $1
+		`
+		_, err = tx.Exec(query, issueID)
+		return err
+	})
+	if err == nil {
+		removeAttachmentBlobs(blobs)
+	}
 	return err
 }
 
@@ -670,29 +1047,61 @@ func createCommentHandler(c *gin.Context) {
 		return
 	}
 
+	issue, err := getIssueByID(comment.IssueID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Issue not found"})
+		return
+	}
+	if !authorize(c, issue.ProjectID, "comment:create") {
+		return
+	}
+
 	comment.ID = uuid.New().String()
 	comment.CreatedBy = c.GetString("user_id")
 	comment.CreatedAt = time.Now().Format(time.RFC3339)
 	comment.UpdatedAt = comment.CreatedAt
 
-	if err := createComment(comment); err != nil {
+	if err := createComment(&comment); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Comment created successfully"})
+	c.JSON(http.StatusCreated, gin.H{"message": "Comment created successfully", "comment": comment})
 }
 
-func createComment(comment Comment) error {
-	query := `
-	INSERT INTO comments (id, issue_id, content, created_by, created_at, updated_at)
-	VALUES ($1, $2, $3, $4, $5, $6)
-	`
-	_, err := db.Exec(query, comment.ID, comment.IssueID, comment.Content, comment.CreatedBy, comment.CreatedAt, comment.UpdatedAt)
-	if err != nil {
-		log.Printf("Database error creating comment: %v", err)
-	}
-	return err
+func createComment(comment *Comment) error {
+	return withTx(func(tx *Tx) error {
+		query := `
+		INSERT INTO comments (id, issue_id, content, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		`
+		_, err := tx.Exec(query, comment.ID, comment.IssueID, comment.Content, comment.CreatedBy, comment.CreatedAt, comment.UpdatedAt)
+		if err != nil {
+			log.Printf("Database error creating comment: %v", err)
+			return err
+		}
+		err = recordIssueEvent(tx, IssueEvent{
+			IssueID:   comment.IssueID,
+			ActorID:   strPtr(comment.CreatedBy),
+			EventType: eventCommentAdded,
+			CommentID: strPtr(comment.ID),
+			CreatedAt: comment.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+		mentioned, err := setCommentMentions(tx, comment)
+		if err != nil {
+			return err
+		}
+		if err := notifyComment(tx, *comment, mentioned, comment.CreatedBy); err != nil {
+			return err
+		}
+		if err := addIssueWatcher(tx, comment.IssueID, comment.CreatedBy); err != nil {
+			return err
+		}
+		return emitCommentWebhook(tx, *comment, comment.CreatedBy, "comment.created")
+	})
 }
 
 func authMiddleware() gin.HandlerFunc {
@@ -715,7 +1124,7 @@ func authMiddleware() gin.HandlerFunc {
 
 		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
+		}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 
 		if err != nil || !token.Valid {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
@@ -723,12 +1132,46 @@ func authMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Extract user ID from token
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			userID := claims["sub"].(string)
-			c.Set("user_id", userID)
+		// Extract user and session IDs from token
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
+		}
+		userID, _ := claims["sub"].(string)
+		sessionID, _ := claims["sid"].(string)
+		if userID == "" || sessionID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
+		}
+
+		// Reject tokens whose session was logged out or revoked
+		active, err := isSessionActive(sessionID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify session"})
+			c.Abort()
+			return
+		}
+		if !active {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+			c.Abort()
+			return
+		}
+
+		// Load the user once so handlers can use the cached principal
+		user, err := getUserByID(userID)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.Abort()
+			return
 		}
 
+		c.Set("user_id", userID)
+		c.Set("session_id", sessionID)
+		c.Set("principal", newPrincipal(user, sessionID))
+
 		c.Next()
 	}
 }
@@ -799,7 +1242,7 @@ func getCommentsByIssuePaginated(issueID string, limit, offset int) ([]Comment,
 		}
 		comments = append(comments, comment)
 	}
-	return comments, nil
+	return comments, attachCommentMentions(comments)
 }
 
 func updateCommentHandler(c *gin.Context) {
@@ -813,9 +1256,12 @@ func updateCommentHandler(c *gin.Context) {
 		return
 	}
 
-	// Check if the current user is the creator of the comment
-	if comment.CreatedBy != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You can only update your own comments"})
+	// Authors may edit their own comments, moderators may edit any
+	perm := "comment:moderate"
+	if comment.CreatedBy == userID {
+		perm = "comment:create"
+	}
+	if !authorize(c, c.GetString("project_id"), perm) {
 		return
 	}
 
@@ -829,15 +1275,16 @@ func updateCommentHandler(c *gin.Context) {
 	}
 
 	// Update the comment
+	previousContent := comment.Content
 	comment.Content = updateData.Content
 	comment.UpdatedAt = time.Now().Format(time.RFC3339)
 
-	if err := updateComment(comment); err != nil {
+	if err := updateComment(&comment, previousContent, userID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Comment updated successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Comment updated successfully", "comment": comment})
 }
 
 func getCommentByID(commentID string) (Comment, error) {
@@ -848,20 +1295,46 @@ func getCommentByID(commentID string) (Comment, error) {
 	WHERE id = $1
 	`
 	err := db.QueryRow(query, commentID).Scan(&comment.ID, &comment.IssueID, &comment.CreatedBy, &comment.Content, &comment.CreatedAt, &comment.UpdatedAt)
-	return comment, err
-}
-
-func updateComment(comment Comment) error {
-	query := `
-	UPDATE comments
-	SET content = $1, updated_at = $2
-	WHERE id = $3
-	`
-	_, err := db.Exec(query, comment.Content, comment.UpdatedAt, comment.ID)
 	if err != nil {
-		log.Printf("Database error updating comment: %v", err)
+		return comment, err
 	}
-	return err
+	comments := []Comment{comment}
+	err = attachCommentMentions(comments)
+	return comments[0], err
+}
+
+func updateComment(comment *Comment, previousContent, editedBy string) error {
+	return withTx(func(tx *Tx) error {
+		query := `
+		UPDATE comments
+		SET content = $1, updated_at = $2
+		WHERE id = $3
+		`
+		_, err := tx.Exec(query, comment.Content, comment.UpdatedAt, comment.ID)
+		if err != nil {
+			log.Printf("Database error updating comment: %v", err)
+			return err
+		}
+		err = recordIssueEvent(tx, IssueEvent{
+			IssueID:   comment.IssueID,
+			ActorID:   strPtr(editedBy),
+			EventType: eventCommentEdited,
+			OldValue:  strPtr(previousContent),
+			NewValue:  strPtr(comment.Content),
+			CommentID: strPtr(comment.ID),
+		})
+		if err != nil {
+			return err
+		}
+		mentioned, err := setCommentMentions(tx, comment)
+		if err != nil {
+			return err
+		}
+		if err := notifyMentions(tx, *comment, mentioned, editedBy); err != nil {
+			return err
+		}
+		return emitCommentWebhook(tx, *comment, editedBy, "comment.updated")
+	})
 }
 
 func deleteCommentHandler(c *gin.Context) {
@@ -875,14 +1348,17 @@ func deleteCommentHandler(c *gin.Context) {
 		return
 	}
 
-	// Check if the current user is the creator of the comment
-	if comment.CreatedBy != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You can only delete your own comments"})
+	// Authors may delete their own comments, moderators may delete any
+	perm := "comment:moderate"
+	if comment.CreatedBy == userID {
+		perm = "comment:create"
+	}
+	if !authorize(c, c.GetString("project_id"), perm) {
 		return
 	}
 
 	// Delete the comment
-	if err := deleteComment(commentID); err != nil {
+	if err := deleteComment(comment, userID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
 		return
 	}
@@ -890,14 +1366,36 @@ func deleteCommentHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted successfully"})
 }
 
-func deleteComment(commentID string) error {
-	query := `
-	DELETE FROM comments
-	WHERE id = $1
-	`
-	_, err := db.Exec(query, commentID)
-	if err != nil {
-		log.Printf("Database error deleting comment: %v", err)
+func deleteComment(comment Comment, deletedBy string) error {
+	var blobs []string
+	err := withTx(func(tx *Tx) error {
+		var err error
+		if blobs, err = attachmentKeys(tx, "comment_id", comment.ID); err != nil {
+			return err
+		}
+		query := `
+		DELETE FROM comments
+		WHERE id = $1
+		`
+		_, err = tx.Exec(query, comment.ID)
+		if err != nil {
+			log.Printf("Database error deleting comment: %v", err)
+			return err
+		}
+		err = recordIssueEvent(tx, IssueEvent{
+			IssueID:   comment.IssueID,
+			ActorID:   strPtr(deletedBy),
+			EventType: eventCommentDeleted,
+			OldValue:  strPtr(comment.Content),
+			CommentID: strPtr(comment.ID),
+		})
+		if err != nil {
+			return err
+		}
+		return emitCommentWebhook(tx, comment, deletedBy, "comment.deleted")
+	})
+	if err == nil {
+		removeAttachmentBlobs(blobs)
 	}
 	return err
 }
@@ -936,13 +1434,7 @@ func getAllUsers() ([]User, error) {
 }
 
 func getProfileHandler(c *gin.Context) {
-	userID := c.GetString("user_id")
-	user, err := getUserByID(userID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-		return
-	}
-	c.JSON(http.StatusOK, user)
+	c.JSON(http.StatusOK, currentPrincipal(c).User)
 }
 
 func getUserByID(userID string) (User, error) {
@@ -1018,7 +1510,21 @@ func updateUserRoleHandler(c *gin.Context) {
 }
 
 func setUserRole(userID, role string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `UPDATE users SET role = $1, updated_at = NOW() WHERE id = $2`
-	_, err := db.Exec(query, role, userID)
-	return err
+	if _, err := tx.Exec(query, role, userID); err != nil {
+		return err
+	}
+
+	// Force the user to sign in again so the new role applies immediately
+	query = `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	if _, err := tx.Exec(query, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
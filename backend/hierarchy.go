@@ -0,0 +1,302 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// maxIssueDepth is how many levels an issue tree may have, such as epic,
+// story and task.
+const maxIssueDepth = 3
+
+// Rules for closing a parent issue, set per project
+const (
+	parentCloseNone  = "none"
+	parentCloseBlock = "block"
+	parentCloseAuto  = "auto_close"
+)
+
+var parentCloseRules = map[string]bool{parentCloseNone: true, parentCloseBlock: true, parentCloseAuto: true}
+
+var (
+	errInvalidParent = errors.New("parent must be another issue in the same project")
+	errParentCycle   = errors.New("an issue cannot be its own ancestor")
+	errParentDepth   = errors.New("issue tree would be too deep")
+)
+
+// getIssueChildrenHandler lists an issue's direct children with a rollup of
+// how many are done.
+func getIssueChildrenHandler(c *gin.Context) {
+	issue, err := getIssueByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Issue not found"})
+		return
+	}
+	limit := 10
+	offset := 0
+	if l := c.Query("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if v, err := strconv.Atoi(o); err == nil && v >= 0 {
+			offset = v
+		}
+	}
+
+	filter := issueFilter{ProjectID: issue.ProjectID, Parent: issue.ID}
+	total, err := countIssues(filter)
+	var children []Issue
+	if err == nil {
+		children, err = getIssuesPaginated(filter, limit, offset)
+	}
+	var progress map[string]*IssueProgress
+	if err == nil {
+		progress, err = getIssueProgress(issue.ProjectID, "parent_id", []string{issue.ID})
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch child issues"})
+		return
+	}
+	if children == nil {
+		children = []Issue{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"issues":   children,
+		"progress": progress[issue.ID],
+		"total":    total,
+		"limit":    limit,
+		"offset":   offset,
+		"message":  "Child issues fetched successfully",
+	})
+}
+
+// attachChildProgress fills in Children on each issue.
+func attachChildProgress(projectID string, issues []Issue) error {
+	if len(issues) == 0 {
+		return nil
+	}
+	ids := make([]string, len(issues))
+	for i, issue := range issues {
+		ids[i] = issue.ID
+	}
+	progress, err := getIssueProgress(projectID, "parent_id", ids)
+	if err != nil {
+		return err
+	}
+	for i := range issues {
+		issues[i].Children = progress[issues[i].ID]
+	}
+	return nil
+}
+
+// validateIssueParent checks that making parentID the parent of issueID
+// keeps the tree acyclic, within one project and within maxIssueDepth
+// levels. issueID is empty for a new issue. It runs in the transaction that
+// saves the parent, after lockProject, so that two concurrent moves cannot
+// together make a cycle or too deep a tree.
+func validateIssueParent(tx *Tx, projectID, issueID string, parentID *string) error {
+	if parentID == nil {
+		return nil
+	}
+	if _, err := uuid.Parse(*parentID); err != nil || *parentID == issueID {
+		return errInvalidParent
+	}
+	var parentProject string
+	err := tx.QueryRow(`SELECT project_id FROM issues WHERE id = $1`, *parentID).Scan(&parentProject)
+	if err == sql.ErrNoRows || (err == nil && parentProject != projectID) {
+		return errInvalidParent
+	}
+	if err != nil {
+		return err
+	}
+
+	// Count the levels above and including the new parent, noting whether
+	// the issue itself is among them
+	var levels int
+	var cycle bool
+	query := `
+	WITH RECURSIVE ancestors(id, parent_id, depth) AS (
+		SELECT id, parent_id, 1 FROM issues WHERE id = $1
+		UNION ALL
+		SELECT i.id, i.parent_id, a.depth + 1
+		FROM issues i
+		JOIN ancestors a ON i.id = a.parent_id
+		WHERE a.depth <= $3
+	)
+	SELECT MAX(depth), COALESCE(bool_or(id::text = $2), false) FROM ancestors
+	`
+	if err := tx.QueryRow(query, *parentID, issueID, maxIssueDepth).Scan(&levels, &cycle); err != nil {
+		return err
+	}
+	if cycle {
+		return errParentCycle
+	}
+
+	// Count the levels from the issue down to its deepest descendant
+	height := 1
+	if issueID != "" {
+		query = `
+		WITH RECURSIVE descendants(id, depth) AS (
+			SELECT id, 1 FROM issues WHERE id = $1
+			UNION ALL
+			SELECT i.id, d.depth + 1
+			FROM issues i
+			JOIN descendants d ON i.parent_id = d.id
+			WHERE d.depth <= $2
+		)
+		SELECT MAX(depth) FROM descendants
+		`
+		if err := tx.QueryRow(query, issueID, maxIssueDepth).Scan(&height); err != nil {
+			return err
+		}
+	}
+	if levels+height > maxIssueDepth {
+		return errParentDepth
+	}
+	return nil
+}
+
+// writeParentError answers an issue save that validateIssueParent rejected.
+// It returns false, writing nothing, if err is not about the parent.
+func writeParentError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, errInvalidParent):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Parent must be another issue in the same project"})
+	case errors.Is(err, errParentCycle):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "An issue cannot be moved under its own sub-task"})
+	case errors.Is(err, errParentDepth):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Issues can be nested at most " + strconv.Itoa(maxIssueDepth) + " levels deep"})
+	default:
+		return false
+	}
+	return true
+}
+
+// checkOpenChildren stops an issue from moving into a done status while its
+// children are still open, when its project uses the block rule. It writes
+// the error response and returns false if the move is not allowed.
+func checkOpenChildren(c *gin.Context, issue Issue, workflow Workflow) bool {
+	project, err := getProjectByID(issue.ProjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load project"})
+		return false
+	}
+	if project.ParentCloseRule != parentCloseBlock {
+		return true
+	}
+	open, err := openChildIDs(db, issue.ID, workflow)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check child issues"})
+		return false
+	}
+	if len(open) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Issue has open child issues", "children": open})
+		return false
+	}
+	return true
+}
+
+// openChildIDs returns the IDs of an issue's children that are not done.
+func openChildIDs(q queryer, issueID string, workflow Workflow) ([]string, error) {
+	query := `SELECT id FROM issues WHERE parent_id = $1 AND NOT (status = ANY($2))`
+	return queryIDs(q, query, issueID, pq.Array(workflow.DoneStatuses()))
+}
+
+// closeFinishedParents closes the parent of an issue that has just been
+// done once all of the parent's children are done, when the project uses
+// the auto_close rule. Closing the parent carries on up the tree.
+func closeFinishedParents(tx *Tx, parentID *string, actorID string) error {
+	if parentID == nil {
+		return nil
+	}
+	parent, err := scanIssue(tx.QueryRow(`SELECT `+issueColumns+` FROM issues WHERE id = $1 FOR UPDATE`, *parentID))
+	if err != nil {
+		return err
+	}
+	project, err := getProjectByID(parent.ProjectID)
+	if err != nil || project.ParentCloseRule != parentCloseAuto {
+		return err
+	}
+	workflow, err := getProjectWorkflow(parent.ProjectID)
+	if err != nil {
+		return err
+	}
+	open, err := openChildIDs(tx, parent.ID, workflow)
+	if err != nil || len(open) > 0 {
+		return err
+	}
+	_, err = closeIssue(tx, parent, actorID)
+	return err
+}
+
+// closeIssue moves an issue into the first done status its workflow lets it
+// reach, on behalf of automation rather than a direct edit. A transition
+// that requires a resolution gets "fixed". The issue is left alone, and
+// false returned, if it is already done, no done status is reachable, or the
+// project's blocker or child rules forbid closing it.
+func closeIssue(tx *Tx, issue Issue, actorID string) (bool, error) {
+	workflow, err := getProjectWorkflow(issue.ProjectID)
+	if err != nil || workflow.IsDone(issue.Status) {
+		return false, err
+	}
+	project, err := getProjectByID(issue.ProjectID)
+	if err != nil {
+		return false, err
+	}
+	if project.PreventCloseWithOpenBlockers {
+		blockers, err := openBlockers(issue.ID)
+		if err != nil || len(blockers) > 0 {
+			return false, err
+		}
+	}
+	if project.ParentCloseRule == parentCloseBlock {
+		open, err := openChildIDs(tx, issue.ID, workflow)
+		if err != nil || len(open) > 0 {
+			return false, err
+		}
+	}
+
+	var closed *Issue
+	for _, status := range workflow.DoneStatuses() {
+		t, ok := workflow.Transition(issue.Status, status)
+		if !ok {
+			continue
+		}
+		candidate := issue
+		candidate.Status = status
+		for _, field := range t.RequiredFields {
+			if field == "resolution" && candidate.Resolution == nil {
+				candidate.Resolution = strPtr("fixed")
+			}
+		}
+		if workflow.CheckTransition(issue.Status, candidate) == nil {
+			closed = &candidate
+			break
+		}
+	}
+	if closed == nil {
+		return false, nil
+	}
+
+	query := `UPDATE issues SET status = $1, resolution = $2, updated_at = NOW() WHERE id = $3`
+	if _, err := tx.Exec(query, closed.Status, closed.Resolution, issue.ID); err != nil {
+		log.Printf("Database error closing issue: %v", err)
+		return false, err
+	}
+	if _, err := recordIssueChanges(tx, issue, *closed, actorID); err != nil {
+		return false, err
+	}
+	if err := announceTransition(tx, issue.ID, issue.Status, closed.Status, actorID); err != nil {
+		return false, err
+	}
+	return true, closeFinishedParents(tx, issue.ParentID, actorID)
+}
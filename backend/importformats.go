@@ -0,0 +1,472 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sources an import can read
+const (
+	importSourceCSV     = "csv"
+	importSourceGitHub  = "github"
+	importSourceJiraCSV = "jira_csv"
+	importSourceJiraXML = "jira_xml"
+)
+
+var importSources = map[string]bool{
+	importSourceCSV:     true,
+	importSourceGitHub:  true,
+	importSourceJiraCSV: true,
+	importSourceJiraXML: true,
+}
+
+// importFields are the issue fields a CSV column can be mapped to
+var importFields = []string{"external_id", "title", "description", "status", "priority", "resolution", "assignee", "reporter", "labels", "created_at", "updated_at"}
+
+// defaultImportColumns are the columns read for each field unless the
+// mapping says otherwise. Plain CSV matches the columns of our own export.
+var defaultImportColumns = map[string]map[string]string{
+	importSourceCSV: {
+		"external_id": "id",
+		"title":       "title",
+		"description": "description",
+		"status":      "status",
+		"priority":    "priority",
+		"resolution":  "resolution",
+		"assignee":    "assignee",
+		"reporter":    "reporter",
+		"labels":      "labels",
+		"created_at":  "created_at",
+		"updated_at":  "updated_at",
+	},
+	importSourceJiraCSV: {
+		"external_id": "Issue key",
+		"title":       "Summary",
+		"description": "Description",
+		"status":      "Status",
+		"priority":    "Priority",
+		"resolution":  "Resolution",
+		"assignee":    "Assignee",
+		"reporter":    "Reporter",
+		"labels":      "Labels",
+		"created_at":  "Created",
+		"updated_at":  "Updated",
+	},
+}
+
+// importDateLayouts are tried in order for dates without a date_format
+var importDateLayouts = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"02/Jan/06 3:04 PM",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// importPriorityAliases maps priority names used by other trackers onto ours
+var importPriorityAliases = map[string]string{
+	"highest": "critical",
+	"blocker": "critical",
+	"urgent":  "critical",
+	"major":   "high",
+	"normal":  "medium",
+	"minor":   "low",
+	"lowest":  "low",
+	"trivial": "low",
+}
+
+var validPriorities = map[string]bool{"low": true, "medium": true, "high": true, "critical": true}
+
+// importMapping tells an import how to read its file. Columns maps issue
+// fields to CSV column names; Statuses, Priorities and Users map values in
+// the file to a status, priority or user email in the tracker.
+type importMapping struct {
+	Columns    map[string]string `json:"columns,omitempty"`
+	Statuses   map[string]string `json:"statuses,omitempty"`
+	Priorities map[string]string `json:"priorities,omitempty"`
+	Users      map[string]string `json:"users,omitempty"`
+	// DateFormat is a Go time layout tried before the built-in ones
+	DateFormat string `json:"date_format,omitempty"`
+}
+
+// importRecord is one issue read from an import file, before it is checked
+// against the project.
+type importRecord struct {
+	Row         int
+	ExternalID  string
+	Title       string
+	Description string
+	Status      string
+	Priority    string
+	Resolution  string
+	// Closed is set when the source marks the issue as finished, and picks a
+	// done status if Status does not match the workflow
+	Closed    bool
+	Assignee  string
+	Reporter  string
+	Labels    []string
+	CreatedAt string
+	UpdatedAt string
+}
+
+// parseImportFile reads every issue in an import file.
+func parseImportFile(source string, data []byte, mapping importMapping) ([]importRecord, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	switch source {
+	case importSourceCSV, importSourceJiraCSV:
+		return parseImportCSV(source, data, mapping)
+	case importSourceGitHub:
+		return parseGitHubIssues(data)
+	case importSourceJiraXML:
+		return parseJiraXML(data)
+	}
+	return nil, fmt.Errorf("unknown source %q", source)
+}
+
+// parseImportCSV reads a CSV file with a header row. A field can be read
+// from several columns with the same name, as Jira does for labels.
+func parseImportCSV(source string, data []byte, mapping importMapping) ([]importRecord, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, errors.New("file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	positions := map[string][]int{}
+	for i, name := range header {
+		key := strings.ToLower(strings.TrimSpace(name))
+		positions[key] = append(positions[key], i)
+	}
+	columns := map[string][]int{}
+	for _, field := range importFields {
+		name, ok := mapping.Columns[field]
+		if !ok {
+			name = defaultImportColumns[source][field]
+		}
+		columns[field] = positions[strings.ToLower(strings.TrimSpace(name))]
+	}
+	for field, name := range mapping.Columns {
+		if _, known := columns[field]; !known {
+			return nil, fmt.Errorf("unknown field %q in column mapping", field)
+		}
+		if len(columns[field]) == 0 {
+			return nil, fmt.Errorf("column %q mapped to %s is not in the file", name, field)
+		}
+	}
+	if len(columns["title"]) == 0 {
+		return nil, errors.New("no title column; map one with columns.title")
+	}
+
+	var records []importRecord
+	for row := 2; ; row++ {
+		values, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		cell := func(field string) string {
+			for _, i := range columns[field] {
+				if i < len(values) && strings.TrimSpace(values[i]) != "" {
+					return strings.TrimSpace(values[i])
+				}
+			}
+			return ""
+		}
+		var labels []string
+		for _, i := range columns["labels"] {
+			if i < len(values) {
+				labels = append(labels, strings.Split(values[i], ",")...)
+			}
+		}
+
+		record := importRecord{
+			Row:         row,
+			ExternalID:  cell("external_id"),
+			Title:       cell("title"),
+			Description: cell("description"),
+			Status:      cell("status"),
+			Priority:    cell("priority"),
+			Resolution:  cell("resolution"),
+			Assignee:    cell("assignee"),
+			Reporter:    cell("reporter"),
+			Labels:      labels,
+			CreatedAt:   cell("created_at"),
+			UpdatedAt:   cell("updated_at"),
+		}
+		if strings.EqualFold(record.Resolution, "unresolved") {
+			record.Resolution = ""
+		}
+		record.Closed = record.Resolution != ""
+		if record.ExternalID == "" {
+			record.ExternalID = "row:" + strconv.Itoa(row)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+type githubUser struct {
+	Login string `json:"login"`
+}
+
+// githubIssue is an issue as returned by the GitHub REST API's repository
+// issues endpoint, e.g. saved with `gh api --paginate repos/:owner/:repo/issues?state=all`.
+type githubIssue struct {
+	Number      int         `json:"number"`
+	HTMLURL     string      `json:"html_url"`
+	Title       string      `json:"title"`
+	Body        *string     `json:"body"`
+	State       string      `json:"state"`
+	StateReason *string     `json:"state_reason"`
+	User        *githubUser `json:"user"`
+	Assignee    *githubUser `json:"assignee"`
+	Labels      []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	PullRequest json.RawMessage `json:"pull_request"`
+	CreatedAt   string          `json:"created_at"`
+	UpdatedAt   string          `json:"updated_at"`
+}
+
+// parseGitHubIssues reads a JSON array of GitHub issues, or several arrays
+// one after another as paginated API output is saved, skipping pull
+// requests. GitHub users are matched by login through the users mapping.
+func parseGitHubIssues(data []byte) ([]importRecord, error) {
+	var issues []githubIssue
+	d := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var page []githubIssue
+		err := d.Decode(&page)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, page...)
+	}
+	var records []importRecord
+	for i, gh := range issues {
+		if len(gh.PullRequest) > 0 && string(gh.PullRequest) != "null" {
+			continue
+		}
+		record := importRecord{
+			Row:        i + 1,
+			ExternalID: gh.HTMLURL,
+			Title:      strings.TrimSpace(gh.Title),
+			Status:     gh.State,
+			Closed:     strings.EqualFold(gh.State, "closed"),
+			CreatedAt:  gh.CreatedAt,
+			UpdatedAt:  gh.UpdatedAt,
+		}
+		if record.ExternalID == "" {
+			record.ExternalID = "#" + strconv.Itoa(gh.Number)
+		}
+		if gh.Body != nil {
+			record.Description = *gh.Body
+		}
+		if record.Closed {
+			record.Resolution = "fixed"
+			if gh.StateReason != nil && *gh.StateReason == "not_planned" {
+				record.Resolution = "wont_fix"
+			}
+		}
+		if gh.User != nil {
+			record.Reporter = gh.User.Login
+		}
+		if gh.Assignee != nil {
+			record.Assignee = gh.Assignee.Login
+		}
+		for _, label := range gh.Labels {
+			record.Labels = append(record.Labels, label.Name)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+type jiraUser struct {
+	Username  string `xml:"username,attr"`
+	AccountID string `xml:"accountid,attr"`
+	Name      string `xml:",chardata"`
+}
+
+// ref is how the user is matched through the users mapping or by email.
+func (u jiraUser) ref() string {
+	switch {
+	case u.Username != "" && u.Username != "-1":
+		return u.Username
+	case u.AccountID != "" && u.AccountID != "-1":
+		return u.AccountID
+	case strings.EqualFold(strings.TrimSpace(u.Name), "unassigned"):
+		return ""
+	}
+	return strings.TrimSpace(u.Name)
+}
+
+// jiraItem is an issue in a Jira XML (RSS) export.
+type jiraItem struct {
+	Key            string `xml:"key"`
+	Summary        string `xml:"summary"`
+	Description    string `xml:"description"`
+	Status         string `xml:"status"`
+	StatusCategory struct {
+		Key string `xml:"key,attr"`
+	} `xml:"statusCategory"`
+	Priority   string   `xml:"priority"`
+	Resolution string   `xml:"resolution"`
+	Assignee   jiraUser `xml:"assignee"`
+	Reporter   jiraUser `xml:"reporter"`
+	Labels     []string `xml:"labels>label"`
+	Created    string   `xml:"created"`
+	Updated    string   `xml:"updated"`
+}
+
+// parseJiraXML reads the issues in a Jira XML export. Descriptions are kept
+// as the HTML Jira exports.
+func parseJiraXML(data []byte) ([]importRecord, error) {
+	var rss struct {
+		Items []jiraItem `xml:"channel>item"`
+	}
+	d := xml.NewDecoder(bytes.NewReader(data))
+	// Jira writes HTML entities such as &nbsp; into its XML
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+	if err := d.Decode(&rss); err != nil {
+		return nil, err
+	}
+	records := make([]importRecord, 0, len(rss.Items))
+	for i, item := range rss.Items {
+		record := importRecord{
+			Row:         i + 1,
+			ExternalID:  strings.TrimSpace(item.Key),
+			Title:       strings.TrimSpace(item.Summary),
+			Description: strings.TrimSpace(item.Description),
+			Status:      strings.TrimSpace(item.Status),
+			Priority:    strings.TrimSpace(item.Priority),
+			Resolution:  strings.TrimSpace(item.Resolution),
+			Assignee:    item.Assignee.ref(),
+			Reporter:    item.Reporter.ref(),
+			Labels:      item.Labels,
+			CreatedAt:   strings.TrimSpace(item.Created),
+			UpdatedAt:   strings.TrimSpace(item.Updated),
+		}
+		if strings.EqualFold(record.Resolution, "unresolved") {
+			record.Resolution = ""
+		}
+		record.Closed = item.StatusCategory.Key == "done" || record.Resolution != ""
+		if record.ExternalID == "" {
+			record.ExternalID = "item:" + strconv.Itoa(i+1)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// normalizeImportName turns a status or resolution name such as "In Review"
+// or "Won't Fix" into the form the tracker uses, such as in_review.
+func normalizeImportName(name string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		switch {
+		case r == '\'':
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9'):
+			if underscore && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			underscore = false
+			b.WriteRune(r)
+		default:
+			underscore = true
+		}
+	}
+	return b.String()
+}
+
+// importStatus picks the workflow status for a record.
+func (m importMapping) importStatus(record importRecord, workflow Workflow) (string, error) {
+	if status, ok := m.Statuses[record.Status]; ok {
+		if _, ok := workflow.Status(status); !ok {
+			return "", fmt.Errorf("status %q is mapped to %q, which is not in the workflow", record.Status, status)
+		}
+		return status, nil
+	}
+	if _, ok := workflow.Status(normalizeImportName(record.Status)); ok && record.Status != "" {
+		return normalizeImportName(record.Status), nil
+	}
+	if record.Closed {
+		if done := workflow.DoneStatuses(); len(done) > 0 {
+			return done[0], nil
+		}
+	}
+	if record.Status == "" {
+		return workflow.InitialStatus(), nil
+	}
+	return "", fmt.Errorf("unknown status %q; map it with statuses", record.Status)
+}
+
+// importPriority picks the priority for a record, medium if it has none.
+func (m importMapping) importPriority(record importRecord) (string, error) {
+	if priority, ok := m.Priorities[record.Priority]; ok {
+		if !validPriorities[priority] {
+			return "", fmt.Errorf("priority %q is mapped to unknown priority %q", record.Priority, priority)
+		}
+		return priority, nil
+	}
+	if record.Priority == "" {
+		return "medium", nil
+	}
+	priority := strings.ToLower(record.Priority)
+	if alias, ok := importPriorityAliases[priority]; ok {
+		priority = alias
+	}
+	if !validPriorities[priority] {
+		return "", fmt.Errorf("unknown priority %q; map it with priorities", record.Priority)
+	}
+	return priority, nil
+}
+
+// importUserEmail maps a user in the file to the email to look up.
+func (m importMapping) importUserEmail(ref string) string {
+	if email, ok := m.Users[ref]; ok {
+		return email
+	}
+	return ref
+}
+
+// importTime parses a date from the file, or returns fallback if it is
+// empty.
+func (m importMapping) importTime(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	layouts := importDateLayouts
+	if m.DateFormat != "" {
+		layouts = append([]string{m.DateFormat}, layouts...)
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised date %q; set date_format", value)
+}
@@ -0,0 +1,684 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultMaxImportSize = 20 << 20
+	importPollInterval   = 5 * time.Second
+	importLease          = 2 * time.Minute
+	// importProgressEvery is how many issues are processed between progress
+	// updates, which also renew the job's lease
+	importProgressEvery = 25
+	importMaxErrors     = 100
+	importMaxUnmapped   = 100
+)
+
+// Import job statuses
+const (
+	importPending   = "pending"
+	importRunning   = "running"
+	importCompleted = "completed"
+	importFailed    = "failed"
+)
+
+// Outcomes of importing one issue
+const (
+	importOutcomeCreated = "created"
+	importOutcomeSkipped = "skipped"
+	importOutcomeFailed  = "failed"
+)
+
+var (
+	errImportRunning   = errors.New("an import with this idempotency key is already running")
+	errImportLeaseLost = errors.New("the import was taken over by another runner")
+)
+
+// maxImportSize is the largest accepted import file, from MAX_IMPORT_SIZE in
+// bytes.
+func maxImportSize() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("MAX_IMPORT_SIZE"), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return defaultMaxImportSize
+}
+
+func getImportJobsHandler(c *gin.Context) {
+	projectID := c.Param("id")
+	limit := 10
+	offset := 0
+	if l := c.Query("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if v, err := strconv.Atoi(o); err == nil && v >= 0 {
+			offset = v
+		}
+	}
+	var total int
+	err := db.QueryRow(`SELECT COUNT(*) FROM import_jobs WHERE project_id = $1`, projectID).Scan(&total)
+	var jobs []ImportJob
+	if err == nil {
+		jobs, err = getImportJobsByProject(projectID, limit, offset)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch imports"})
+		return
+	}
+	if jobs == nil {
+		jobs = []ImportJob{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"imports": jobs,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+		"message": "Imports fetched successfully",
+	})
+}
+
+func getImportJobHandler(c *gin.Context) {
+	query := `SELECT ` + importJobColumns + ` FROM import_jobs WHERE id = $1 AND project_id = $2`
+	job, err := scanImportJob(db.QueryRow(query, c.Param("jobId"), c.Param("id")))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import not found"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// createImportJobHandler accepts an import file as the "file" part of a
+// multipart upload, along with its "source", an optional JSON "mapping" and
+// "dry_run". The file is checked to be readable straight away and then
+// imported in the background. Issues already imported under the request's
+// Idempotency-Key are skipped, so an import can safely be run again.
+func createImportJobHandler(c *gin.Context) {
+	projectID := c.Param("id")
+	key := strings.TrimSpace(c.GetHeader("Idempotency-Key"))
+	if key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key header is required"})
+		return
+	}
+	if len(key) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+		return
+	}
+
+	maxSize := maxImportSize()
+	// Leave room for the multipart framing around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+1<<20)
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Import files may be at most %d bytes", maxSize)})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing file field"})
+		return
+	}
+	if header.Size > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Import files may be at most %d bytes", maxSize)})
+		return
+	}
+	source := c.PostForm("source")
+	if !importSources[source] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Source must be csv, github, jira_csv or jira_xml"})
+		return
+	}
+	var mapping importMapping
+	if m := c.PostForm("mapping"); m != "" {
+		if err := json.Unmarshal([]byte(m), &mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mapping: " + err.Error()})
+			return
+		}
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read upload"})
+		return
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read upload"})
+		return
+	}
+	records, err := parseImportFile(source, data, mapping)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read import file: " + err.Error()})
+		return
+	}
+	if len(records) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Import file contains no issues"})
+		return
+	}
+
+	job := ImportJob{
+		ID:             uuid.New().String(),
+		ProjectID:      projectID,
+		Source:         source,
+		Filename:       header.Filename,
+		IdempotencyKey: key,
+		DryRun:         c.PostForm("dry_run") == "true",
+		Status:         importPending,
+		Total:          len(records),
+		Errors:         []ImportError{},
+		UnmappedUsers:  []string{},
+		CreatedBy:      strPtr(c.GetString("user_id")),
+		CreatedAt:      time.Now().Format(time.RFC3339),
+	}
+	if err := createImportJob(job, mapping, data); err != nil {
+		if errors.Is(err, errImportRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": "An import with this idempotency key is already running"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start import"})
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+// createImportJob queues an import. Only one import per idempotency key may
+// write issues at a time; dry runs never conflict.
+func createImportJob(job ImportJob, mapping importMapping, data []byte) error {
+	mappingJSON, err := json.Marshal(mapping)
+	if err != nil {
+		return err
+	}
+	return withTx(func(tx *Tx) error {
+		if !job.DryRun {
+			if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, "import_jobs:"+job.ProjectID+":"+job.IdempotencyKey); err != nil {
+				return err
+			}
+			var running bool
+			query := `
+			SELECT EXISTS (
+				SELECT 1 FROM import_jobs
+				WHERE project_id = $1 AND idempotency_key = $2 AND NOT dry_run AND status IN ('pending', 'running')
+			)
+			`
+			if err := tx.QueryRow(query, job.ProjectID, job.IdempotencyKey).Scan(&running); err != nil {
+				return err
+			}
+			if running {
+				return errImportRunning
+			}
+		}
+		query := `
+		INSERT INTO import_jobs (id, project_id, source, filename, idempotency_key, dry_run, mapping, payload, status, total_count, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		`
+		_, err := tx.Exec(query, job.ID, job.ProjectID, job.Source, job.Filename, job.IdempotencyKey, job.DryRun, mappingJSON, data, job.Status, job.Total, job.CreatedBy, job.CreatedAt)
+		if err != nil {
+			log.Printf("Database error creating import job: %v", err)
+		}
+		return err
+	})
+}
+
+const importJobColumns = `id, project_id, source, filename, idempotency_key, dry_run, status, total_count, processed_count, created_count, skipped_count, failed_count, errors, unmapped_users, error, created_by, created_at, started_at, finished_at`
+
+func scanImportJob(row rowScanner) (ImportJob, error) {
+	var job ImportJob
+	var errorsJSON, unmappedJSON []byte
+	err := row.Scan(&job.ID, &job.ProjectID, &job.Source, &job.Filename, &job.IdempotencyKey, &job.DryRun, &job.Status, &job.Total, &job.Processed, &job.Created, &job.Skipped, &job.Failed, &errorsJSON, &unmappedJSON, &job.Error, &job.CreatedBy, &job.CreatedAt, &job.StartedAt, &job.FinishedAt)
+	if err != nil {
+		return job, err
+	}
+	if err := json.Unmarshal(errorsJSON, &job.Errors); err != nil {
+		return job, err
+	}
+	if err := json.Unmarshal(unmappedJSON, &job.UnmappedUsers); err != nil {
+		return job, err
+	}
+	return job, nil
+}
+
+func getImportJobsByProject(projectID string, limit, offset int) ([]ImportJob, error) {
+	query := `SELECT ` + importJobColumns + ` FROM import_jobs WHERE project_id = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`
+	rows, err := db.Query(query, projectID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var jobs []ImportJob
+	for rows.Next() {
+		job, err := scanImportJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// startImportRunner works through queued imports in the background.
+func startImportRunner() {
+	go func() {
+		ticker := time.NewTicker(importPollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			for {
+				ran, err := runNextImportJob()
+				if err != nil {
+					log.Printf("Import job error: %v", err)
+				}
+				if !ran || err != nil {
+					break
+				}
+			}
+		}
+	}()
+}
+
+// runNextImportJob claims the oldest queued import and runs it, reporting
+// whether there was one. A running job whose lease has expired, because the
+// replica running it stopped, is claimed again and started over; the issues
+// it already created are found by their idempotency key and not repeated.
+func runNextImportJob() (bool, error) {
+	query := `
+	UPDATE import_jobs
+	SET status = 'running', started_at = COALESCE(started_at, NOW()), lease_until = $1,
+		processed_count = 0, created_count = 0, skipped_count = 0, failed_count = 0, errors = '[]', unmapped_users = '[]'
+	WHERE id = (
+		SELECT id FROM import_jobs
+		WHERE status = 'pending' OR (status = 'running' AND lease_until < NOW())
+		ORDER BY created_at ASC
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING ` + importJobColumns + `, mapping, payload`
+	var mappingJSON, payload []byte
+	lease := queueLease(importLease)
+	claimed, err := scanImportJob(extraScanner{db.QueryRow(query, lease), []interface{}{&mappingJSON, &payload}})
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	job := runningImportJob{ImportJob: claimed, lease: lease}
+
+	var mapping importMapping
+	if err := json.Unmarshal(mappingJSON, &mapping); err != nil {
+		return true, finishImportJob(&job, err)
+	}
+	return true, finishImportJob(&job, runImportJob(&job, mapping, payload))
+}
+
+// runningImportJob is a job claimed by this runner, with the lease_until it
+// last set. Progress is only written while the job still holds that lease.
+type runningImportJob struct {
+	ImportJob
+	lease time.Time
+}
+
+// runImportJob imports every issue in the job's file, saving progress as it
+// goes. Issues that cannot be imported are counted and reported rather than
+// stopping the job.
+func runImportJob(job *runningImportJob, mapping importMapping, payload []byte) error {
+	records, err := parseImportFile(job.Source, payload, mapping)
+	if err != nil {
+		return err
+	}
+	workflow, err := getProjectWorkflow(job.ProjectID)
+	if err != nil {
+		return err
+	}
+	if job.CreatedBy == nil {
+		return errors.New("the user who started the import no longer exists")
+	}
+
+	importer := &issueImporter{
+		job:      &job.ImportJob,
+		mapping:  mapping,
+		workflow: workflow,
+		users:    map[string]*string{},
+		unmapped: map[string]bool{},
+		seen:     map[string]bool{},
+	}
+	job.Total = len(records)
+	for i, record := range records {
+		outcome, reason, err := importer.importRecord(record)
+		if err != nil {
+			return err
+		}
+		job.Processed++
+		switch outcome {
+		case importOutcomeCreated:
+			job.Created++
+		case importOutcomeSkipped:
+			job.Skipped++
+		case importOutcomeFailed:
+			job.Failed++
+			if len(job.Errors) < importMaxErrors {
+				job.Errors = append(job.Errors, ImportError{Row: record.Row, ExternalID: record.ExternalID, Error: reason})
+			}
+		}
+		if (i+1)%importProgressEvery == 0 {
+			if err := saveImportProgress(job); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func saveImportProgress(job *runningImportJob) error {
+	errorsJSON, err := json.Marshal(job.Errors)
+	if err != nil {
+		return err
+	}
+	unmappedJSON, err := json.Marshal(job.UnmappedUsers)
+	if err != nil {
+		return err
+	}
+	lease := queueLease(importLease)
+	query := `
+	UPDATE import_jobs
+	SET total_count = $1, processed_count = $2, created_count = $3, skipped_count = $4, failed_count = $5,
+		errors = $6, unmapped_users = $7, lease_until = $8
+	WHERE id = $9 AND lease_until = $10
+	`
+	result, err := db.Exec(query, job.Total, job.Processed, job.Created, job.Skipped, job.Failed, errorsJSON, unmappedJSON, lease, job.ID, job.lease)
+	if err != nil {
+		log.Printf("Database error saving import progress: %v", err)
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = errImportLeaseLost
+		}
+		return err
+	}
+	job.lease = lease
+	return nil
+}
+
+// finishImportJob records the final progress and outcome of a job and drops
+// its file. runErr is the error that stopped the job, if any. Nothing is
+// written once another runner has taken the job over.
+func finishImportJob(job *runningImportJob, runErr error) error {
+	if errors.Is(runErr, errImportLeaseLost) {
+		log.Printf("Import job %s was taken over by another runner", job.ID)
+		return nil
+	}
+	if err := saveImportProgress(job); err != nil {
+		if errors.Is(err, errImportLeaseLost) {
+			log.Printf("Import job %s was taken over by another runner", job.ID)
+			return nil
+		}
+		return err
+	}
+	status := importCompleted
+	var message *string
+	if runErr != nil {
+		status = importFailed
+		message = strPtr(runErr.Error())
+		log.Printf("Import job %s failed: %v", job.ID, runErr)
+	}
+	query := `
+	UPDATE import_jobs
+	SET status = $1, error = $2, finished_at = NOW(), lease_until = NULL, payload = NULL
+	WHERE id = $3 AND lease_until = $4
+	`
+	_, err := db.Exec(query, status, message, job.ID, job.lease)
+	if err != nil {
+		log.Printf("Database error finishing import job: %v", err)
+	}
+	return err
+}
+
+// issueImporter turns the records of one import job into issues.
+type issueImporter struct {
+	job      *ImportJob
+	mapping  importMapping
+	workflow Workflow
+	// users caches project members by lower-case email; nil means no match
+	users    map[string]*string
+	unmapped map[string]bool
+	// seen holds the external IDs already imported from this file, so
+	// repeats are skipped in dry runs as well as real ones
+	seen map[string]bool
+}
+
+// importRecord imports one record, returning what happened to it and, for a
+// record that could not be imported, why. A non-nil error stops the job.
+func (imp *issueImporter) importRecord(record importRecord) (string, string, error) {
+	issue, labels, reason, err := imp.buildIssue(record)
+	if err != nil {
+		return "", "", err
+	}
+	if reason != "" {
+		return importOutcomeFailed, reason, nil
+	}
+
+	// Later copies of an issue in the same file are skipped
+	if imp.seen[record.ExternalID] {
+		return importOutcomeSkipped, "", nil
+	}
+
+	// An issue imported earlier under the same key is skipped, unless this
+	// job created it before being restarted
+	var importedBy *string
+	query := `SELECT job_id FROM imported_issues WHERE project_id = $1 AND idempotency_key = $2 AND external_id = $3`
+	err = db.QueryRow(query, imp.job.ProjectID, imp.job.IdempotencyKey, record.ExternalID).Scan(&importedBy)
+	if err == nil {
+		if importedBy != nil && *importedBy == imp.job.ID {
+			imp.seen[record.ExternalID] = true
+			return importOutcomeCreated, "", nil
+		}
+		return importOutcomeSkipped, "", nil
+	}
+	if err != sql.ErrNoRows {
+		return "", "", err
+	}
+	if imp.job.DryRun {
+		imp.seen[record.ExternalID] = true
+		return importOutcomeCreated, "", nil
+	}
+
+	err = withTx(func(tx *Tx) error {
+		return imp.createIssue(tx, issue, labels, record.ExternalID)
+	})
+	if isUniqueViolation(err) {
+		// Another job with the same key imported it first
+		return importOutcomeSkipped, "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	imp.seen[record.ExternalID] = true
+	return importOutcomeCreated, "", nil
+}
+
+// buildIssue checks a record against the project and turns it into an
+// issue. reason explains why a record cannot be imported.
+func (imp *issueImporter) buildIssue(record importRecord) (issue Issue, labels []string, reason string, err error) {
+	if record.Title == "" {
+		return issue, nil, "title is required", nil
+	}
+	if utf8.RuneCountInString(record.Title) > 255 {
+		return issue, nil, "title is longer than 255 characters", nil
+	}
+	if len(record.ExternalID) > 500 {
+		return issue, nil, "external ID is longer than 500 characters", nil
+	}
+	status, err := imp.mapping.importStatus(record, imp.workflow)
+	if err != nil {
+		return issue, nil, err.Error(), nil
+	}
+	priority, err := imp.mapping.importPriority(record)
+	if err != nil {
+		return issue, nil, err.Error(), nil
+	}
+	var resolution *string
+	if imp.workflow.IsDone(status) {
+		resolution = nilIfEmpty(strPtr(normalizeImportName(record.Resolution)))
+		if resolution != nil && len(*resolution) > 50 {
+			return issue, nil, "resolution is longer than 50 characters", nil
+		}
+	}
+	now := time.Now()
+	createdAt, err := imp.mapping.importTime(record.CreatedAt, now)
+	if err != nil {
+		return issue, nil, err.Error(), nil
+	}
+	updatedAt, err := imp.mapping.importTime(record.UpdatedAt, createdAt)
+	if err != nil {
+		return issue, nil, err.Error(), nil
+	}
+	for _, name := range record.Labels {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if utf8.RuneCountInString(name) > 50 {
+			return issue, nil, fmt.Sprintf("label %q is longer than 50 characters", name), nil
+		}
+		labels = append(labels, name)
+	}
+
+	assignee, err := imp.userID(record.Assignee)
+	if err != nil {
+		return issue, nil, "", err
+	}
+	reporter, err := imp.userID(record.Reporter)
+	if err != nil {
+		return issue, nil, "", err
+	}
+	if reporter == nil {
+		reporter = imp.job.CreatedBy
+	}
+
+	issue = Issue{
+		ID:          uuid.New().String(),
+		Title:       record.Title,
+		Description: record.Description,
+		Status:      status,
+		Priority:    priority,
+		Resolution:  resolution,
+		ProjectID:   imp.job.ProjectID,
+		CreatedBy:   *reporter,
+		AssignedTo:  assignee,
+		CreatedAt:   createdAt.Format(time.RFC3339),
+		UpdatedAt:   updatedAt.Format(time.RFC3339),
+	}
+	return issue, uniqueStrings(labels), "", nil
+}
+
+// userID finds the project member a user in the file refers to, by email
+// directly or through the users mapping. Users without a match are noted
+// on the job.
+func (imp *issueImporter) userID(ref string) (*string, error) {
+	if ref == "" {
+		return nil, nil
+	}
+	email := strings.ToLower(strings.TrimSpace(imp.mapping.importUserEmail(ref)))
+	if id, ok := imp.users[email]; ok {
+		return id, nil
+	}
+	var id *string
+	if strings.Contains(email, "@") {
+		query := `
+		SELECT u.id
+		FROM users u
+		JOIN project_members pm ON pm.user_id = u.id
+		WHERE pm.project_id = $1 AND LOWER(u.email) = $2
+		`
+		var userID string
+		err := db.QueryRow(query, imp.job.ProjectID, email).Scan(&userID)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		if err == nil {
+			id = &userID
+		}
+	}
+	imp.users[email] = id
+	if id == nil && !imp.unmapped[ref] && len(imp.job.UnmappedUsers) < importMaxUnmapped {
+		imp.unmapped[ref] = true
+		imp.job.UnmappedUsers = append(imp.job.UnmappedUsers, ref)
+	}
+	return id, nil
+}
+
+// createIssue writes an imported issue with its labels, creating labels the
+// project does not have yet. Imports do not send webhooks or notifications.
+func (imp *issueImporter) createIssue(tx *Tx, issue Issue, labels []string, externalID string) error {
+	number, err := nextIssueNumber(tx, issue.ProjectID)
+	if err != nil {
+		return err
+	}
+	query := `
+	INSERT INTO issues (id, number, title, description, status, priority, resolution, project_id, created_by, assigned_to, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+	_, err = tx.Exec(query, issue.ID, number, issue.Title, issue.Description, issue.Status, issue.Priority, issue.Resolution, issue.ProjectID, issue.CreatedBy, issue.AssignedTo, issue.CreatedAt, issue.UpdatedAt)
+	if err != nil {
+		log.Printf("Database error importing issue: %v", err)
+		return err
+	}
+	err = recordIssueEvent(tx, IssueEvent{
+		IssueID:   issue.ID,
+		ActorID:   imp.job.CreatedBy,
+		EventType: eventIssueCreated,
+		NewValue:  strPtr(issue.Title),
+		CreatedAt: issue.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	if err := addIssueWatcher(tx, issue.ID, issue.CreatedBy); err != nil {
+		return err
+	}
+	if issue.AssignedTo != nil {
+		if err := insertAssignment(tx, issue.ID, nil, issue.AssignedTo, *imp.job.CreatedBy); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range labels {
+		query := `
+		INSERT INTO labels (project_id, name) VALUES ($1, $2)
+		ON CONFLICT (project_id, LOWER(name)) DO NOTHING
+		`
+		if _, err := tx.Exec(query, issue.ProjectID, name); err != nil {
+			return err
+		}
+		query = `
+		INSERT INTO issue_labels (issue_id, label_id)
+		SELECT $1, id FROM labels WHERE project_id = $2 AND LOWER(name) = LOWER($3)
+		ON CONFLICT DO NOTHING
+		`
+		if _, err := tx.Exec(query, issue.ID, issue.ProjectID, name); err != nil {
+			return err
+		}
+	}
+
+	query = `
+	INSERT INTO imported_issues (project_id, idempotency_key, external_id, issue_id, job_id)
+	VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err = tx.Exec(query, issue.ProjectID, imp.job.IdempotencyKey, externalID, issue.ID, imp.job.ID)
+	return err
+}
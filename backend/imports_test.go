@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingDriver is a database/sql driver that accepts every statement and
+// remembers it. Queries return a single row holding 1.
+type recordingDriver struct {
+	mu         sync.Mutex
+	statements []string
+}
+
+func (d *recordingDriver) Open(string) (driver.Conn, error) { return recordingConn{d}, nil }
+
+func (d *recordingDriver) record(query string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.statements = append(d.statements, strings.Join(strings.Fields(query), " "))
+}
+
+type recordingConn struct{ d *recordingDriver }
+
+func (c recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return recordingStmt{c.d, query}, nil
+}
+func (c recordingConn) Close() error              { return nil }
+func (c recordingConn) Begin() (driver.Tx, error) { return recordingTx{}, nil }
+
+type recordingTx struct{}
+
+func (recordingTx) Commit() error   { return nil }
+func (recordingTx) Rollback() error { return nil }
+
+type recordingStmt struct {
+	d     *recordingDriver
+	query string
+}
+
+func (s recordingStmt) Close() error  { return nil }
+func (s recordingStmt) NumInput() int { return -1 }
+
+func (s recordingStmt) Exec([]driver.Value) (driver.Result, error) {
+	s.d.record(s.query)
+	return driver.RowsAffected(1), nil
+}
+
+func (s recordingStmt) Query([]driver.Value) (driver.Rows, error) {
+	s.d.record(s.query)
+	return &oneRow{}, nil
+}
+
+type oneRow struct{ done bool }
+
+func (r *oneRow) Columns() []string { return []string{"value"} }
+func (r *oneRow) Close() error      { return nil }
+func (r *oneRow) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+// recordingTxFor begins a transaction on a fresh recordingDriver.
+func recordingTxFor(t *testing.T) (*Tx, *recordingDriver) {
+	t.Helper()
+	d := &recordingDriver{}
+	conn := sql.OpenDB(recordingConnector{d})
+	t.Cleanup(func() { conn.Close() })
+	sqlTx, err := conn.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlTx.Rollback() })
+	return &Tx{Tx: sqlTx}, d
+}
+
+type recordingConnector struct{ d *recordingDriver }
+
+func (c recordingConnector) Connect(context.Context) (driver.Conn, error) {
+	return recordingConn{c.d}, nil
+}
+func (c recordingConnector) Driver() driver.Driver { return c.d }
+
+func TestImportedIssueDoesNotNotify(t *testing.T) {
+	tx, recorded := recordingTxFor(t)
+	importer := &issueImporter{job: &ImportJob{ID: "job", ProjectID: "project", IdempotencyKey: "key", CreatedBy: strPtr("importer")}}
+	issue := Issue{
+		ID:         "issue",
+		Title:      "Imported",
+		Status:     "open",
+		Priority:   "medium",
+		ProjectID:  "project",
+		CreatedBy:  "reporter",
+		AssignedTo: strPtr("assignee"),
+	}
+
+	if err := importer.createIssue(tx, issue, nil, "ext-1"); err != nil {
+		t.Fatalf("createIssue: %v", err)
+	}
+
+	var assigned bool
+	for _, statement := range recorded.statements {
+		if strings.HasPrefix(statement, "INSERT INTO issue_assignments") {
+			assigned = true
+		}
+		if strings.Contains(statement, "notifications") || strings.Contains(statement, "email_outbox") || strings.Contains(statement, "webhook_deliveries") {
+			t.Errorf("import ran %q", statement)
+		}
+	}
+	if !assigned {
+		t.Errorf("the assignment was not recorded; statements: %q", recorded.statements)
+	}
+}
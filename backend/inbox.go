@@ -0,0 +1,153 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+func getNotificationsHandler(c *gin.Context) {
+	userID := c.GetString("user_id")
+	unreadOnly := c.Query("unread") == "true"
+	limit := 10
+	offset := 0
+	if l := c.Query("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if v, err := strconv.Atoi(o); err == nil && v >= 0 {
+			offset = v
+		}
+	}
+
+	total, unread, err := countNotifications(userID, unreadOnly)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count notifications"})
+		return
+	}
+	notifications, err := getNotificationsPaginated(userID, unreadOnly, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+		return
+	}
+	if notifications == nil {
+		notifications = []Notification{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": notifications,
+		"total":         total,
+		"unread_count":  unread,
+		"limit":         limit,
+		"offset":        offset,
+		"message":       "Notifications fetched successfully",
+	})
+}
+
+func markNotificationReadHandler(c *gin.Context) {
+	query := `UPDATE notifications SET read_at = COALESCE(read_at, NOW()) WHERE id = $1 AND user_id = $2`
+	result, err := db.Exec(query, c.Param("id"), c.GetString("user_id"))
+	if err != nil {
+		log.Printf("Database error marking notification read: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notification as read"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
+}
+
+func markAllNotificationsReadHandler(c *gin.Context) {
+	query := `UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`
+	result, err := db.Exec(query, c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notifications as read"})
+		return
+	}
+	marked, _ := result.RowsAffected()
+	c.JSON(http.StatusOK, gin.H{"message": "Notifications marked as read", "marked": marked})
+}
+
+// createNotifications adds a notification to each recipient's inbox as part
+// of the caller's transaction.
+func createNotifications(tx *Tx, n issueNotification, recipientIDs []string) error {
+	var oldValue, newValue *string
+	if n.Reason == notifyStatusChanged {
+		oldValue, newValue = strPtr(n.OldStatus), strPtr(n.NewStatus)
+	}
+	query := `
+	INSERT INTO notifications (user_id, reason, issue_id, comment_id, actor_id, old_value, new_value)
+	SELECT recipient, $2, $3, $4, $5, $6, $7
+	FROM unnest($1::uuid[]) AS recipient
+	`
+	_, err := tx.Exec(query, pq.Array(recipientIDs), n.Reason, n.IssueID, n.CommentID, nilIfEmpty(&n.ActorID), oldValue, newValue)
+	if err != nil {
+		log.Printf("Database error creating notifications: %v", err)
+	}
+	return err
+}
+
+// notificationVisible limits notifications to issues the recipient can still
+// see, either as a project member or through their global role, in the same
+// way issueWatcherIDs picks recipients.
+var notificationVisible = `
+	AND ` + canViewProjectSQL("i.project_id", "n.user_id", "r.role")
+
+// countNotifications returns the number of notifications the list would
+// show, and how many of the user's notifications are unread.
+func countNotifications(userID string, unreadOnly bool) (total, unread int, err error) {
+	query := `
+	SELECT COUNT(*), COUNT(*) FILTER (WHERE n.read_at IS NULL)
+	FROM notifications n
+	JOIN issues i ON i.id = n.issue_id
+	JOIN users r ON r.id = n.user_id
+	WHERE n.user_id = $1` + notificationVisible
+	err = db.QueryRow(query, userID).Scan(&total, &unread)
+	if unreadOnly {
+		total = unread
+	}
+	return total, unread, err
+}
+
+func getNotificationsPaginated(userID string, unreadOnly bool, limit, offset int) ([]Notification, error) {
+	query := `
+	SELECT n.id, n.reason, n.issue_id, i.title, i.project_id, n.comment_id, n.actor_id, u.first_name || ' ' || u.last_name,
+		n.old_value, n.new_value, n.read_at, n.created_at
+	FROM notifications n
+	JOIN issues i ON i.id = n.issue_id
+	JOIN users r ON r.id = n.user_id
+	LEFT JOIN users u ON u.id = n.actor_id
+	WHERE n.user_id = $1` + notificationVisible
+	if unreadOnly {
+		query += ` AND n.read_at IS NULL`
+	}
+	query += ` ORDER BY n.created_at DESC, n.id DESC LIMIT $2 OFFSET $3`
+
+	rows, err := db.Query(query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		var n Notification
+		err := rows.Scan(&n.ID, &n.Reason, &n.IssueID, &n.IssueTitle, &n.ProjectID, &n.CommentID, &n.ActorID, &n.ActorName,
+			&n.OldValue, &n.NewValue, &n.ReadAt, &n.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		n.Read = n.ReadAt != nil
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
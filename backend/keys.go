@@ -0,0 +1,136 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var (
+	// projectKeyPattern is the shape of a project key such as PROJ
+	projectKeyPattern = regexp.MustCompile(`^[A-Z][A-Z0-9]{1,9}$`)
+	// issueKeyPattern matches an issue key such as PROJ-123 on its own
+	issueKeyPattern = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9]{1,9})-([1-9][0-9]*)$`)
+)
+
+var errProjectKeyTaken = errors.New("project key is already in use")
+
+// issueKey formats an issue's human-readable key.
+func issueKey(projectKey string, number int) string {
+	return projectKey + "-" + strconv.Itoa(number)
+}
+
+// deriveProjectKey suggests a key for a project name: the initials of a
+// name with several words, otherwise its first four letters and digits.
+func deriveProjectKey(name string) string {
+	words := strings.FieldsFunc(strings.ToUpper(name), func(r rune) bool {
+		return r > unicode.MaxASCII || (!unicode.IsLetter(r) && !unicode.IsDigit(r))
+	})
+	var key string
+	if len(words) > 1 {
+		for _, word := range words {
+			key += word[:1]
+		}
+	} else if len(words) == 1 {
+		key = words[0]
+	}
+	key = strings.TrimLeft(key, "0123456789")
+	if len(key) > 4 {
+		key = key[:4]
+	}
+	if len(key) < 2 {
+		key = "PROJ"
+	}
+	return key
+}
+
+// allocateProjectKey returns key if it is free, or when key is empty the
+// first free key derived from the project name, with a number appended if
+// needed.
+func allocateProjectKey(tx *Tx, key, name string) (string, error) {
+	taken := func(candidate string) (bool, error) {
+		var exists bool
+		err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM projects WHERE key = $1)`, candidate).Scan(&exists)
+		return exists, err
+	}
+	if key != "" {
+		exists, err := taken(key)
+		if err == nil && exists {
+			err = errProjectKeyTaken
+		}
+		return key, err
+	}
+
+	base := deriveProjectKey(name)
+	for n := 1; ; n++ {
+		candidate := base
+		if n > 1 {
+			candidate += strconv.Itoa(n)
+		}
+		exists, err := taken(candidate)
+		if err != nil || !exists {
+			return candidate, err
+		}
+	}
+}
+
+// nextIssueNumber allocates the next issue number in a project. The row lock
+// taken by the update is held until the transaction ends, so concurrent
+// issue creation in the same project is serialized and numbers never repeat.
+func nextIssueNumber(tx *Tx, projectID string) (int, error) {
+	var number int
+	query := `UPDATE projects SET issue_counter = issue_counter + 1 WHERE id = $1 RETURNING issue_counter`
+	err := tx.QueryRow(query, projectID).Scan(&number)
+	return number, err
+}
+
+// resolveIssueRef maps an issue UUID or key such as PROJ-123 to the issue's
+// UUID and project.
+func resolveIssueRef(ref string) (issueID, projectID string, err error) {
+	if _, parseErr := uuid.Parse(ref); parseErr == nil {
+		err = db.QueryRow(`SELECT id, project_id FROM issues WHERE id = $1`, ref).Scan(&issueID, &projectID)
+		return issueID, projectID, err
+	}
+	match := issueKeyPattern.FindStringSubmatch(ref)
+	if match == nil {
+		return "", "", sql.ErrNoRows
+	}
+	// Issue numbers are integer columns, so a longer number cannot exist
+	number, convErr := strconv.Atoi(match[2])
+	if convErr != nil || number > math.MaxInt32 {
+		return "", "", sql.ErrNoRows
+	}
+	query := `
+	SELECT i.id, i.project_id
+	FROM issues i
+	JOIN projects p ON p.id = i.project_id
+	WHERE p.key = $1 AND i.number = $2
+	`
+	err = db.QueryRow(query, strings.ToUpper(match[1]), number).Scan(&issueID, &projectID)
+	return issueID, projectID, err
+}
+
+// setParam replaces the value of a route parameter so that handlers further
+// down the chain see it.
+func setParam(c *gin.Context, name, value string) {
+	for i := range c.Params {
+		if c.Params[i].Key == name {
+			c.Params[i].Value = value
+		}
+	}
+}
+
+// isUniqueViolation reports whether err is a Postgres unique constraint
+// violation.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const defaultLabelColor = "#6b7280"
+
+var labelColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+func getLabelsHandler(c *gin.Context) {
+	labels, err := getLabelsByProject(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch labels"})
+		return
+	}
+	if labels == nil {
+		labels = []Label{}
+	}
+	c.JSON(http.StatusOK, gin.H{"labels": labels})
+}
+
+func createLabelHandler(c *gin.Context) {
+	var body struct {
+		Name        string `json:"name" binding:"required"`
+		Color       string `json:"color"`
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	label := Label{
+		ID:          uuid.New().String(),
+		ProjectID:   c.Param("id"),
+		Name:        strings.TrimSpace(body.Name),
+		Color:       body.Color,
+		Description: body.Description,
+		CreatedAt:   time.Now().Format(time.RFC3339),
+	}
+	label.UpdatedAt = label.CreatedAt
+	if label.Color == "" {
+		label.Color = defaultLabelColor
+	}
+	if !validateLabel(c, label) {
+		return
+	}
+
+	// A label created since validateLabel looked still trips the unique index
+	err := createLabel(label)
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A label with this name already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create label"})
+		return
+	}
+	c.JSON(http.StatusCreated, label)
+}
+
+func updateLabelHandler(c *gin.Context) {
+	label, err := getLabelByID(c.Param("id"), c.Param("labelId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Label not found"})
+		return
+	}
+
+	// Only the fields present in the body are changed
+	var body struct {
+		Name        *string `json:"name"`
+		Color       *string `json:"color"`
+		Description *string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if body.Name != nil {
+		label.Name = strings.TrimSpace(*body.Name)
+	}
+	if body.Color != nil {
+		label.Color = *body.Color
+	}
+	if body.Description != nil {
+		label.Description = *body.Description
+	}
+	if !validateLabel(c, label) {
+		return
+	}
+
+	label.UpdatedAt = time.Now().Format(time.RFC3339)
+	err = updateLabel(label)
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A label with this name already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update label"})
+		return
+	}
+	c.JSON(http.StatusOK, label)
+}
+
+func deleteLabelHandler(c *gin.Context) {
+	query := `DELETE FROM labels WHERE id = $1 AND project_id = $2`
+	result, err := db.Exec(query, c.Param("labelId"), c.Param("id"))
+	if err != nil {
+		log.Printf("Database error deleting label: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete label"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Label not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Label deleted successfully"})
+}
+
+func addIssueLabelHandler(c *gin.Context) {
+	setIssueLabel(c, true)
+}
+
+func removeIssueLabelHandler(c *gin.Context) {
+	setIssueLabel(c, false)
+}
+
+// setIssueLabel adds a label to or removes it from an issue. Doing either
+// twice is a no-op.
+func setIssueLabel(c *gin.Context, add bool) {
+	issue, ok := loadEditableIssue(c)
+	if !ok {
+		return
+	}
+	label, err := getLabelByID(issue.ProjectID, c.Param("labelId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Label not found"})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	err = withTx(func(tx *Tx) error {
+		query := `DELETE FROM issue_labels WHERE issue_id = $1 AND label_id = $2`
+		eventType, webhookEvent := eventLabelRemoved, "issue.unlabeled"
+		if add {
+			query = `INSERT INTO issue_labels (issue_id, label_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+			eventType, webhookEvent = eventLabelAdded, "issue.labeled"
+		}
+		result, err := tx.Exec(query, issue.ID, label.ID)
+		if err != nil {
+			log.Printf("Database error changing issue labels: %v", err)
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return nil
+		}
+
+		event := IssueEvent{IssueID: issue.ID, ActorID: strPtr(userID), EventType: eventType, Field: strPtr("labels")}
+		if add {
+			event.NewValue = strPtr(label.Name)
+		} else {
+			event.OldValue = strPtr(label.Name)
+		}
+		if err := recordIssueEvent(tx, event); err != nil {
+			return err
+		}
+		return emitIssueWebhook(tx, issue.ID, userID, webhookEvent, gin.H{"label": label})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update labels"})
+		return
+	}
+
+	issue, err = getIssueByID(issue.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch updated issue"})
+		return
+	}
+	c.JSON(http.StatusOK, issue)
+}
+
+// validateLabel checks a label's fields and that no other label in the
+// project has the same name. It writes the error response and returns false
+// if the label is invalid.
+func validateLabel(c *gin.Context, label Label) bool {
+	if label.Name == "" || len(label.Name) > 50 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Label name must be between 1 and 50 characters"})
+		return false
+	}
+	if !labelColorPattern.MatchString(label.Color) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Color must be a hex color such as #d73a4a"})
+		return false
+	}
+
+	var existing string
+	query := `SELECT id FROM labels WHERE project_id = $1 AND LOWER(name) = LOWER($2) AND id <> $3`
+	err := db.QueryRow(query, label.ProjectID, label.Name, label.ID).Scan(&existing)
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "A label with this name already exists"})
+		return false
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate label"})
+		return false
+	}
+	return true
+}
+
+// labelNames splits a comma-separated list of label names.
+func labelNames(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// labelExistsSQL matches issues with at least one label meeting cond, which
+// may refer to the label as l.
+func labelExistsSQL(cond string) string {
+	query := `EXISTS (SELECT 1 FROM issue_labels il JOIN labels l ON l.id = il.label_id WHERE il.issue_id = issues.id`
+	if cond != "" {
+		query += ` AND ` + cond
+	}
+	return query + `)`
+}
+
+// labelFilterSQL renders the any-of, all-of and none-of label filters.
+func labelFilterSQL(b *sqlBuilder, anyOf, allOf, noneOf []string) []string {
+	var conds []string
+	if len(anyOf) > 0 {
+		conds = append(conds, labelExistsSQL(`LOWER(l.name) = ANY(`+b.arg(pq.Array(anyOf))+`)`))
+	}
+	if len(allOf) > 0 {
+		conds = append(conds, `(SELECT COUNT(DISTINCT LOWER(l.name)) FROM issue_labels il JOIN labels l ON l.id = il.label_id
+			WHERE il.issue_id = issues.id AND LOWER(l.name) = ANY(`+b.arg(pq.Array(allOf))+`)) = `+b.arg(len(uniqueStrings(allOf))))
+	}
+	if len(noneOf) > 0 {
+		conds = append(conds, `NOT `+labelExistsSQL(`LOWER(l.name) = ANY(`+b.arg(pq.Array(noneOf))+`)`))
+	}
+	return conds
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var unique []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
+const labelColumns = `id, project_id, name, color, description, created_at, updated_at`
+
+func scanLabel(row rowScanner) (Label, error) {
+	var label Label
+	err := row.Scan(&label.ID, &label.ProjectID, &label.Name, &label.Color, &label.Description, &label.CreatedAt, &label.UpdatedAt)
+	return label, err
+}
+
+func getLabelByID(projectID, labelID string) (Label, error) {
+	query := `SELECT ` + labelColumns + ` FROM labels WHERE id = $1 AND project_id = $2`
+	return scanLabel(db.QueryRow(query, labelID, projectID))
+}
+
+func getLabelsByProject(projectID string) ([]Label, error) {
+	query := `SELECT ` + labelColumns + ` FROM labels WHERE project_id = $1 ORDER BY LOWER(name)`
+	rows, err := db.Query(query, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var labels []Label
+	for rows.Next() {
+		label, err := scanLabel(rows)
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, label)
+	}
+	return labels, nil
+}
+
+func createLabel(label Label) error {
+	query := `
+	INSERT INTO labels (id, project_id, name, color, description, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := db.Exec(query, label.ID, label.ProjectID, label.Name, label.Color, label.Description, label.CreatedAt, label.UpdatedAt)
+	if err != nil {
+		log.Printf("Database error creating label: %v", err)
+	}
+	return err
+}
+
+func updateLabel(label Label) error {
+	query := `
+	UPDATE labels
+	SET name = $1, color = $2, description = $3, updated_at = $4
+	WHERE id = $5
+	`
+	_, err := db.Exec(query, label.Name, label.Color, label.Description, label.UpdatedAt, label.ID)
+	if err != nil {
+		log.Printf("Database error updating label: %v", err)
+	}
+	return err
+}
+
+// attachIssueLabels fills in Labels on each issue.
+func attachIssueLabels(q queryer, issues []Issue) error {
+	if len(issues) == 0 {
+		return nil
+	}
+	ids := make([]string, len(issues))
+	for i, issue := range issues {
+		ids[i] = issue.ID
+	}
+	query := `
+	SELECT il.issue_id, l.id, l.project_id, l.name, l.color, l.description, l.created_at, l.updated_at
+	FROM issue_labels il
+	JOIN labels l ON l.id = il.label_id
+	WHERE il.issue_id = ANY($1::uuid[])
+	ORDER BY LOWER(l.name)
+	`
+	rows, err := q.Query(query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	labels := map[string][]Label{}
+	for rows.Next() {
+		var issueID string
+		var label Label
+		err := rows.Scan(&issueID, &label.ID, &label.ProjectID, &label.Name, &label.Color, &label.Description, &label.CreatedAt, &label.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		labels[issueID] = append(labels[issueID], label)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i := range issues {
+		issues[i].Labels = labels[issues[i].ID]
+		if issues[i].Labels == nil {
+			issues[i].Labels = []Label{}
+		}
+	}
+	return nil
+}
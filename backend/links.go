@@ -0,0 +1,375 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Links are stored in one direction only. Each type a client may ask for
+// maps to the stored type and whether the two issues swap places.
+var linkTypes = map[string]struct {
+	stored   string
+	reversed bool
+}{
+	"blocks":        {"blocks", false},
+	"blocked_by":    {"blocks", true},
+	"duplicates":    {"duplicates", false},
+	"duplicated_by": {"duplicates", true},
+	"relates_to":    {"relates_to", false},
+}
+
+// inverseLinkTypes names a stored link type as seen from its target issue.
+var inverseLinkTypes = map[string]string{
+	"blocks":     "blocked_by",
+	"duplicates": "duplicated_by",
+	"relates_to": "relates_to",
+}
+
+var (
+	errLinkExists = errors.New("issues are already linked")
+	errLinkCycle  = errors.New("link would create a blocking cycle")
+)
+
+func getIssueLinksHandler(c *gin.Context) {
+	issue, err := getIssueByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Issue not found"})
+		return
+	}
+
+	// Leave out linked issues in projects the caller cannot see
+	principal := currentPrincipal(c)
+	global, err := principal.Can("", "project:view")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return
+	}
+	memberID := ""
+	if !global {
+		memberID = principal.User.ID
+	}
+
+	links, err := getIssueLinks(issue.ID, memberID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch links"})
+		return
+	}
+	blockers, err := openBlockers(issue.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch links"})
+		return
+	}
+	if links == nil {
+		links = []IssueLink{}
+	}
+	c.JSON(http.StatusOK, gin.H{"links": links, "open_blockers": len(blockers)})
+}
+
+func createIssueLinkHandler(c *gin.Context) {
+	issue, ok := loadEditableIssue(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Type    string `json:"type" binding:"required"`
+		IssueID string `json:"issue_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	linkType, ok := linkTypes[body.Type]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Type must be one of blocks, blocked_by, duplicates, duplicated_by or relates_to"})
+		return
+	}
+	if _, err := uuid.Parse(body.IssueID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid issue ID"})
+		return
+	}
+	if body.IssueID == issue.ID {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "An issue cannot be linked to itself"})
+		return
+	}
+	other, err := getIssueByID(body.IssueID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Linked issue not found"})
+		return
+	}
+	if !authorize(c, other.ProjectID, "project:view") {
+		return
+	}
+
+	sourceID, targetID := issue.ID, other.ID
+	if linkType.reversed {
+		sourceID, targetID = targetID, sourceID
+	}
+	userID := c.GetString("user_id")
+	link := IssueLink{
+		ID:              uuid.New().String(),
+		Type:            body.Type,
+		IssueID:         issue.ID,
+		LinkedIssueID:   other.ID,
+		LinkedTitle:     other.Title,
+		LinkedStatus:    other.Status,
+		LinkedProjectID: other.ProjectID,
+		CreatedBy:       strPtr(userID),
+		CreatedAt:       time.Now().Format(time.RFC3339),
+	}
+
+	err = withTx(func(tx *Tx) error {
+		if linkType.stored == "blocks" {
+			// Serialize blocking links so two requests cannot close a cycle
+			// between them
+			if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('issue_links:blocks'))`); err != nil {
+				return err
+			}
+		}
+
+		var exists bool
+		query := `
+		SELECT EXISTS (
+			SELECT 1 FROM issue_links
+			WHERE link_type = $3
+			AND ((source_issue_id = $1 AND target_issue_id = $2)
+				OR ($3 = 'relates_to' AND source_issue_id = $2 AND target_issue_id = $1))
+		)
+		`
+		if err := tx.QueryRow(query, sourceID, targetID, linkType.stored).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return errLinkExists
+		}
+
+		if linkType.stored == "blocks" {
+			cycle, err := blocksReachable(tx, targetID, sourceID)
+			if err != nil {
+				return err
+			}
+			if cycle {
+				return errLinkCycle
+			}
+		}
+
+		query = `
+		INSERT INTO issue_links (id, source_issue_id, target_issue_id, link_type, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		`
+		if _, err := tx.Exec(query, link.ID, sourceID, targetID, linkType.stored, link.CreatedBy, link.CreatedAt); err != nil {
+			log.Printf("Database error creating issue link: %v", err)
+			return err
+		}
+		if err := recordLinkEvents(tx, eventLinkAdded, sourceID, targetID, linkType.stored, userID); err != nil {
+			return err
+		}
+		return emitIssueWebhook(tx, issue.ID, userID, "issue.linked", gin.H{"link": link})
+	})
+	switch {
+	case errors.Is(err, errLinkExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "Issues are already linked"})
+		return
+	case errors.Is(err, errLinkCycle):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Link would create a blocking cycle"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create link"})
+		return
+	}
+	c.JSON(http.StatusCreated, link)
+}
+
+func deleteIssueLinkHandler(c *gin.Context) {
+	issue, ok := loadEditableIssue(c)
+	if !ok {
+		return
+	}
+
+	linkID := c.Param("linkId")
+	if _, err := uuid.Parse(linkID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	err := withTx(func(tx *Tx) error {
+		var sourceID, targetID, linkType string
+		query := `
+		DELETE FROM issue_links
+		WHERE id = $1 AND (source_issue_id = $2 OR target_issue_id = $2)
+		RETURNING source_issue_id, target_issue_id, link_type
+		`
+		if err := tx.QueryRow(query, linkID, issue.ID).Scan(&sourceID, &targetID, &linkType); err != nil {
+			return err
+		}
+		if err := recordLinkEvents(tx, eventLinkRemoved, sourceID, targetID, linkType, userID); err != nil {
+			return err
+		}
+		return emitIssueWebhook(tx, issue.ID, userID, "issue.unlinked", gin.H{"link_id": linkID})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete link"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Link deleted successfully"})
+}
+
+// blocksReachable reports whether "to" can be reached from "from" by
+// following blocks links. A new link where A blocks B closes a cycle exactly
+// when A is reachable from B.
+func blocksReachable(tx *Tx, from, to string) (bool, error) {
+	query := `
+	WITH RECURSIVE reachable(id) AS (
+		SELECT $1::uuid
+		UNION
+		SELECT l.target_issue_id
+		FROM issue_links l
+		JOIN reachable r ON l.source_issue_id = r.id
+		WHERE l.link_type = 'blocks'
+	)
+	SELECT EXISTS (SELECT 1 FROM reachable WHERE id = $2)
+	`
+	var found bool
+	err := tx.QueryRow(query, from, to).Scan(&found)
+	return found, err
+}
+
+// recordLinkEvents records a link change on both issues, each naming the
+// link type from its own side.
+func recordLinkEvents(tx *Tx, eventType, sourceID, targetID, linkType, actorID string) error {
+	sides := []struct{ issueID, field, otherID string }{
+		{sourceID, linkType, targetID},
+		{targetID, inverseLinkTypes[linkType], sourceID},
+	}
+	for _, side := range sides {
+		event := IssueEvent{IssueID: side.issueID, ActorID: strPtr(actorID), EventType: eventType, Field: strPtr(side.field)}
+		if eventType == eventLinkAdded {
+			event.NewValue = strPtr(side.otherID)
+		} else {
+			event.OldValue = strPtr(side.otherID)
+		}
+		if err := recordIssueEvent(tx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkOpenBlockers stops an issue from moving into a done status while
+// issues that block it are still open, when its project asks for that. It
+// writes the error response and returns false if the move is not allowed.
+func checkOpenBlockers(c *gin.Context, issue Issue) bool {
+	project, err := getProjectByID(issue.ProjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load project"})
+		return false
+	}
+	if !project.PreventCloseWithOpenBlockers {
+		return true
+	}
+	blockers, err := openBlockers(issue.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check blockers"})
+		return false
+	}
+	if len(blockers) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Issue has open blockers", "blockers": blockers})
+		return false
+	}
+	return true
+}
+
+// openBlockers returns the IDs of issues blocking an issue whose status is
+// not done in their own project's workflow.
+func openBlockers(issueID string) ([]string, error) {
+	query := `
+	SELECT i.id, i.project_id, i.status
+	FROM issue_links l
+	JOIN issues i ON i.id = l.source_issue_id
+	WHERE l.target_issue_id = $1 AND l.link_type = 'blocks'
+	`
+	rows, err := db.Query(query, issueID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type blocker struct{ id, projectID, status string }
+	var candidates []blocker
+	for rows.Next() {
+		var b blocker
+		if err := rows.Scan(&b.id, &b.projectID, &b.status); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Blockers may live in other projects with their own workflows
+	workflows := map[string]Workflow{}
+	var open []string
+	for _, b := range candidates {
+		workflow, ok := workflows[b.projectID]
+		if !ok {
+			if workflow, err = getProjectWorkflow(b.projectID); err != nil {
+				return nil, err
+			}
+			workflows[b.projectID] = workflow
+		}
+		if !workflow.IsDone(b.status) {
+			open = append(open, b.id)
+		}
+	}
+	return open, nil
+}
+
+// getIssueLinks lists an issue's links from its side. When memberID is set,
+// only linked issues in that user's projects are included.
+func getIssueLinks(issueID, memberID string) ([]IssueLink, error) {
+	query := `
+	SELECT l.id, l.link_type, l.source_issue_id = $1, i.id, i.title, i.status, i.project_id, l.created_by, l.created_at
+	FROM issue_links l
+	JOIN issues i ON i.id = CASE WHEN l.source_issue_id = $1 THEN l.target_issue_id ELSE l.source_issue_id END
+	WHERE (l.source_issue_id = $1 OR l.target_issue_id = $1)`
+	args := []interface{}{issueID}
+	if memberID != "" {
+		query += ` AND i.project_id IN (SELECT project_id FROM project_members WHERE user_id = $2)`
+		args = append(args, memberID)
+	}
+	query += ` ORDER BY l.link_type, l.created_at`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []IssueLink
+	for rows.Next() {
+		var link IssueLink
+		var outgoing bool
+		err := rows.Scan(&link.ID, &link.Type, &outgoing, &link.LinkedIssueID, &link.LinkedTitle, &link.LinkedStatus, &link.LinkedProjectID, &link.CreatedBy, &link.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if !outgoing {
+			link.Type = inverseLinkTypes[link.Type]
+		}
+		link.IssueID = issueID
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	texttemplate "text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	emailMaxAttempts  = 6
+	emailPollInterval = 5 * time.Second
+	emailBatchSize    = 20
+	emailLease        = 2 * time.Minute
+	emailTimeout      = 30 * time.Second
+	emailExcerptLimit = 500
+)
+
+// smtpConfig holds the outgoing mail settings. mailer is nil when SMTP_HOST
+// is not set, which turns email notifications off.
+type smtpConfig struct {
+	addr        string
+	host        string
+	username    string
+	password    string
+	from        string
+	fromAddress string
+	appURL      string
+}
+
+var mailer *smtpConfig
+
+// initMailer reads the SMTP settings from the environment.
+func initMailer() {
+	host := getEnv("SMTP_HOST", "")
+	if host == "" {
+		log.Println("SMTP_HOST not set, email notifications are disabled")
+		return
+	}
+	from := getEnv("SMTP_FROM", "TrackMyBugs <noreply@trackmybugs.local>")
+	address, err := mail.ParseAddress(from)
+	if err != nil {
+		log.Fatal("Invalid SMTP_FROM:", err)
+	}
+	mailer = &smtpConfig{
+		addr:        host + ":" + getEnv("SMTP_PORT", "587"),
+		host:        host,
+		username:    getEnv("SMTP_USERNAME", ""),
+		password:    getEnv("SMTP_PASSWORD", ""),
+		from:        address.String(),
+		fromAddress: address.Address,
+		appURL:      strings.TrimSuffix(getEnv("APP_URL", "http://localhost:3000"), "/"),
+	}
+}
+
+// emailData is what the notification templates are rendered with.
+type emailData struct {
+	Reason        string
+	RecipientName string
+	ActorName     string
+	IssueTitle    string
+	ProjectName   string
+	IssueURL      string
+	OldStatus     string
+	NewStatus     string
+	Comment       string
+}
+
+const emailTextTemplate = `Hi {{.RecipientName}},
+
+{{if eq .Reason "assigned"}}{{.ActorName}} assigned you an issue in {{.ProjectName}}:
+{{else if eq .Reason "mentioned"}}{{.ActorName}} mentioned you in a comment in {{.ProjectName}}:
+{{else if eq .Reason "status_changed"}}{{.ActorName}} moved an issue you follow in {{.ProjectName}} from {{.OldStatus}} to {{.NewStatus}}:
+{{else if eq .Reason "commented"}}{{.ActorName}} commented on an issue you follow in {{.ProjectName}}:
+{{end}}
+  {{.IssueTitle}}
+{{if .Comment}}
+{{.Comment}}
+{{end}}
+View the issue: {{.IssueURL}}
+
+You can change which emails you receive in your notification settings.
+`
+
+const emailHTMLTemplate = `<!DOCTYPE html>
+<html>
+<body style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif; color: #1f2937;">
+<p>Hi {{.RecipientName}},</p>
+<p>
+{{- if eq .Reason "assigned"}}<strong>{{.ActorName}}</strong> assigned you an issue in {{.ProjectName}}:
+{{- else if eq .Reason "mentioned"}}<strong>{{.ActorName}}</strong> mentioned you in a comment in {{.ProjectName}}:
+{{- else if eq .Reason "status_changed"}}<strong>{{.ActorName}}</strong> moved an issue you follow in {{.ProjectName}} from <code>{{.OldStatus}}</code> to <code>{{.NewStatus}}</code>:
+{{- else if eq .Reason "commented"}}<strong>{{.ActorName}}</strong> commented on an issue you follow in {{.ProjectName}}:
+{{- end}}</p>
+<p style="font-size: 16px;"><a href="{{.IssueURL}}">{{.IssueTitle}}</a></p>
+{{- if .Comment}}
+<blockquote style="margin: 0; padding: 8px 12px; border-left: 3px solid #d1d5db; white-space: pre-wrap;">{{.Comment}}</blockquote>
+{{- end}}
+<p style="font-size: 12px; color: #6b7280;">You can change which emails you receive in your notification settings.</p>
+</body>
+</html>
+`
+
+var (
+	emailText = texttemplate.Must(texttemplate.New("text").Parse(emailTextTemplate))
+	emailHTML = htmltemplate.Must(htmltemplate.New("html").Parse(emailHTMLTemplate))
+)
+
+func emailSubject(d emailData) string {
+	switch d.Reason {
+	case notifyAssigned:
+		return fmt.Sprintf("[%s] You were assigned: %s", d.ProjectName, d.IssueTitle)
+	case notifyMentioned:
+		return fmt.Sprintf("[%s] %s mentioned you on: %s", d.ProjectName, d.ActorName, d.IssueTitle)
+	case notifyStatusChanged:
+		return fmt.Sprintf("[%s] %s is now %s", d.ProjectName, d.IssueTitle, d.NewStatus)
+	}
+	return fmt.Sprintf("[%s] %s commented on: %s", d.ProjectName, d.ActorName, d.IssueTitle)
+}
+
+func renderNotificationEmail(d emailData) (subject, text, html string, err error) {
+	var textBody, htmlBody bytes.Buffer
+	if err := emailText.Execute(&textBody, d); err != nil {
+		return "", "", "", err
+	}
+	if err := emailHTML.Execute(&htmlBody, d); err != nil {
+		return "", "", "", err
+	}
+	return emailSubject(d), textBody.String(), htmlBody.String(), nil
+}
+
+// excerpt shortens s to at most limit characters.
+func excerpt(s string, limit int) string {
+	s = strings.TrimSpace(s)
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:limit])) + "…"
+}
+
+// enqueueNotificationEmails renders and queues an email for each recipient
+// whose preferences allow it, as part of the caller's transaction.
+func enqueueNotificationEmails(tx *Tx, n issueNotification, recipientIDs []string) error {
+	if mailer == nil {
+		return nil
+	}
+
+	data := emailData{
+		Reason:    n.Reason,
+		OldStatus: n.OldStatus,
+		NewStatus: n.NewStatus,
+		Comment:   excerpt(n.Comment, emailExcerptLimit),
+		IssueURL:  mailer.appURL + "/issues/" + n.IssueID,
+	}
+	query := `
+	SELECT i.title, p.name, COALESCE((SELECT first_name || ' ' || last_name FROM users WHERE id = $2), 'Someone')
+	FROM issues i
+	JOIN projects p ON p.id = i.project_id
+	WHERE i.id = $1
+	`
+	if err := tx.QueryRow(query, n.IssueID, nilIfEmpty(&n.ActorID)).Scan(&data.IssueTitle, &data.ProjectName, &data.ActorName); err != nil {
+		return err
+	}
+
+	query = `
+	SELECT u.id, u.email, u.first_name,
+		COALESCE(np.email_enabled, TRUE), COALESCE(np.on_assigned, TRUE), COALESCE(np.on_mentioned, TRUE),
+		COALESCE(np.on_status_changed, TRUE), COALESCE(np.on_commented, TRUE)
+	FROM users u
+	LEFT JOIN notification_preferences np ON np.user_id = u.id
+	WHERE u.id = ANY($1)
+	`
+	rows, err := tx.Query(query, pq.Array(recipientIDs))
+	if err != nil {
+		return err
+	}
+	type recipient struct {
+		id, email, name string
+		prefs           NotificationPreferences
+	}
+	var recipients []recipient
+	for rows.Next() {
+		var r recipient
+		err := rows.Scan(&r.id, &r.email, &r.name, &r.prefs.EmailEnabled, &r.prefs.Assigned, &r.prefs.Mentioned, &r.prefs.StatusChanged, &r.prefs.Commented)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		recipients = append(recipients, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, r := range recipients {
+		if !r.prefs.wants(n.Reason) {
+			continue
+		}
+		data.RecipientName = r.name
+		subject, text, html, err := renderNotificationEmail(data)
+		if err != nil {
+			return err
+		}
+		query := `
+		INSERT INTO email_outbox (id, user_id, to_address, subject, text_body, html_body)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		`
+		if _, err := tx.Exec(query, uuid.New().String(), r.id, r.email, subject, text, html); err != nil {
+			log.Printf("Database error queueing email: %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// startEmailDispatcher sends queued emails in the background.
+func startEmailDispatcher() {
+	if mailer == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(emailPollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := dispatchEmails(); err != nil {
+				log.Printf("Email dispatch error: %v", err)
+			}
+		}
+	}()
+}
+
+type pendingEmail struct {
+	id       string
+	to       string
+	subject  string
+	text     string
+	html     string
+	attempts int
+	// lease is the next_attempt_at this dispatcher last set on the row
+	lease time.Time
+}
+
+// dispatchEmails claims a batch of due emails and sends them, leasing and
+// renewing the rows the same way dispatchWebhooks does.
+func dispatchEmails() error {
+	var batch []pendingEmail
+	err := withTx(func(tx *Tx) error {
+		query := `
+		SELECT id, to_address, subject, text_body, html_body, attempts
+		FROM email_outbox
+		WHERE status = 'pending' AND next_attempt_at <= NOW()
+		ORDER BY next_attempt_at ASC
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+		`
+		rows, err := tx.Query(query, emailBatchSize)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var e pendingEmail
+			if err := rows.Scan(&e.id, &e.to, &e.subject, &e.text, &e.html, &e.attempts); err != nil {
+				return err
+			}
+			batch = append(batch, e)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		lease := queueLease(emailLease)
+		for i := range batch {
+			query := `UPDATE email_outbox SET next_attempt_at = $1 WHERE id = $2`
+			if _, err := tx.Exec(query, lease, batch[i].id); err != nil {
+				return err
+			}
+			batch[i].lease = lease
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range batch {
+		held, err := renewEmailLease(&e)
+		if err != nil {
+			return err
+		}
+		if !held {
+			continue
+		}
+		sendErr := sendEmail(mailer, e)
+		if err := recordEmailAttempt(e, sendErr); err != nil {
+			log.Printf("Database error recording email attempt: %v", err)
+		}
+	}
+	return nil
+}
+
+// renewEmailLease extends the lease on a claimed email for one more send. It
+// reports false when the lease lapsed and another dispatcher has claimed the
+// row since.
+func renewEmailLease(e *pendingEmail) (bool, error) {
+	lease := queueLease(emailLease)
+	query := `
+	UPDATE email_outbox SET next_attempt_at = $1
+	WHERE id = $2 AND status = 'pending' AND next_attempt_at = $3
+	`
+	result, err := db.Exec(query, lease, e.id, e.lease)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	e.lease = lease
+	return true, nil
+}
+
+// sendEmail delivers one message, as smtp.SendMail does but with a deadline
+// on the whole conversation so a stalled server cannot outlast the lease.
+func sendEmail(cfg *smtpConfig, e pendingEmail) error {
+	msg, err := buildEmailMessage(cfg.from, e)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("tcp", cfg.addr, emailTimeout)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(emailTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	client, err := smtp.NewClient(conn, cfg.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: cfg.host}); err != nil {
+			return err
+		}
+	}
+	if cfg.username != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return fmt.Errorf("smtp: server doesn't support AUTH")
+		}
+		if err := client.Auth(smtp.PlainAuth("", cfg.username, cfg.password, cfg.host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(cfg.fromAddress); err != nil {
+		return err
+	}
+	if err := client.Rcpt(e.to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildEmailMessage encodes a multipart/alternative message with text and
+// HTML versions of the body.
+func buildEmailMessage(from string, e pendingEmail) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, alt := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", e.text},
+		{"text/html; charset=utf-8", e.html},
+	} {
+		part, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {alt.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(part)
+		if _, err := qp.Write([]byte(alt.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	headers := []string{
+		"From: " + from,
+		"To: " + (&mail.Address{Address: e.to}).String(),
+		"Subject: " + mime.QEncoding.Encode("utf-8", e.subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: <" + e.id + "@trackmybugs>",
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + parts.Boundary(),
+	}
+	msg.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+func recordEmailAttempt(e pendingEmail, sendErr error) error {
+	attempts := e.attempts + 1
+	if sendErr == nil {
+		query := `
+		UPDATE email_outbox
+		SET status = 'sent', attempts = $1, last_error = NULL, sent_at = NOW(), next_attempt_at = NULL
+		WHERE id = $2 AND next_attempt_at = $3
+		`
+		_, err := db.Exec(query, attempts, e.id, e.lease)
+		return err
+	}
+
+	status := "pending"
+	var next *time.Time
+	if attempts >= emailMaxAttempts {
+		status = "failed"
+	} else {
+		t := time.Now().Add(retryBackoff(attempts))
+		next = &t
+	}
+	query := `
+	UPDATE email_outbox
+	SET status = $1, attempts = $2, last_error = $3, next_attempt_at = $4
+	WHERE id = $5 AND next_attempt_at = $6
+	`
+	_, err := db.Exec(query, status, attempts, sendErr.Error(), next, e.id, e.lease)
+	return err
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// fakeSMTPServer accepts one connection and speaks just enough SMTP to take a
+// message. rejectRcpt makes it refuse the recipient.
+type fakeSMTPServer struct {
+	addr       string
+	rejectRcpt bool
+	from       string
+	rcpt       []string
+	data       []byte
+	done       chan struct{}
+}
+
+func startFakeSMTP(t *testing.T, rejectRcpt bool) *fakeSMTPServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &fakeSMTPServer{addr: ln.Addr().String(), rejectRcpt: rejectRcpt, done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s.serve(textproto.NewConn(conn))
+	}()
+	return s
+}
+
+func (s *fakeSMTPServer) serve(c *textproto.Conn) {
+	c.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			c.PrintfLine("250-fake")
+			c.PrintfLine("250 8BITMIME")
+		case "MAIL":
+			s.from = smtpPath(arg)
+			c.PrintfLine("250 OK")
+		case "RCPT":
+			if s.rejectRcpt {
+				c.PrintfLine("550 No such user")
+				continue
+			}
+			s.rcpt = append(s.rcpt, smtpPath(arg))
+			c.PrintfLine("250 OK")
+		case "DATA":
+			c.PrintfLine("354 Go ahead")
+			s.data, err = c.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			c.PrintfLine("250 Queued")
+		case "QUIT":
+			c.PrintfLine("221 Bye")
+			return
+		default:
+			c.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+// smtpPath returns the address between the angle brackets of a MAIL or RCPT
+// argument, ignoring any parameters after it.
+func smtpPath(arg string) string {
+	_, rest, _ := strings.Cut(arg, "<")
+	path, _, _ := strings.Cut(rest, ">")
+	return path
+}
+
+func TestSendEmailDeliversMultipartMessage(t *testing.T) {
+	server := startFakeSMTP(t, false)
+	cfg := &smtpConfig{
+		addr:        server.addr,
+		host:        "127.0.0.1",
+		from:        "TrackMyBugs <noreply@trackmybugs.local>",
+		fromAddress: "noreply@trackmybugs.local",
+	}
+	e := pendingEmail{
+		id:      "e1",
+		to:      "ada@example.com",
+		subject: "[Bugs] Ünïcode title",
+		text:    "Plain body",
+		html:    "<p>HTML body</p>",
+	}
+
+	if err := sendEmail(cfg, e); err != nil {
+		t.Fatalf("sendEmail: %v", err)
+	}
+	<-server.done
+
+	if server.from != "noreply@trackmybugs.local" {
+		t.Errorf("MAIL FROM = %q", server.from)
+	}
+	if len(server.rcpt) != 1 || server.rcpt[0] != "ada@example.com" {
+		t.Errorf("RCPT TO = %v", server.rcpt)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(server.data)))
+	if err != nil {
+		t.Fatalf("reading message: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != e.subject {
+		t.Errorf("Subject = %q (%v), want %q", subject, err, e.subject)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q (%v)", msg.Header.Get("Content-Type"), err)
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	bodies := map[string]string{}
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		// NextPart decodes quoted-printable parts
+		body, _ := io.ReadAll(part)
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		bodies[contentType] = string(body)
+	}
+	if bodies["text/plain"] != e.text || bodies["text/html"] != e.html {
+		t.Errorf("parts = %v", bodies)
+	}
+}
+
+func TestSendEmailRejectedRecipient(t *testing.T) {
+	server := startFakeSMTP(t, true)
+	cfg := &smtpConfig{addr: server.addr, host: "127.0.0.1", from: "noreply@trackmybugs.local", fromAddress: "noreply@trackmybugs.local"}
+
+	err := sendEmail(cfg, pendingEmail{id: "e2", to: "nobody@example.com", subject: "s", text: "t", html: "h"})
+	if err == nil || !strings.Contains(err.Error(), "550") {
+		t.Fatalf("sendEmail = %v, want a 550 error", err)
+	}
+}
@@ -24,6 +24,16 @@ func main() {
 	// Initialize database connection
 	initDB()
 
+	// Set up attachment storage
+	initStorage()
+
+	// Start delivering queued webhooks and emails and running imports in the
+	// background
+	startWebhookDispatcher()
+	initMailer()
+	startEmailDispatcher()
+	startImportRunner()
+
 	// Set Gin mode
 	if os.Getenv("GIN_MODE") == "release" {
 		gin.SetMode(gin.ReleaseMode)
@@ -51,8 +61,18 @@ func main() {
 		{
 			auth.POST("/register", registerHandler)
 			auth.POST("/login", loginHandler)
+			auth.POST("/refresh", refreshHandler)
+			auth.POST("/logout", authMiddleware(), logoutHandler)
+			auth.POST("/logout-all", authMiddleware(), logoutAllHandler)
+			auth.GET("/sessions", authMiddleware(), getSessionsHandler)
 		}
 
+		// Signed attachment links carry their own authorization
+		api.GET("/attachments/:id/content", signedAttachmentHandler)
+
+		// Git hosts authenticate with the hook's secret
+		api.POST("/git-hooks/:hookId", receiveGitHookHandler)
+
 		// Protected routes
 		protected := api.Group("/")
 		protected.Use(authMiddleware())
@@ -61,10 +81,52 @@ func main() {
 			projects := protected.Group("/projects")
 			{
 				projects.GET("", getProjectsHandler)
-				projects.POST("", createProjectHandler)
-				projects.GET("/:id", getProjectHandler)
-				projects.PUT("/:id", updateProjectHandler)
-				projects.DELETE("/:id", adminOnly(), deleteProjectHandler)
+				projects.POST("", requirePermission("project:create", globalScope), createProjectHandler)
+				projects.GET("/:id", requirePermission("project:view", projectScope("id")), getProjectHandler)
+				projects.PUT("/:id", requirePermission("project:update", projectScope("id")), updateProjectHandler)
+				projects.DELETE("/:id", requirePermission("project:delete", projectScope("id")), deleteProjectHandler)
+				projects.GET("/:id/members", requirePermission("project:view", projectScope("id")), getProjectMembersHandler)
+				projects.POST("/:id/members", requirePermission("project:manage_members", projectScope("id")), addProjectMemberHandler)
+				projects.PUT("/:id/members/:userId", requirePermission("project:manage_members", projectScope("id")), updateProjectMemberHandler)
+				projects.DELETE("/:id/members/:userId", requirePermission("project:view", projectScope("id")), removeProjectMemberHandler)
+				projects.GET("/:id/workflow", requirePermission("project:view", projectScope("id")), getWorkflowHandler)
+				projects.PUT("/:id/workflow", requirePermission("project:manage_workflow", projectScope("id")), updateWorkflowHandler)
+				projects.DELETE("/:id/workflow", requirePermission("project:manage_workflow", projectScope("id")), resetWorkflowHandler)
+				projects.GET("/:id/webhooks", requirePermission("project:manage_webhooks", projectScope("id")), getWebhooksHandler)
+				projects.POST("/:id/webhooks", requirePermission("project:manage_webhooks", projectScope("id")), createWebhookHandler)
+				projects.GET("/:id/webhooks/:hookId", requirePermission("project:manage_webhooks", projectScope("id")), getWebhookHandler)
+				projects.PUT("/:id/webhooks/:hookId", requirePermission("project:manage_webhooks", projectScope("id")), updateWebhookHandler)
+				projects.DELETE("/:id/webhooks/:hookId", requirePermission("project:manage_webhooks", projectScope("id")), deleteWebhookHandler)
+				projects.GET("/:id/webhooks/:hookId/deliveries", requirePermission("project:manage_webhooks", projectScope("id")), getWebhookDeliveriesHandler)
+				projects.POST("/:id/webhooks/:hookId/deliveries/:deliveryId/redeliver", requirePermission("project:manage_webhooks", projectScope("id")), redeliverWebhookHandler)
+				projects.GET("/:id/git-hooks", requirePermission("project:manage_webhooks", projectScope("id")), getGitHooksHandler)
+				projects.POST("/:id/git-hooks", requirePermission("project:manage_webhooks", projectScope("id")), createGitHookHandler)
+				projects.DELETE("/:id/git-hooks/:hookId", requirePermission("project:manage_webhooks", projectScope("id")), deleteGitHookHandler)
+				projects.GET("/:id/attachments/usage", requirePermission("project:view", projectScope("id")), getAttachmentUsageHandler)
+				projects.PUT("/:id/attachments/quota", requirePermission("project:manage_quota", projectScope("id")), updateAttachmentQuotaHandler)
+				projects.GET("/:id/labels", requirePermission("project:view", projectScope("id")), getLabelsHandler)
+				projects.POST("/:id/labels", requirePermission("project:manage_labels", projectScope("id")), createLabelHandler)
+				projects.PUT("/:id/labels/:labelId", requirePermission("project:manage_labels", projectScope("id")), updateLabelHandler)
+				projects.DELETE("/:id/labels/:labelId", requirePermission("project:manage_labels", projectScope("id")), deleteLabelHandler)
+				projects.GET("/:id/milestones", requirePermission("project:view", projectScope("id")), getMilestonesHandler)
+				projects.POST("/:id/milestones", requirePermission("project:manage_milestones", projectScope("id")), createMilestoneHandler)
+				projects.GET("/:id/milestones/:mid", requirePermission("project:view", projectScope("id")), getMilestoneHandler)
+				projects.PUT("/:id/milestones/:mid", requirePermission("project:manage_milestones", projectScope("id")), updateMilestoneHandler)
+				projects.DELETE("/:id/milestones/:mid", requirePermission("project:manage_milestones", projectScope("id")), deleteMilestoneHandler)
+				projects.GET("/:id/sprints", requirePermission("project:view", projectScope("id")), getSprintsHandler)
+				projects.POST("/:id/sprints", requirePermission("project:manage_sprints", projectScope("id")), createSprintHandler)
+				projects.GET("/:id/sprints/:sid", requirePermission("project:view", projectScope("id")), getSprintHandler)
+				projects.PUT("/:id/sprints/:sid", requirePermission("project:manage_sprints", projectScope("id")), updateSprintHandler)
+				projects.DELETE("/:id/sprints/:sid", requirePermission("project:manage_sprints", projectScope("id")), deleteSprintHandler)
+				projects.POST("/:id/sprints/:sid/start", requirePermission("project:manage_sprints", projectScope("id")), startSprintHandler)
+				projects.POST("/:id/sprints/:sid/complete", requirePermission("project:manage_sprints", projectScope("id")), completeSprintHandler)
+				projects.POST("/:id/sprints/:sid/issues", requirePermission("project:manage_sprints", projectScope("id")), addSprintIssuesHandler)
+				projects.GET("/:id/backlog", requirePermission("project:view", projectScope("id")), getBacklogHandler)
+				projects.GET("/:id/issues/export", requirePermission("project:view", projectScope("id")), exportIssuesHandler)
+				projects.GET("/:id/imports", requirePermission("project:import", projectScope("id")), getImportJobsHandler)
+				projects.POST("/:id/imports", requirePermission("project:import", projectScope("id")), createImportJobHandler)
+				projects.GET("/:id/imports/:jobId", requirePermission("project:import", projectScope("id")), getImportJobHandler)
+				projects.POST("/:id/backlog", requirePermission("project:manage_sprints", projectScope("id")), moveToBacklogHandler)
 			}
 
 			// Issues
@@ -72,18 +134,42 @@ func main() {
 			{
 				issues.GET("", getIssuesHandler)
 				issues.POST("", createIssueHandler)
-				issues.GET("/:id", getIssueHandler)
-				issues.PUT("/:id", updateIssueHandler)
-				issues.DELETE("/:id", deleteIssueHandler)
+				issues.GET("/:id", requirePermission("project:view", issueScope("id")), getIssueHandler)
+				issues.PUT("/:id", requirePermission("project:view", issueScope("id")), updateIssueHandler)
+				issues.DELETE("/:id", requirePermission("project:view", issueScope("id")), deleteIssueHandler)
+				issues.PUT("/:id/assignee", requirePermission("issue:assign", issueScope("id")), updateIssueAssigneeHandler)
+				issues.GET("/:id/assignments", requirePermission("project:view", issueScope("id")), getIssueAssignmentsHandler)
+				issues.GET("/:id/watchers", requirePermission("project:view", issueScope("id")), getIssueWatchersHandler)
+				issues.POST("/:id/watch", requirePermission("project:view", issueScope("id")), watchIssueHandler)
+				issues.DELETE("/:id/watch", requirePermission("project:view", issueScope("id")), unwatchIssueHandler)
+				issues.PUT("/:id/labels/:labelId", requirePermission("project:view", issueScope("id")), addIssueLabelHandler)
+				issues.DELETE("/:id/labels/:labelId", requirePermission("project:view", issueScope("id")), removeIssueLabelHandler)
+				issues.GET("/:id/children", requirePermission("project:view", issueScope("id")), getIssueChildrenHandler)
+				issues.GET("/:id/commits", requirePermission("project:view", issueScope("id")), getIssueCommitsHandler)
+				issues.GET("/:id/links", requirePermission("project:view", issueScope("id")), getIssueLinksHandler)
+				issues.POST("/:id/links", requirePermission("project:view", issueScope("id")), createIssueLinkHandler)
+				issues.DELETE("/:id/links/:linkId", requirePermission("project:view", issueScope("id")), deleteIssueLinkHandler)
+				issues.GET("/:id/activity", requirePermission("project:view", issueScope("id")), getIssueActivityHandler)
+				issues.GET("/:id/attachments", requirePermission("project:view", issueScope("id")), getIssueAttachmentsHandler)
+				issues.POST("/:id/attachments", requirePermission("attachment:create", issueScope("id")), uploadIssueAttachmentHandler)
 			}
 
 			// Comments
 			comments := protected.Group("/comments")
 			{
-				comments.GET("/issue/:issueId", getCommentsHandler)
+				comments.GET("/issue/:issueId", requirePermission("project:view", issueScope("issueId")), getCommentsHandler)
 				comments.POST("", createCommentHandler)
-				comments.PUT("/:id", updateCommentHandler)
-				comments.DELETE("/:id", deleteCommentHandler)
+				comments.PUT("/:id", requirePermission("project:view", commentScope("id")), updateCommentHandler)
+				comments.DELETE("/:id", requirePermission("project:view", commentScope("id")), deleteCommentHandler)
+				comments.POST("/:id/attachments", requirePermission("attachment:create", commentScope("id")), uploadCommentAttachmentHandler)
+			}
+
+			// Attachments
+			attachments := protected.Group("/attachments")
+			{
+				attachments.GET("/:id", requirePermission("project:view", attachmentScope("id")), getAttachmentHandler)
+				attachments.GET("/:id/download", requirePermission("project:view", attachmentScope("id")), downloadAttachmentHandler)
+				attachments.DELETE("/:id", requirePermission("project:view", attachmentScope("id")), deleteAttachmentHandler)
 			}
 
 			// Users
@@ -92,8 +178,35 @@ func main() {
 				users.GET("", getUsersHandler)
 				users.GET("/profile", getProfileHandler)
 				users.PUT("/profile", updateProfileHandler)
-				users.PUT("/:id/role", adminOnly(), updateUserRoleHandler)
+				users.GET("/me/notification-preferences", getNotificationPreferencesHandler)
+				users.PUT("/me/notification-preferences", updateNotificationPreferencesHandler)
+				users.GET("/me/mentions", getMyMentionsHandler)
+				users.PUT("/:id/role", requirePermission("user:manage_roles", globalScope), updateUserRoleHandler)
 			}
+
+			// Saved filters
+			filters := protected.Group("/filters")
+			{
+				filters.GET("", getSavedFiltersHandler)
+				filters.POST("", createSavedFilterHandler)
+				filters.GET("/:id", getSavedFilterHandler)
+				filters.PUT("/:id", updateSavedFilterHandler)
+				filters.DELETE("/:id", deleteSavedFilterHandler)
+			}
+
+			// Notification inbox
+			notifications := protected.Group("/notifications")
+			{
+				notifications.GET("", getNotificationsHandler)
+				notifications.POST("/read-all", markAllNotificationsReadHandler)
+				notifications.POST("/:id/read", markNotificationReadHandler)
+			}
+
+			// Search
+			protected.GET("/search", searchHandler)
+
+			// Live updates
+			protected.GET("/events", streamEventsHandler)
 		}
 	}
 
@@ -138,6 +251,42 @@ func initDB() {
 	log.Println("Successfully connected to database")
 }
 
+// Tx is a transaction started by withTx. It carries the callbacks to run once
+// it commits.
+type Tx struct {
+	*sql.Tx
+	onCommit []func()
+}
+
+// AfterCommit runs fn after the transaction commits. It is dropped if the
+// transaction rolls back.
+func (tx *Tx) AfterCommit(fn func()) {
+	tx.onCommit = append(tx.onCommit, fn)
+}
+
+// withTx runs fn in a transaction, committing if it returns nil and rolling
+// back otherwise. Callbacks registered with AfterCommit run once the commit
+// succeeds.
+func withTx(fn func(tx *Tx) error) error {
+	sqlTx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer sqlTx.Rollback()
+
+	tx := &Tx{Tx: sqlTx}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := sqlTx.Commit(); err != nil {
+		return err
+	}
+	for _, hook := range tx.onCommit {
+		hook()
+	}
+	return nil
+}
+
 // CORS middleware
 func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func getProjectMemberRole(projectID, userID string) (string, error) {
+	var role string
+	query := `SELECT role FROM project_members WHERE project_id = $1 AND user_id = $2`
+	err := db.QueryRow(query, projectID, userID).Scan(&role)
+	return role, err
+}
+
+func getProjectMembersHandler(c *gin.Context) {
+	projectID := c.Param("id")
+	members, err := getProjectMembers(projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch members"})
+		return
+	}
+	if members == nil {
+		members = []ProjectMember{}
+	}
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+func addProjectMemberHandler(c *gin.Context) {
+	projectID := c.Param("id")
+
+	var body struct {
+		UserID string `json:"user_id"`
+		Email  string `json:"email"`
+		Role   string `json:"role" binding:"required,oneof=owner maintainer reporter viewer"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if body.Role == "owner" && !authorize(c, projectID, "project:manage_owners") {
+		return
+	}
+
+	var user User
+	var err error
+	switch {
+	case body.UserID != "":
+		user, err = getUserByID(body.UserID)
+	case body.Email != "":
+		user, err = getUserByEmail(body.Email)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id or email is required"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if _, err := getProjectMemberRole(projectID, user.ID); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already a member of this project"})
+		return
+	}
+
+	if err := addProjectMember(db, projectID, user.ID, body.Role); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add member"})
+		return
+	}
+
+	member, err := getProjectMember(projectID, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch member"})
+		return
+	}
+	c.JSON(http.StatusCreated, member)
+}
+
+func updateProjectMemberHandler(c *gin.Context) {
+	projectID := c.Param("id")
+	userID := c.Param("userId")
+
+	var body struct {
+		Role string `json:"role" binding:"required,oneof=owner maintainer reporter viewer"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	currentRole, err := getProjectMemberRole(projectID, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+
+	// Only owners may hand out or take away ownership
+	if (body.Role == "owner" || currentRole == "owner") && !authorize(c, projectID, "project:manage_owners") {
+		return
+	}
+
+	err = withTx(func(tx *Tx) error {
+		if body.Role != "owner" {
+			if err := checkOtherOwner(tx, projectID, userID); err != nil {
+				return err
+			}
+		}
+		return setProjectMemberRole(tx, projectID, userID, body.Role)
+	})
+	if errors.Is(err, errLastOwner) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A project must have at least one owner"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update member"})
+		return
+	}
+
+	member, err := getProjectMember(projectID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch member"})
+		return
+	}
+	c.JSON(http.StatusOK, member)
+}
+
+func removeProjectMemberHandler(c *gin.Context) {
+	projectID := c.Param("id")
+	userID := c.Param("userId")
+
+	currentRole, err := getProjectMemberRole(projectID, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+
+	// Members may always leave a project themselves
+	if userID != c.GetString("user_id") {
+		perm := "project:manage_members"
+		if currentRole == "owner" {
+			perm = "project:manage_owners"
+		}
+		if !authorize(c, projectID, perm) {
+			return
+		}
+	}
+
+	err = withTx(func(tx *Tx) error {
+		if err := checkOtherOwner(tx, projectID, userID); err != nil {
+			return err
+		}
+		return removeProjectMember(tx, projectID, userID)
+	})
+	if errors.Is(err, errLastOwner) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A project must have at least one owner"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+}
+
+var errLastOwner = errors.New("a project must have at least one owner")
+
+// checkOtherOwner returns errLastOwner if userID is the project's only owner.
+// It locks the owner rows, so concurrent demotions and removals are checked
+// one after another and cannot together leave the project without an owner.
+func checkOtherOwner(tx *Tx, projectID, userID string) error {
+	query := `SELECT user_id FROM project_members WHERE project_id = $1 AND role = 'owner' FOR UPDATE`
+	rows, err := tx.Query(query, projectID)
+	if err != nil {
+		log.Printf("Database error checking project owners: %v", err)
+		return err
+	}
+	defer rows.Close()
+
+	isOwner, others := false, 0
+	for rows.Next() {
+		var ownerID string
+		if err := rows.Scan(&ownerID); err != nil {
+			return err
+		}
+		if ownerID == userID {
+			isOwner = true
+		} else {
+			others++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Database error checking project owners: %v", err)
+		return err
+	}
+	if isOwner && others == 0 {
+		return errLastOwner
+	}
+	return nil
+}
+
+// execer is satisfied by both *sql.DB and *Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func addProjectMember(e execer, projectID, userID, role string) error {
+	now := time.Now().Format(time.RFC3339)
+	query := `
+	INSERT INTO project_members (project_id, user_id, role, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := e.Exec(query, projectID, userID, role, now, now)
+	if err != nil {
+		log.Printf("Database error adding project member: %v", err)
+	}
+	return err
+}
+
+func getProjectMember(projectID, userID string) (ProjectMember, error) {
+	var member ProjectMember
+	query := `
+	SELECT pm.project_id, pm.user_id, u.email, u.first_name, u.last_name, pm.role, pm.created_at, pm.updated_at
+	FROM project_members pm
+	JOIN users u ON u.id = pm.user_id
+	WHERE pm.project_id = $1 AND pm.user_id = $2
+	`
+	err := db.QueryRow(query, projectID, userID).Scan(&member.ProjectID, &member.UserID, &member.Email, &member.FirstName, &member.LastName, &member.Role, &member.CreatedAt, &member.UpdatedAt)
+	return member, err
+}
+
+func getProjectMembers(projectID string) ([]ProjectMember, error) {
+	query := `
+	SELECT pm.project_id, pm.user_id, u.email, u.first_name, u.last_name, pm.role, pm.created_at, pm.updated_at
+	FROM project_members pm
+	JOIN users u ON u.id = pm.user_id
+	WHERE pm.project_id = $1
+	ORDER BY pm.created_at ASC
+	`
+	rows, err := db.Query(query, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []ProjectMember
+	for rows.Next() {
+		var member ProjectMember
+		err := rows.Scan(&member.ProjectID, &member.UserID, &member.Email, &member.FirstName, &member.LastName, &member.Role, &member.CreatedAt, &member.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+func setProjectMemberRole(e execer, projectID, userID, role string) error {
+	query := `UPDATE project_members SET role = $1 WHERE project_id = $2 AND user_id = $3`
+	_, err := e.Exec(query, role, projectID, userID)
+	if err != nil {
+		log.Printf("Database error updating project member: %v", err)
+	}
+	return err
+}
+
+func removeProjectMember(e execer, projectID, userID string) error {
+	query := `DELETE FROM project_members WHERE project_id = $1 AND user_id = $2`
+	_, err := e.Exec(query, projectID, userID)
+	if err != nil {
+		log.Printf("Database error removing project member: %v", err)
+	}
+	return err
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// mentionPattern matches @user@example.com mentions of an email address and
+// @user mentions of a handle, the part of an email before the @.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([A-Za-z0-9._%+-]+(?:@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)+)?)`)
+
+// queryer is implemented by both *sql.DB and *Tx.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func getMyMentionsHandler(c *gin.Context) {
+	principal := currentPrincipal(c)
+	limit := 10
+	offset := 0
+	if l := c.Query("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if v, err := strconv.Atoi(o); err == nil && v >= 0 {
+			offset = v
+		}
+	}
+
+	// Leave out projects the user has since lost access to
+	global, err := principal.Can("", "project:view")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return
+	}
+	scope := ""
+	if !global {
+		scope = ` AND i.project_id IN (SELECT project_id FROM project_members WHERE user_id = $1)`
+	}
+
+	total, err := countUserMentions(principal.User.ID, scope)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count mentions"})
+		return
+	}
+	mentions, err := getUserMentionsPaginated(principal.User.ID, scope, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch mentions"})
+		return
+	}
+	if mentions == nil {
+		mentions = []UserMention{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"mentions": mentions,
+		"total":    total,
+		"limit":    limit,
+		"offset":   offset,
+		"message":  "Mentions fetched successfully",
+	})
+}
+
+// parseMentions returns the lowercased emails and handles mentioned in
+// content, in order of first appearance.
+func parseMentions(content string) []string {
+	seen := map[string]bool{}
+	var tokens []string
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		token := strings.ToLower(strings.TrimRight(match[1], "."))
+		if token != "" && !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// resolveMentions maps the mentions in content to users who can see the
+// issue's project. A handle only counts when exactly one such user has it.
+func resolveMentions(tx *Tx, issueID, content string) ([]string, error) {
+	tokens := parseMentions(content)
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	query := `
+	SELECT t.token, u.id
+	FROM unnest($2::text[]) AS t(token)
+	JOIN users u ON LOWER(u.email) = t.token
+		OR (strpos(t.token, '@') = 0 AND LOWER(split_part(u.email, '@', 1)) = t.token)
+	JOIN issues i ON i.id = $1
+	WHERE ` + canViewProjectSQL("i.project_id", "u.id", "u.role")
+	rows, err := tx.Query(query, issueID, pq.Array(tokens))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	matches := map[string][]string{}
+	for rows.Next() {
+		var token, userID string
+		if err := rows.Scan(&token, &userID); err != nil {
+			return nil, err
+		}
+		matches[token] = append(matches[token], userID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var ids []string
+	for _, token := range tokens {
+		if users := matches[token]; len(users) == 1 && !seen[users[0]] {
+			seen[users[0]] = true
+			ids = append(ids, users[0])
+		}
+	}
+	return ids, nil
+}
+
+// setCommentMentions stores the users mentioned in the comment's content,
+// replacing any earlier mentions, and fills in comment.Mentions. It returns
+// the users who were not mentioned before.
+func setCommentMentions(tx *Tx, comment *Comment) ([]string, error) {
+	mentioned, err := resolveMentions(tx, comment.IssueID, comment.Content)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := queryIDs(tx, `SELECT user_id FROM comment_mentions WHERE comment_id = $1`, comment.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := pq.Array(nonNilIDs(mentioned))
+	query := `DELETE FROM comment_mentions WHERE comment_id = $1 AND NOT (user_id = ANY($2::uuid[]))`
+	if _, err := tx.Exec(query, comment.ID, ids); err != nil {
+		log.Printf("Database error removing comment mentions: %v", err)
+		return nil, err
+	}
+	query = `
+	INSERT INTO comment_mentions (comment_id, user_id)
+	SELECT $1, unnest($2::uuid[])
+	ON CONFLICT DO NOTHING
+	`
+	if _, err := tx.Exec(query, comment.ID, ids); err != nil {
+		log.Printf("Database error saving comment mentions: %v", err)
+		return nil, err
+	}
+
+	mentions, err := getCommentMentions(tx, []string{comment.ID})
+	if err != nil {
+		return nil, err
+	}
+	comment.Mentions = mentions[comment.ID]
+	if comment.Mentions == nil {
+		comment.Mentions = []Mention{}
+	}
+	return subtractIDs(mentioned, previous), nil
+}
+
+// getCommentMentions loads the users mentioned in each of the comments.
+func getCommentMentions(q queryer, commentIDs []string) (map[string][]Mention, error) {
+	query := `
+	SELECT m.comment_id, u.id, u.email, u.first_name, u.last_name
+	FROM comment_mentions m
+	JOIN users u ON u.id = m.user_id
+	WHERE m.comment_id = ANY($1::uuid[])
+	ORDER BY m.created_at, u.email
+	`
+	rows, err := q.Query(query, pq.Array(commentIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mentions := map[string][]Mention{}
+	for rows.Next() {
+		var commentID string
+		var m Mention
+		if err := rows.Scan(&commentID, &m.UserID, &m.Email, &m.FirstName, &m.LastName); err != nil {
+			return nil, err
+		}
+		mentions[commentID] = append(mentions[commentID], m)
+	}
+	return mentions, rows.Err()
+}
+
+// attachCommentMentions fills in Mentions on each comment.
+func attachCommentMentions(comments []Comment) error {
+	if len(comments) == 0 {
+		return nil
+	}
+	ids := make([]string, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID
+	}
+	mentions, err := getCommentMentions(db, ids)
+	if err != nil {
+		return err
+	}
+	for i := range comments {
+		comments[i].Mentions = mentions[comments[i].ID]
+		if comments[i].Mentions == nil {
+			comments[i].Mentions = []Mention{}
+		}
+	}
+	return nil
+}
+
+func countUserMentions(userID, scope string) (int, error) {
+	var total int
+	query := `
+	SELECT COUNT(*)
+	FROM comment_mentions m
+	JOIN comments cm ON cm.id = m.comment_id
+	JOIN issues i ON i.id = cm.issue_id
+	WHERE m.user_id = $1` + scope
+	err := db.QueryRow(query, userID).Scan(&total)
+	return total, err
+}
+
+func getUserMentionsPaginated(userID, scope string, limit, offset int) ([]UserMention, error) {
+	query := `
+	SELECT cm.id, cm.issue_id, i.title, i.project_id, cm.created_by, u.first_name || ' ' || u.last_name,
+		cm.content, m.created_at
+	FROM comment_mentions m
+	JOIN comments cm ON cm.id = m.comment_id
+	JOIN issues i ON i.id = cm.issue_id
+	JOIN users u ON u.id = cm.created_by
+	WHERE m.user_id = $1` + scope + `
+	ORDER BY m.created_at DESC, cm.id
+	LIMIT $2 OFFSET $3
+	`
+	rows, err := db.Query(query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mentions []UserMention
+	for rows.Next() {
+		var m UserMention
+		err := rows.Scan(&m.CommentID, &m.IssueID, &m.IssueTitle, &m.ProjectID, &m.AuthorID, &m.AuthorName, &m.Content, &m.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, m)
+	}
+	return mentions, rows.Err()
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var errInvalidMilestone = errors.New("milestone does not belong to the project")
+
+func getMilestonesHandler(c *gin.Context) {
+	projectID := c.Param("id")
+	state := c.DefaultQuery("state", "all")
+	if state != "all" && state != "open" && state != "closed" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "State must be one of all, open or closed"})
+		return
+	}
+
+	milestones, err := getMilestonesByProject(projectID, state)
+	if err == nil {
+		err = attachMilestoneProgress(projectID, milestones)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch milestones"})
+		return
+	}
+	if milestones == nil {
+		milestones = []Milestone{}
+	}
+	c.JSON(http.StatusOK, gin.H{"milestones": milestones})
+}
+
+func getMilestoneHandler(c *gin.Context) {
+	projectID := c.Param("id")
+	milestone, err := getMilestoneByID(projectID, c.Param("mid"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Milestone not found"})
+		return
+	}
+	milestones := []Milestone{milestone}
+	if err := attachMilestoneProgress(projectID, milestones); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute milestone progress"})
+		return
+	}
+	c.JSON(http.StatusOK, milestones[0])
+}
+
+func createMilestoneHandler(c *gin.Context) {
+	var body struct {
+		Title       string  `json:"title" binding:"required"`
+		Description string  `json:"description"`
+		DueDate     *string `json:"due_date"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	milestone := Milestone{
+		ID:          uuid.New().String(),
+		ProjectID:   c.Param("id"),
+		Title:       strings.TrimSpace(body.Title),
+		Description: body.Description,
+		DueDate:     nilIfEmpty(body.DueDate),
+		State:       "open",
+		CreatedBy:   strPtr(c.GetString("user_id")),
+		CreatedAt:   time.Now().Format(time.RFC3339),
+	}
+	milestone.UpdatedAt = milestone.CreatedAt
+	if !validateMilestone(c, milestone) {
+		return
+	}
+
+	if err := createMilestone(milestone); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create milestone"})
+		return
+	}
+	milestone, err := getMilestoneByID(milestone.ProjectID, milestone.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch created milestone"})
+		return
+	}
+	c.JSON(http.StatusCreated, milestone)
+}
+
+func updateMilestoneHandler(c *gin.Context) {
+	projectID := c.Param("id")
+	milestone, err := getMilestoneByID(projectID, c.Param("mid"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Milestone not found"})
+		return
+	}
+
+	// Only the fields present in the body are changed; an empty due_date
+	// clears it
+	var body struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+		DueDate     *string `json:"due_date"`
+		State       *string `json:"state"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if body.Title != nil {
+		milestone.Title = strings.TrimSpace(*body.Title)
+	}
+	if body.Description != nil {
+		milestone.Description = *body.Description
+	}
+	if body.DueDate != nil {
+		milestone.DueDate = nilIfEmpty(body.DueDate)
+	}
+	if body.State != nil {
+		milestone.State = *body.State
+	}
+	if !validateMilestone(c, milestone) {
+		return
+	}
+
+	if err := updateMilestone(milestone); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update milestone"})
+		return
+	}
+	milestone, err = getMilestoneByID(projectID, milestone.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch updated milestone"})
+		return
+	}
+	c.JSON(http.StatusOK, milestone)
+}
+
+// deleteMilestoneHandler deletes a milestone. Its issues are kept and no
+// longer belong to any milestone.
+func deleteMilestoneHandler(c *gin.Context) {
+	query := `DELETE FROM milestones WHERE id = $1 AND project_id = $2`
+	result, err := db.Exec(query, c.Param("mid"), c.Param("id"))
+	if err != nil {
+		log.Printf("Database error deleting milestone: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete milestone"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Milestone not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Milestone deleted successfully"})
+}
+
+// validateMilestone checks a milestone's fields. It writes the error
+// response and returns false if the milestone is invalid.
+func validateMilestone(c *gin.Context, milestone Milestone) bool {
+	if milestone.Title == "" || len(milestone.Title) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Title must be between 1 and 255 characters"})
+		return false
+	}
+	if milestone.DueDate != nil {
+		if _, err := time.Parse("2006-01-02", *milestone.DueDate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Due date must be a date such as 2024-01-31"})
+			return false
+		}
+	}
+	if milestone.State != "open" && milestone.State != "closed" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "State must be open or closed"})
+		return false
+	}
+	return true
+}
+
+// validateIssueMilestone checks that a non-nil milestone belongs to the
+// project.
+func validateIssueMilestone(projectID string, milestoneID *string) error {
+	if milestoneID == nil {
+		return nil
+	}
+	if _, err := uuid.Parse(*milestoneID); err != nil {
+		return errInvalidMilestone
+	}
+	_, err := getMilestoneByID(projectID, *milestoneID)
+	if err == sql.ErrNoRows {
+		return errInvalidMilestone
+	}
+	return err
+}
+
+// checkIssueMilestone validates an issue's milestone, writing the error
+// response and returning false if it is not one of the project's.
+func checkIssueMilestone(c *gin.Context, projectID string, milestoneID *string) bool {
+	err := validateIssueMilestone(projectID, milestoneID)
+	if errors.Is(err, errInvalidMilestone) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Milestone must belong to the project"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate milestone"})
+		return false
+	}
+	return true
+}
+
+// attachMilestoneProgress counts each milestone's issues by whether their
+// status is in the project workflow's done category.
+func attachMilestoneProgress(projectID string, milestones []Milestone) error {
+	if len(milestones) == 0 {
+		return nil
+	}
+	ids := make([]string, len(milestones))
+	for i, milestone := range milestones {
+		ids[i] = milestone.ID
+	}
+	progress, err := getIssueProgress(projectID, "milestone_id", ids)
+	if err != nil {
+		return err
+	}
+	for i := range milestones {
+		milestones[i].Progress = progress[milestones[i].ID]
+	}
+	return nil
+}
+
+// getIssueProgress counts the issues grouped under each ID in column, such
+// as milestone_id, by whether their status is in the done category.
+func getIssueProgress(projectID, column string, ids []string) (map[string]*IssueProgress, error) {
+	workflow, err := getProjectWorkflow(projectID)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+	SELECT ` + column + `, status, COUNT(*)
+	FROM issues
+	WHERE ` + column + ` = ANY($1::uuid[])
+	GROUP BY ` + column + `, status
+	`
+	rows, err := db.Query(query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	progress := make(map[string]*IssueProgress, len(ids))
+	for _, id := range ids {
+		progress[id] = &IssueProgress{}
+	}
+	for rows.Next() {
+		var id, status string
+		var count int
+		if err := rows.Scan(&id, &status, &count); err != nil {
+			return nil, err
+		}
+		p := progress[id]
+		p.Total += count
+		if workflow.IsDone(status) {
+			p.Closed += count
+		} else {
+			p.Open += count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, p := range progress {
+		if p.Total > 0 {
+			p.PercentComplete = p.Closed * 100 / p.Total
+		}
+	}
+	return progress, nil
+}
+
+const milestoneColumns = `id, project_id, title, description, to_char(due_date, 'YYYY-MM-DD'), state, closed_at, created_by, created_at, updated_at`
+
+func scanMilestone(row rowScanner) (Milestone, error) {
+	var m Milestone
+	err := row.Scan(&m.ID, &m.ProjectID, &m.Title, &m.Description, &m.DueDate, &m.State, &m.ClosedAt, &m.CreatedBy, &m.CreatedAt, &m.UpdatedAt)
+	return m, err
+}
+
+func getMilestoneByID(projectID, milestoneID string) (Milestone, error) {
+	query := `SELECT ` + milestoneColumns + ` FROM milestones WHERE id = $1 AND project_id = $2`
+	return scanMilestone(db.QueryRow(query, milestoneID, projectID))
+}
+
+// getMilestonesByProject lists milestones with the earliest due dates first
+// and undated ones last.
+func getMilestonesByProject(projectID, state string) ([]Milestone, error) {
+	query := `SELECT ` + milestoneColumns + ` FROM milestones WHERE project_id = $1`
+	args := []interface{}{projectID}
+	if state != "all" {
+		query += ` AND state = $2`
+		args = append(args, state)
+	}
+	query += ` ORDER BY due_date ASC NULLS LAST, created_at ASC`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var milestones []Milestone
+	for rows.Next() {
+		milestone, err := scanMilestone(rows)
+		if err != nil {
+			return nil, err
+		}
+		milestones = append(milestones, milestone)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return milestones, nil
+}
+
+func createMilestone(m Milestone) error {
+	query := `
+	INSERT INTO milestones (id, project_id, title, description, due_date, state, created_by, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err := db.Exec(query, m.ID, m.ProjectID, m.Title, m.Description, m.DueDate, m.State, m.CreatedBy, m.CreatedAt, m.UpdatedAt)
+	if err != nil {
+		log.Printf("Database error creating milestone: %v", err)
+	}
+	return err
+}
+
+// updateMilestone saves a milestone, stamping closed_at when it is closed
+// and clearing it when it is reopened.
+func updateMilestone(m Milestone) error {
+	query := `
+	UPDATE milestones
+	SET title = $1, description = $2, due_date = $3, state = $4,
+		closed_at = CASE WHEN $4 = 'closed' THEN COALESCE(closed_at, NOW()) END,
+		updated_at = NOW()
+	WHERE id = $5
+	`
+	_, err := db.Exec(query, m.Title, m.Description, m.DueDate, m.State, m.ID)
+	if err != nil {
+		log.Printf("Database error updating milestone: %v", err)
+	}
+	return err
+}
@@ -1,5 +1,7 @@
 package main
 
+import "encoding/json"
+
 type User struct {
 	ID           string `json:"id"`
 	Email        string `json:"email"`
@@ -13,31 +15,373 @@ type User struct {
 
 type Project struct {
 	ID          string `json:"id"`
+	Key         string `json:"key"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	CreatedBy   string `json:"created_by"`
-	CreatedAt   string `json:"created_at"`
-	UpdatedAt   string `json:"updated_at"`
+	Role        string `json:"role,omitempty"`
+	// PreventCloseWithOpenBlockers stops issues from moving to a done status
+	// while an issue that blocks them is still open
+	PreventCloseWithOpenBlockers bool `json:"prevent_close_with_open_blockers"`
+	// ParentCloseRule is none, block (a parent cannot be done before its
+	// children) or auto_close (a parent is done once all its children are)
+	ParentCloseRule string `json:"parent_close_rule"`
+	CreatedAt       string `json:"created_at"`
+	UpdatedAt       string `json:"updated_at"`
+}
+
+type ProjectMember struct {
+	ProjectID string `json:"project_id"`
+	UserID    string `json:"user_id"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Role      string `json:"role"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
 }
 
 type Issue struct {
 	ID          string  `json:"id"`
+	Key         string  `json:"key"`
+	Number      int     `json:"number"`
 	Title       string  `json:"title"`
 	Description string  `json:"description"`
 	Status      string  `json:"status"`
 	Priority    string  `json:"priority"`
+	Resolution  *string `json:"resolution,omitempty"`
 	ProjectID   string  `json:"project_id"`
 	CreatedBy   string  `json:"created_by"`
 	AssignedTo  *string `json:"assigned_to,omitempty"`
+	MilestoneID *string `json:"milestone_id,omitempty"`
+	SprintID    *string `json:"sprint_id,omitempty"`
+	ParentID    *string `json:"parent_id,omitempty"`
+	Labels      []Label `json:"labels"`
 	CreatedAt   string  `json:"created_at"`
 	UpdatedAt   string  `json:"updated_at"`
+	// Children rolls up the status of the issue's direct children
+	Children *IssueProgress `json:"children,omitempty"`
 }
 
-type Comment struct {
-	ID        string `json:"id"`
+type Label struct {
+	ID          string `json:"id"`
+	ProjectID   string `json:"project_id"`
+	Name        string `json:"name"`
+	Color       string `json:"color"`
+	Description string `json:"description"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+type IssueAssignment struct {
+	ID               string  `json:"id"`
+	IssueID          string  `json:"issue_id"`
+	PreviousAssignee *string `json:"previous_assignee"`
+	Assignee         *string `json:"assignee"`
+	ChangedBy        *string `json:"changed_by"`
+	CreatedAt        string  `json:"created_at"`
+}
+
+type Milestone struct {
+	ID          string         `json:"id"`
+	ProjectID   string         `json:"project_id"`
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	DueDate     *string        `json:"due_date"`
+	State       string         `json:"state"`
+	ClosedAt    *string        `json:"closed_at"`
+	CreatedBy   *string        `json:"created_by"`
+	CreatedAt   string         `json:"created_at"`
+	UpdatedAt   string         `json:"updated_at"`
+	Progress    *IssueProgress `json:"progress,omitempty"`
+}
+
+type Sprint struct {
+	ID                string         `json:"id"`
+	ProjectID         string         `json:"project_id"`
+	Name              string         `json:"name"`
+	Goal              string         `json:"goal"`
+	StartDate         *string        `json:"start_date"`
+	EndDate           *string        `json:"end_date"`
+	State             string         `json:"state"`
+	StartedAt         *string        `json:"started_at"`
+	CompletedAt       *string        `json:"completed_at"`
+	CompletedIssues   *int           `json:"completed_issues"`
+	CarriedOverIssues *int           `json:"carried_over_issues"`
+	CreatedBy         *string        `json:"created_by"`
+	CreatedAt         string         `json:"created_at"`
+	UpdatedAt         string         `json:"updated_at"`
+	Progress          *IssueProgress `json:"progress,omitempty"`
+}
+
+// IssueProgress counts a milestone's, sprint's or parent issue's issues by whether their
+// status is in the done category.
+type IssueProgress struct {
+	Total           int `json:"total"`
+	Open            int `json:"open"`
+	Closed          int `json:"closed"`
+	PercentComplete int `json:"percent_complete"`
+}
+
+// IssueLink is a link between two issues, described from the side of
+// IssueID. Type is one of blocks, blocked_by, duplicates, duplicated_by or
+// relates_to.
+type IssueLink struct {
+	ID              string  `json:"id"`
+	Type            string  `json:"type"`
+	IssueID         string  `json:"issue_id"`
+	LinkedIssueID   string  `json:"linked_issue_id"`
+	LinkedTitle     string  `json:"linked_issue_title"`
+	LinkedStatus    string  `json:"linked_issue_status"`
+	LinkedProjectID string  `json:"linked_issue_project_id"`
+	CreatedBy       *string `json:"created_by"`
+	CreatedAt       string  `json:"created_at"`
+}
+
+type IssueWatcher struct {
 	IssueID   string `json:"issue_id"`
-	CreatedBy string `json:"created_by"`
-	Content   string `json:"content"`
+	UserID    string `json:"user_id"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
 	CreatedAt string `json:"created_at"`
-	UpdatedAt string `json:"updated_at"`
+}
+
+type WorkflowStatus struct {
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	Position int    `json:"position"`
+	Initial  bool   `json:"initial"`
+}
+
+type WorkflowTransition struct {
+	From           string   `json:"from"`
+	To             string   `json:"to"`
+	RequiredFields []string `json:"required_fields"`
+}
+
+type Workflow struct {
+	ProjectID   string               `json:"project_id"`
+	Custom      bool                 `json:"custom"`
+	Statuses    []WorkflowStatus     `json:"statuses"`
+	Transitions []WorkflowTransition `json:"transitions"`
+}
+
+type IssueEvent struct {
+	ID             string  `json:"id"`
+	IssueID        string  `json:"issue_id"`
+	ActorID        *string `json:"actor_id"`
+	ActorName      *string `json:"actor_name,omitempty"`
+	EventType      string  `json:"event_type"`
+	Field          *string `json:"field,omitempty"`
+	OldValue       *string `json:"old_value,omitempty"`
+	NewValue       *string `json:"new_value,omitempty"`
+	CommentID      *string `json:"comment_id,omitempty"`
+	CommentContent *string `json:"comment_content,omitempty"`
+	CreatedAt      string  `json:"created_at"`
+}
+
+type SavedFilter struct {
+	ID        string  `json:"id"`
+	OwnerID   string  `json:"owner_id"`
+	ProjectID *string `json:"project_id"`
+	Name      string  `json:"name"`
+	Query     string  `json:"query"`
+	Shared    bool    `json:"shared"`
+	CreatedAt string  `json:"created_at"`
+	UpdatedAt string  `json:"updated_at"`
+}
+
+type Webhook struct {
+	ID        string   `json:"id"`
+	ProjectID string   `json:"project_id"`
+	URL       string   `json:"url"`
+	Secret    string   `json:"secret,omitempty"`
+	Events    []string `json:"events"`
+	Active    bool     `json:"active"`
+	CreatedBy *string  `json:"created_by"`
+	CreatedAt string   `json:"created_at"`
+	UpdatedAt string   `json:"updated_at"`
+}
+
+// GitHook receives push and merge request webhooks from a Git host for a
+// project. URL is the path to configure on the host.
+type GitHook struct {
+	ID        string  `json:"id"`
+	ProjectID string  `json:"project_id"`
+	Provider  string  `json:"provider"`
+	URL       string  `json:"url"`
+	Secret    string  `json:"secret,omitempty"`
+	CreatedBy *string `json:"created_by"`
+	CreatedAt string  `json:"created_at"`
+}
+
+type IssueCommit struct {
+	IssueID     string  `json:"issue_id"`
+	SHA         string  `json:"sha"`
+	Repository  string  `json:"repository"`
+	Branch      string  `json:"branch"`
+	Message     string  `json:"message"`
+	URL         string  `json:"url"`
+	AuthorName  string  `json:"author_name"`
+	AuthorEmail string  `json:"author_email"`
+	CommittedAt *string `json:"committed_at"`
+	CreatedAt   string  `json:"created_at"`
+}
+
+// ExportedIssue is an issue as written by the export, with the people,
+// milestone, sprint and parent spelled out for use outside the tracker.
+type ExportedIssue struct {
+	Issue
+	AssigneeEmail *string           `json:"assignee_email,omitempty"`
+	ReporterEmail string            `json:"reporter_email"`
+	Milestone     *string           `json:"milestone,omitempty"`
+	Sprint        *string           `json:"sprint,omitempty"`
+	ParentKey     *string           `json:"parent_key,omitempty"`
+	Comments      []ExportedComment `json:"comments,omitempty"`
+}
+
+type ExportedComment struct {
+	ID          string `json:"id"`
+	AuthorID    string `json:"author_id"`
+	AuthorEmail string `json:"author_email"`
+	Content     string `json:"content"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+// ImportJob is a background import of issues into a project. Created counts
+// the issues that would be created when DryRun is set.
+type ImportJob struct {
+	ID             string        `json:"id"`
+	ProjectID      string        `json:"project_id"`
+	Source         string        `json:"source"`
+	Filename       string        `json:"filename"`
+	IdempotencyKey string        `json:"idempotency_key"`
+	DryRun         bool          `json:"dry_run"`
+	Status         string        `json:"status"`
+	Total          int           `json:"total"`
+	Processed      int           `json:"processed"`
+	Created        int           `json:"created"`
+	Skipped        int           `json:"skipped"`
+	Failed         int           `json:"failed"`
+	Errors         []ImportError `json:"errors"`
+	UnmappedUsers  []string      `json:"unmapped_users"`
+	Error          *string       `json:"error,omitempty"`
+	CreatedBy      *string       `json:"created_by"`
+	CreatedAt      string        `json:"created_at"`
+	StartedAt      *string       `json:"started_at"`
+	FinishedAt     *string       `json:"finished_at"`
+}
+
+// ImportError explains why one issue in an import file was not imported.
+type ImportError struct {
+	Row        int    `json:"row"`
+	ExternalID string `json:"external_id,omitempty"`
+	Error      string `json:"error"`
+}
+
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	WebhookID      string          `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *string         `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code"`
+	LastError      *string         `json:"last_error"`
+	CreatedAt      string          `json:"created_at"`
+	DeliveredAt    *string         `json:"delivered_at"`
+}
+
+type SearchHit struct {
+	Type       string  `json:"type"`
+	ID         string  `json:"id"`
+	IssueID    string  `json:"issue_id"`
+	ProjectID  string  `json:"project_id"`
+	IssueTitle string  `json:"issue_title"`
+	Snippet    string  `json:"snippet"`
+	Rank       float64 `json:"rank"`
+	UpdatedAt  string  `json:"updated_at"`
+}
+
+type Comment struct {
+	ID        string    `json:"id"`
+	IssueID   string    `json:"issue_id"`
+	CreatedBy string    `json:"created_by"`
+	Content   string    `json:"content"`
+	Mentions  []Mention `json:"mentions"`
+	CreatedAt string    `json:"created_at"`
+	UpdatedAt string    `json:"updated_at"`
+}
+
+// Mention is a user mentioned in a comment.
+type Mention struct {
+	UserID    string `json:"user_id"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// UserMention is a comment that mentions the current user.
+type UserMention struct {
+	CommentID  string `json:"comment_id"`
+	IssueID    string `json:"issue_id"`
+	IssueTitle string `json:"issue_title"`
+	ProjectID  string `json:"project_id"`
+	AuthorID   string `json:"author_id"`
+	AuthorName string `json:"author_name"`
+	Content    string `json:"content"`
+	CreatedAt  string `json:"created_at"`
+}
+
+type Attachment struct {
+	ID          string  `json:"id"`
+	ProjectID   string  `json:"project_id"`
+	IssueID     string  `json:"issue_id"`
+	CommentID   *string `json:"comment_id"`
+	Filename    string  `json:"filename"`
+	ContentType string  `json:"content_type"`
+	Size        int64   `json:"size"`
+	Checksum    string  `json:"checksum"`
+	StorageKey  string  `json:"-"`
+	UploadedBy  *string `json:"uploaded_by"`
+	CreatedAt   string  `json:"created_at"`
+	DownloadURL string  `json:"download_url"`
+}
+
+type Notification struct {
+	ID         string  `json:"id"`
+	Reason     string  `json:"reason"`
+	IssueID    string  `json:"issue_id"`
+	IssueTitle string  `json:"issue_title"`
+	ProjectID  string  `json:"project_id"`
+	CommentID  *string `json:"comment_id,omitempty"`
+	ActorID    *string `json:"actor_id"`
+	ActorName  *string `json:"actor_name,omitempty"`
+	OldValue   *string `json:"old_value,omitempty"`
+	NewValue   *string `json:"new_value,omitempty"`
+	Read       bool    `json:"read"`
+	ReadAt     *string `json:"read_at"`
+	CreatedAt  string  `json:"created_at"`
+}
+
+type NotificationPreferences struct {
+	EmailEnabled  bool `json:"email_enabled"`
+	Assigned      bool `json:"assigned"`
+	Mentioned     bool `json:"mentioned"`
+	StatusChanged bool `json:"status_changed"`
+	Commented     bool `json:"commented"`
+}
+
+type Session struct {
+	ID         string  `json:"id"`
+	UserID     string  `json:"user_id"`
+	UserAgent  string  `json:"user_agent"`
+	IPAddress  string  `json:"ip_address"`
+	ExpiresAt  string  `json:"expires_at"`
+	RevokedAt  *string `json:"revoked_at,omitempty"`
+	CreatedAt  string  `json:"created_at"`
+	LastUsedAt string  `json:"last_used_at"`
 }
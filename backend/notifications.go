@@ -0,0 +1,217 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Reasons a user is notified about an issue
+const (
+	notifyAssigned      = "assigned"
+	notifyMentioned     = "mentioned"
+	notifyStatusChanged = "status_changed"
+	notifyCommented     = "commented"
+)
+
+// issueNotification describes a change to an issue that other people may
+// want to hear about.
+type issueNotification struct {
+	Reason    string
+	IssueID   string
+	CommentID *string
+	ActorID   string
+	OldStatus string
+	NewStatus string
+	Comment   string
+}
+
+func getNotificationPreferencesHandler(c *gin.Context) {
+	prefs, err := getNotificationPreferences(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notification preferences"})
+		return
+	}
+	c.JSON(http.StatusOK, prefs)
+}
+
+func updateNotificationPreferencesHandler(c *gin.Context) {
+	userID := c.GetString("user_id")
+	prefs, err := getNotificationPreferences(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notification preferences"})
+		return
+	}
+
+	// Only the fields present in the body are changed
+	var body struct {
+		EmailEnabled  *bool `json:"email_enabled"`
+		Assigned      *bool `json:"assigned"`
+		Mentioned     *bool `json:"mentioned"`
+		StatusChanged *bool `json:"status_changed"`
+		Commented     *bool `json:"commented"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, field := range []struct {
+		value  *bool
+		target *bool
+	}{
+		{body.EmailEnabled, &prefs.EmailEnabled},
+		{body.Assigned, &prefs.Assigned},
+		{body.Mentioned, &prefs.Mentioned},
+		{body.StatusChanged, &prefs.StatusChanged},
+		{body.Commented, &prefs.Commented},
+	} {
+		if field.value != nil {
+			*field.target = *field.value
+		}
+	}
+
+	if err := saveNotificationPreferences(userID, prefs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification preferences"})
+		return
+	}
+	c.JSON(http.StatusOK, prefs)
+}
+
+// wants reports whether the preferences allow email for a reason.
+func (p NotificationPreferences) wants(reason string) bool {
+	if !p.EmailEnabled {
+		return false
+	}
+	switch reason {
+	case notifyAssigned:
+		return p.Assigned
+	case notifyMentioned:
+		return p.Mentioned
+	case notifyStatusChanged:
+		return p.StatusChanged
+	case notifyCommented:
+		return p.Commented
+	}
+	return false
+}
+
+// notifyUsers fans a notification out to recipients as part of the caller's
+// transaction. People are never notified about their own changes.
+func notifyUsers(tx *Tx, n issueNotification, recipients []string) error {
+	seen := map[string]bool{n.ActorID: true}
+	var ids []string
+	for _, id := range recipients {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := createNotifications(tx, n, ids); err != nil {
+		return err
+	}
+	return enqueueNotificationEmails(tx, n, ids)
+}
+
+// notifyIssueWatchers notifies everyone following an issue.
+func notifyIssueWatchers(tx *Tx, n issueNotification) error {
+	watchers, err := issueWatcherIDs(tx, n.IssueID)
+	if err != nil {
+		return err
+	}
+	return notifyUsers(tx, n, watchers)
+}
+
+// notifyComment tells the users mentioned in a new comment that they were
+// mentioned and the issue's other watchers that a comment was added.
+func notifyComment(tx *Tx, comment Comment, mentioned []string, actorID string) error {
+	if err := notifyMentions(tx, comment, mentioned, actorID); err != nil {
+		return err
+	}
+	watchers, err := issueWatcherIDs(tx, comment.IssueID)
+	if err != nil {
+		return err
+	}
+	n := issueNotification{
+		Reason:    notifyCommented,
+		IssueID:   comment.IssueID,
+		CommentID: strPtr(comment.ID),
+		ActorID:   actorID,
+		Comment:   comment.Content,
+	}
+	return notifyUsers(tx, n, subtractIDs(watchers, mentioned))
+}
+
+// notifyMentions tells users they were mentioned in a comment.
+func notifyMentions(tx *Tx, comment Comment, mentioned []string, actorID string) error {
+	n := issueNotification{
+		Reason:    notifyMentioned,
+		IssueID:   comment.IssueID,
+		CommentID: strPtr(comment.ID),
+		ActorID:   actorID,
+		Comment:   comment.Content,
+	}
+	return notifyUsers(tx, n, mentioned)
+}
+
+func subtractIDs(ids, remove []string) []string {
+	skip := make(map[string]bool, len(remove))
+	for _, id := range remove {
+		skip[id] = true
+	}
+	var kept []string
+	for _, id := range ids {
+		if !skip[id] {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
+
+func queryIDs(q queryer, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// getNotificationPreferences returns the user's preferences, or the defaults
+// (everything on) if they have never changed them.
+func getNotificationPreferences(userID string) (NotificationPreferences, error) {
+	prefs := NotificationPreferences{EmailEnabled: true, Assigned: true, Mentioned: true, StatusChanged: true, Commented: true}
+	query := `
+	SELECT email_enabled, on_assigned, on_mentioned, on_status_changed, on_commented
+	FROM notification_preferences
+	WHERE user_id = $1
+	`
+	err := db.QueryRow(query, userID).Scan(&prefs.EmailEnabled, &prefs.Assigned, &prefs.Mentioned, &prefs.StatusChanged, &prefs.Commented)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	return prefs, err
+}
+
+func saveNotificationPreferences(userID string, prefs NotificationPreferences) error {
+	query := `
+	INSERT INTO notification_preferences (user_id, email_enabled, on_assigned, on_mentioned, on_status_changed, on_commented)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (user_id) DO UPDATE
+	SET email_enabled = EXCLUDED.email_enabled, on_assigned = EXCLUDED.on_assigned, on_mentioned = EXCLUDED.on_mentioned,
+		on_status_changed = EXCLUDED.on_status_changed, on_commented = EXCLUDED.on_commented, updated_at = NOW()
+	`
+	_, err := db.Exec(query, userID, prefs.EmailEnabled, prefs.Assigned, prefs.Mentioned, prefs.StatusChanged, prefs.Commented)
+	return err
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Principal is the authenticated user for the current request. It memoizes
+// project roles and role permissions so a request never looks them up twice.
+type Principal struct {
+	User
+	SessionID string
+
+	projectRoles    map[string]string
+	rolePermissions map[string]map[string]bool
+}
+
+func newPrincipal(user User, sessionID string) *Principal {
+	return &Principal{
+		User:            user,
+		SessionID:       sessionID,
+		projectRoles:    map[string]string{},
+		rolePermissions: map[string]map[string]bool{},
+	}
+}
+
+// currentPrincipal returns the principal set by authMiddleware.
+func currentPrincipal(c *gin.Context) *Principal {
+	if p, ok := c.Get("principal"); ok {
+		return p.(*Principal)
+	}
+	return nil
+}
+
+// ProjectRole returns the principal's role on a project, or "" if they are
+// not a member.
+func (p *Principal) ProjectRole(projectID string) (string, error) {
+	if role, ok := p.projectRoles[projectID]; ok {
+		return role, nil
+	}
+	role, err := getProjectMemberRole(projectID, p.ID)
+	if err == sql.ErrNoRows {
+		role, err = "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	p.projectRoles[projectID] = role
+	return role, nil
+}
+
+// forgetProjectRoles drops the cached project roles, so the next check reads
+// the principal's current memberships. Long-lived requests call it from
+// time to time.
+func (p *Principal) forgetProjectRoles() {
+	p.projectRoles = map[string]string{}
+}
+
+// Can reports whether the principal holds perm, either through their global
+// role or through their role on projectID. Pass an empty projectID for
+// permissions that are not project scoped.
+func (p *Principal) Can(projectID, perm string) (bool, error) {
+	ok, err := p.roleHas(p.Role, perm)
+	if err != nil || ok || projectID == "" {
+		return ok, err
+	}
+	role, err := p.ProjectRole(projectID)
+	if err != nil || role == "" {
+		return false, err
+	}
+	return p.roleHas(role, perm)
+}
+
+func (p *Principal) roleHas(role, perm string) (bool, error) {
+	perms, ok := p.rolePermissions[role]
+	if !ok {
+		var err error
+		perms, err = getRolePermissions(role)
+		if err != nil {
+			return false, err
+		}
+		p.rolePermissions[role] = perms
+	}
+	return perms[perm], nil
+}
+
+func getRolePermissions(role string) (map[string]bool, error) {
+	rows, err := db.Query(`SELECT permission FROM role_permissions WHERE role = $1`, role)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	perms := map[string]bool{}
+	for rows.Next() {
+		var perm string
+		if err := rows.Scan(&perm); err != nil {
+			return nil, err
+		}
+		perms[perm] = true
+	}
+	return perms, rows.Err()
+}
+
+// canViewProjectSQL is the SQL form of Can(project, "project:view"): it holds
+// when the user in userCol, whose global role is roleCol, is a member of the
+// project in projectCol or may see every project through their global role.
+func canViewProjectSQL(projectCol, userCol, roleCol string) string {
+	return `(
+		EXISTS (SELECT 1 FROM project_members pm WHERE pm.project_id = ` + projectCol + ` AND pm.user_id = ` + userCol + `)
+		OR EXISTS (SELECT 1 FROM role_permissions rp WHERE rp.role = ` + roleCol + ` AND rp.permission = 'project:view')
+	)`
+}
+
+// authorize checks perm for the current principal within a project. On
+// failure the response is written and false is returned.
+func authorize(c *gin.Context, projectID, perm string) bool {
+	p := currentPrincipal(c)
+	if p == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return false
+	}
+	ok, err := p.Can(projectID, perm)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return false
+	}
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions", "permission": perm})
+		return false
+	}
+	return true
+}
+
+// scopeResolver finds the project a request operates on. It writes the
+// response and returns false when the scope cannot be resolved.
+type scopeResolver func(c *gin.Context) (string, bool)
+
+// globalScope is used for permissions that are not tied to a project.
+func globalScope(c *gin.Context) (string, bool) {
+	return "", true
+}
+
+// projectScope resolves the project from a project ID route param.
+func projectScope(param string) scopeResolver {
+	return func(c *gin.Context) (string, bool) {
+		projectID := c.Param(param)
+		var exists bool
+		err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM projects WHERE id = $1)`, projectID).Scan(&exists)
+		if err != nil || !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+			return "", false
+		}
+		return projectID, true
+	}
+}
+
+// issueScope resolves the project from an issue route param, which may be
+// the issue's UUID or its key such as PROJ-123. A key is replaced by the UUID
+// so handlers only ever see UUIDs.
+func issueScope(param string) scopeResolver {
+	return func(c *gin.Context) (string, bool) {
+		issueID, projectID, err := resolveIssueRef(c.Param(param))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Issue not found"})
+			return "", false
+		}
+		setParam(c, param, issueID)
+		return projectID, true
+	}
+}
+
+// commentScope resolves the project from a comment ID route param.
+func commentScope(param string) scopeResolver {
+	return func(c *gin.Context) (string, bool) {
+		var projectID string
+		query := `
+		SELECT i.project_id
+		FROM comments cm
+		JOIN issues i ON i.id = cm.issue_id
+		WHERE cm.id = $1
+		`
+		err := db.QueryRow(query, c.Param(param)).Scan(&projectID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+			return "", false
+		}
+		return projectID, true
+	}
+}
+
+// attachmentScope resolves the project from an attachment ID route param.
+func attachmentScope(param string) scopeResolver {
+	return func(c *gin.Context) (string, bool) {
+		var projectID string
+		err := db.QueryRow(`SELECT project_id FROM attachments WHERE id = $1`, c.Param(param)).Scan(&projectID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+			return "", false
+		}
+		return projectID, true
+	}
+}
+
+// requirePermission only lets the request through if the principal holds
+// perm within the project resolved by scope. The resolved project ID is
+// stored as "project_id" for the handler.
+func requirePermission(perm string, scope scopeResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		projectID, ok := scope(c)
+		if !ok {
+			c.Abort()
+			return
+		}
+		if !authorize(c, projectID, perm) {
+			c.Abort()
+			return
+		}
+		if projectID != "" {
+			c.Set("project_id", projectID)
+		}
+		c.Next()
+	}
+}
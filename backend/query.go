@@ -0,0 +1,656 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Issue query language used by the issue list, for example:
+//
+//	status in (open, in_progress) AND priority >= high AND assignee = me
+//	AND created > -7d ORDER BY updated DESC
+//
+// A query is parsed into a small expression tree whose values have already
+// been validated and resolved, then rendered into parameterized SQL. User
+// input never reaches the SQL text directly.
+
+// priorityLevels lists issue priorities from lowest to highest.
+var priorityLevels = []string{"low", "medium", "high", "critical"}
+
+// priorityRank orders issues by priority using the levels above.
+const priorityRank = `CASE priority WHEN 'low' THEN 1 WHEN 'medium' THEN 2 WHEN 'high' THEN 3 WHEN 'critical' THEN 4 END`
+
+type fieldKind int
+
+const (
+	fieldText fieldKind = iota
+	fieldPriority
+	fieldUser
+	fieldID
+	fieldDate
+	fieldFullText
+	fieldLabel
+)
+
+type queryField struct {
+	column   string
+	kind     fieldKind
+	nullable bool
+	sortable bool
+}
+
+// queryFields maps query field names to issue columns.
+var queryFields = map[string]queryField{
+	"status":      {column: "status", kind: fieldText, sortable: true},
+	"priority":    {column: "priority", kind: fieldPriority, sortable: true},
+	"resolution":  {column: "resolution", kind: fieldText, nullable: true},
+	"assignee":    {column: "assigned_to", kind: fieldUser, nullable: true},
+	"reporter":    {column: "created_by", kind: fieldUser},
+	"project":     {column: "project_id", kind: fieldID},
+	"milestone":   {column: "milestone_id", kind: fieldID, nullable: true},
+	"sprint":      {column: "sprint_id", kind: fieldID, nullable: true},
+	"parent":      {column: "parent_id", kind: fieldID, nullable: true},
+	"title":       {column: "title", kind: fieldText, sortable: true},
+	"description": {column: "description", kind: fieldText, nullable: true},
+	"text":        {column: "search_vector", kind: fieldFullText},
+	"label":       {kind: fieldLabel, nullable: true},
+	"created":     {column: "created_at", kind: fieldDate, sortable: true},
+	"updated":     {column: "updated_at", kind: fieldDate, sortable: true},
+}
+
+// queryError is a parse error at a byte offset in the query.
+type queryError struct {
+	Pos int
+	Msg string
+}
+
+func (e *queryError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+// writeQueryError reports a query that failed to parse as a 400.
+func writeQueryError(c *gin.Context, err error) {
+	body := gin.H{"error": "Invalid query: " + err.Error()}
+	var qerr *queryError
+	if errors.As(err, &qerr) {
+		body["position"] = qerr.Pos
+	}
+	c.JSON(http.StatusBadRequest, body)
+}
+
+// sqlBuilder collects positional arguments while a query is rendered.
+type sqlBuilder struct {
+	args []interface{}
+}
+
+// arg adds a value and returns its placeholder.
+func (b *sqlBuilder) arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+// issueQuery is a parsed issue query.
+type issueQuery struct {
+	where   queryExpr
+	orderBy []queryOrder
+}
+
+type queryOrder struct {
+	field queryField
+	desc  bool
+}
+
+// orderSQL renders the ORDER BY clause, or "" when the query has none.
+func (q *issueQuery) orderSQL() string {
+	if q == nil || len(q.orderBy) == 0 {
+		return ""
+	}
+	terms := make([]string, 0, len(q.orderBy)+1)
+	for _, order := range q.orderBy {
+		term := order.field.column
+		if order.field.kind == fieldPriority {
+			term = priorityRank
+		}
+		if order.desc {
+			term += " DESC"
+		}
+		terms = append(terms, term)
+	}
+	// Keep pagination stable when the sort keys tie
+	terms = append(terms, "id")
+	return strings.Join(terms, ", ")
+}
+
+type queryExpr interface {
+	sql(b *sqlBuilder) string
+}
+
+type andExpr struct{ left, right queryExpr }
+type orExpr struct{ left, right queryExpr }
+type notExpr struct{ expr queryExpr }
+
+// clauseExpr compares one field with resolved values.
+type clauseExpr struct {
+	field  queryField
+	op     string
+	values []interface{}
+}
+
+func (e andExpr) sql(b *sqlBuilder) string {
+	return "(" + e.left.sql(b) + " AND " + e.right.sql(b) + ")"
+}
+
+func (e orExpr) sql(b *sqlBuilder) string {
+	return "(" + e.left.sql(b) + " OR " + e.right.sql(b) + ")"
+}
+
+func (e notExpr) sql(b *sqlBuilder) string {
+	return "NOT (" + e.expr.sql(b) + ")"
+}
+
+func (e clauseExpr) sql(b *sqlBuilder) string {
+	if e.field.kind == fieldLabel {
+		return e.labelSQL(b)
+	}
+	column := e.field.column
+	switch e.op {
+	case "is empty":
+		if e.field.kind == fieldText {
+			return "(" + column + " IS NULL OR " + column + " = '')"
+		}
+		return column + " IS NULL"
+	case "is not empty":
+		if e.field.kind == fieldText {
+			return "(" + column + " IS NOT NULL AND " + column + " <> '')"
+		}
+		return column + " IS NOT NULL"
+	case "in", "not in":
+		placeholders := make([]string, len(e.values))
+		for i, value := range e.values {
+			placeholders[i] = b.arg(value)
+		}
+		list := column + " IN (" + strings.Join(placeholders, ", ") + ")"
+		if e.op == "not in" {
+			// Unset values are never equal to anything, so they count as "not in"
+			return "(" + column + " IS NULL OR NOT " + list + ")"
+		}
+		return list
+	case "~", "!~":
+		var match string
+		if e.field.kind == fieldFullText {
+			match = column + " @@ to_tsquery('english', " + b.arg(e.values[0]) + ")"
+		} else {
+			match = column + " ILIKE " + b.arg(e.values[0])
+		}
+		if e.op == "!~" {
+			return "NOT COALESCE(" + match + ", false)"
+		}
+		return match
+	case "!=":
+		return "(" + column + " IS NULL OR " + column + " <> " + b.arg(e.values[0]) + ")"
+	}
+	if e.field.kind == fieldPriority && e.op != "=" {
+		return priorityRank + " " + e.op + " " + b.arg(e.values[0])
+	}
+	return column + " " + e.op + " " + b.arg(e.values[0])
+}
+
+// labelSQL renders a clause on an issue's labels, which match by name
+// regardless of case.
+func (e clauseExpr) labelSQL(b *sqlBuilder) string {
+	switch e.op {
+	case "is empty":
+		return "NOT " + labelExistsSQL("")
+	case "is not empty":
+		return labelExistsSQL("")
+	}
+	placeholders := make([]string, len(e.values))
+	for i, value := range e.values {
+		placeholders[i] = b.arg(value)
+	}
+	match := labelExistsSQL("LOWER(l.name) IN (" + strings.Join(placeholders, ", ") + ")")
+	if e.op == "!=" || e.op == "not in" {
+		return "NOT " + match
+	}
+	return match
+}
+
+// Query tokens
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+type queryToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// is reports whether the token is the given keyword, ignoring case.
+func (t queryToken) is(keyword string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+func (t queryToken) describe() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of query"
+	case tokenString:
+		return strconv.Quote(t.text)
+	}
+	return "'" + t.text + "'"
+}
+
+func isQueryWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-.:+*", r)
+}
+
+func tokenizeQuery(input string) ([]queryToken, error) {
+	var tokens []queryToken
+	for pos := 0; pos < len(input); {
+		r := rune(input[pos])
+		switch {
+		case unicode.IsSpace(r):
+			pos++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokenLParen, text: "(", pos: pos})
+			pos++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokenRParen, text: ")", pos: pos})
+			pos++
+		case r == ',':
+			tokens = append(tokens, queryToken{kind: tokenComma, text: ",", pos: pos})
+			pos++
+		case r == '"' || r == '\'':
+			var text strings.Builder
+			end := pos + 1
+			for ; end < len(input) && rune(input[end]) != r; end++ {
+				if input[end] == '\\' && end+1 < len(input) {
+					end++
+				}
+				text.WriteByte(input[end])
+			}
+			if end >= len(input) {
+				return nil, &queryError{Pos: pos, Msg: "unterminated string"}
+			}
+			tokens = append(tokens, queryToken{kind: tokenString, text: text.String(), pos: pos})
+			pos = end + 1
+		case strings.ContainsRune("=!<>~", r):
+			op := string(r)
+			if pos+1 < len(input) {
+				if two := input[pos : pos+2]; two == "!=" || two == "<=" || two == ">=" || two == "!~" {
+					op = two
+				}
+			}
+			if op == "!" {
+				return nil, &queryError{Pos: pos, Msg: "unexpected '!'"}
+			}
+			tokens = append(tokens, queryToken{kind: tokenOperator, text: op, pos: pos})
+			pos += len(op)
+		default:
+			end := pos
+			for end < len(input) {
+				next, size := utf8.DecodeRuneInString(input[end:])
+				if !isQueryWordRune(next) {
+					break
+				}
+				end += size
+			}
+			if end == pos {
+				next, _ := utf8.DecodeRuneInString(input[pos:])
+				return nil, &queryError{Pos: pos, Msg: fmt.Sprintf("unexpected character %q", next)}
+			}
+			tokens = append(tokens, queryToken{kind: tokenWord, text: input[pos:end], pos: pos})
+			pos = end
+		}
+	}
+	return append(tokens, queryToken{kind: tokenEOF, pos: len(input)}), nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+	userID string
+	now    time.Time
+}
+
+// parseIssueQuery parses an issue query. "me" resolves to userID and
+// relative dates such as -7d are taken relative to now.
+func parseIssueQuery(input, userID string, now time.Time) (*issueQuery, error) {
+	tokens, err := tokenizeQuery(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens, userID: userID, now: now}
+	query := &issueQuery{}
+
+	if !p.peek().is("order") && p.peek().kind != tokenEOF {
+		if query.where, err = p.parseOr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek().is("order") {
+		p.next()
+		if tok := p.next(); !tok.is("by") {
+			return nil, p.unexpected(tok, "BY")
+		}
+		for {
+			order, err := p.parseOrder()
+			if err != nil {
+				return nil, err
+			}
+			query.orderBy = append(query.orderBy, order)
+			if p.peek().kind != tokenComma {
+				break
+			}
+			p.next()
+		}
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, p.unexpected(tok, "AND, OR or ORDER BY")
+	}
+	return query, nil
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() queryToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *queryParser) unexpected(tok queryToken, expected string) error {
+	return &queryError{Pos: tok.pos, Msg: fmt.Sprintf("expected %s but found %s", expected, tok.describe())}
+}
+
+func (p *queryParser) parseOr() (queryExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is("and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseUnary() (queryExpr, error) {
+	tok := p.peek()
+	if tok.is("not") {
+		p.next()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{expr}, nil
+	}
+	if tok.kind == tokenLParen {
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, p.unexpected(closing, "')'")
+		}
+		return expr, nil
+	}
+	return p.parseClause()
+}
+
+func (p *queryParser) parseField() (queryField, queryToken, error) {
+	tok := p.next()
+	if tok.kind != tokenWord {
+		return queryField{}, tok, p.unexpected(tok, "a field name")
+	}
+	field, ok := queryFields[strings.ToLower(tok.text)]
+	if !ok {
+		return queryField{}, tok, &queryError{Pos: tok.pos, Msg: fmt.Sprintf("unknown field '%s'", tok.text)}
+	}
+	return field, tok, nil
+}
+
+func (p *queryParser) parseClause() (queryExpr, error) {
+	field, fieldTok, err := p.parseField()
+	if err != nil {
+		return nil, err
+	}
+	name := strings.ToLower(fieldTok.text)
+
+	tok := p.next()
+	var op string
+	switch {
+	case tok.kind == tokenOperator:
+		op = tok.text
+	case tok.is("in"):
+		op = "in"
+	case tok.is("not"):
+		if in := p.next(); !in.is("in") {
+			return nil, p.unexpected(in, "IN")
+		}
+		op = "not in"
+	case tok.is("is"):
+		op = "is empty"
+		if p.peek().is("not") {
+			p.next()
+			op = "is not empty"
+		}
+		if empty := p.next(); !empty.is("empty") && !empty.is("null") {
+			return nil, p.unexpected(empty, "EMPTY")
+		}
+	default:
+		return nil, p.unexpected(tok, "an operator")
+	}
+
+	if !fieldSupports(field, op) {
+		return nil, &queryError{Pos: tok.pos, Msg: fmt.Sprintf("operator '%s' is not supported for %s", strings.ToUpper(op), name)}
+	}
+
+	clause := clauseExpr{field: field, op: op}
+	switch op {
+	case "is empty", "is not empty":
+		return clause, nil
+	case "in", "not in":
+		if open := p.next(); open.kind != tokenLParen {
+			return nil, p.unexpected(open, "'('")
+		}
+		for {
+			value, err := p.parseValue(field, name, op)
+			if err != nil {
+				return nil, err
+			}
+			clause.values = append(clause.values, value)
+			sep := p.next()
+			if sep.kind == tokenRParen {
+				break
+			}
+			if sep.kind != tokenComma {
+				return nil, p.unexpected(sep, "',' or ')'")
+			}
+		}
+		return clause, nil
+	}
+	value, err := p.parseValue(field, name, op)
+	if err != nil {
+		return nil, err
+	}
+	clause.values = []interface{}{value}
+	return clause, nil
+}
+
+// fieldSupports reports whether an operator can be used with a field.
+func fieldSupports(field queryField, op string) bool {
+	switch op {
+	case "is empty", "is not empty":
+		return field.nullable
+	case "~", "!~":
+		return field.kind == fieldText || field.kind == fieldFullText
+	case "<", "<=", ">", ">=":
+		return field.kind == fieldPriority || field.kind == fieldDate
+	case "=", "!=", "in", "not in":
+		return field.kind != fieldDate && field.kind != fieldFullText
+	}
+	return false
+}
+
+// parseValue reads one value and converts it to what the column holds.
+func (p *queryParser) parseValue(field queryField, name, op string) (interface{}, error) {
+	tok := p.next()
+	if tok.kind != tokenWord && tok.kind != tokenString {
+		return nil, p.unexpected(tok, "a value")
+	}
+	invalid := func(format string, args ...interface{}) error {
+		return &queryError{Pos: tok.pos, Msg: fmt.Sprintf(format, args...)}
+	}
+
+	switch field.kind {
+	case fieldPriority:
+		level := strings.ToLower(tok.text)
+		for i, candidate := range priorityLevels {
+			if level == candidate {
+				if op == "=" || op == "!=" || op == "in" || op == "not in" {
+					return level, nil
+				}
+				return i + 1, nil
+			}
+		}
+		return nil, invalid("priority must be one of %s", strings.Join(priorityLevels, ", "))
+	case fieldUser:
+		if tok.kind == tokenWord && strings.EqualFold(tok.text, "me") {
+			return p.userID, nil
+		}
+		if _, err := uuid.Parse(tok.text); err != nil {
+			return nil, invalid("%s must be a user ID or me", name)
+		}
+		return tok.text, nil
+	case fieldID:
+		if _, err := uuid.Parse(tok.text); err != nil {
+			return nil, invalid("%s must be an ID", name)
+		}
+		return tok.text, nil
+	case fieldDate:
+		date, ok := parseQueryDate(tok.text, p.now)
+		if !ok {
+			return nil, invalid("%s must be a date such as 2024-01-31 or a relative time such as -7d", name)
+		}
+		return date, nil
+	case fieldLabel:
+		return strings.ToLower(tok.text), nil
+	case fieldFullText:
+		tsQuery := buildTSQuery(tok.text)
+		if tsQuery == "" {
+			return nil, invalid("%s must contain at least one word", name)
+		}
+		return tsQuery, nil
+	}
+
+	if op == "~" || op == "!~" {
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(tok.text)
+		return "%" + escaped + "%", nil
+	}
+	return tok.text, nil
+}
+
+// queryMaxRelative bounds relative dates, which keeps the offset well inside
+// what a time.Duration can hold.
+const queryMaxRelative = 100 * 365 * 24 * time.Hour
+
+// parseQueryDate accepts an RFC 3339 timestamp, a YYYY-MM-DD date or a time
+// relative to now such as -30m, -4h, -7d or -2w, up to 100 years away.
+func parseQueryDate(text string, now time.Time) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, text); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse("2006-01-02", text); err == nil {
+		return t, true
+	}
+	if len(text) < 2 || (text[0] != '-' && text[0] != '+') {
+		return time.Time{}, false
+	}
+	amount, err := strconv.Atoi(text[1 : len(text)-1])
+	if err != nil || amount < 0 {
+		return time.Time{}, false
+	}
+	var unit time.Duration
+	switch text[len(text)-1] {
+	case 'm':
+		unit = time.Minute
+	case 'h':
+		unit = time.Hour
+	case 'd':
+		unit = 24 * time.Hour
+	case 'w':
+		unit = 7 * 24 * time.Hour
+	default:
+		return time.Time{}, false
+	}
+	if time.Duration(amount) > queryMaxRelative/unit {
+		return time.Time{}, false
+	}
+	offset := time.Duration(amount) * unit
+	if text[0] == '-' {
+		offset = -offset
+	}
+	return now.Add(offset), true
+}
+
+func (p *queryParser) parseOrder() (queryOrder, error) {
+	field, tok, err := p.parseField()
+	if err != nil {
+		return queryOrder{}, err
+	}
+	if !field.sortable {
+		return queryOrder{}, &queryError{Pos: tok.pos, Msg: fmt.Sprintf("cannot order by %s", strings.ToLower(tok.text))}
+	}
+	order := queryOrder{field: field}
+	if dir := p.peek(); dir.is("desc") {
+		order.desc = true
+		p.next()
+	} else if dir.is("asc") {
+		p.next()
+	}
+	return order, nil
+}
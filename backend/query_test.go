@@ -0,0 +1,253 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var (
+	queryTestNow  = time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	queryTestUser = "11111111-1111-1111-1111-111111111111"
+)
+
+func TestTokenizeQuery(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []queryToken
+	}{
+		{
+			"status!=open",
+			[]queryToken{{tokenWord, "status", 0}, {tokenOperator, "!=", 6}, {tokenWord, "open", 8}},
+		},
+		{
+			"a<=b c>=d e!~f g~h",
+			[]queryToken{
+				{tokenWord, "a", 0}, {tokenOperator, "<=", 1}, {tokenWord, "b", 3},
+				{tokenWord, "c", 5}, {tokenOperator, ">=", 6}, {tokenWord, "d", 8},
+				{tokenWord, "e", 10}, {tokenOperator, "!~", 11}, {tokenWord, "f", 13},
+				{tokenWord, "g", 15}, {tokenOperator, "~", 16}, {tokenWord, "h", 17},
+			},
+		},
+		{
+			`title ~ "login page"`,
+			[]queryToken{{tokenWord, "title", 0}, {tokenOperator, "~", 6}, {tokenString, "login page", 8}},
+		},
+		{
+			`'it\'s' "say \"hi\"" "back\\slash"`,
+			[]queryToken{{tokenString, "it's", 0}, {tokenString, `say "hi"`, 8}, {tokenString, `back\slash`, 21}},
+		},
+		{
+			"label in (ui,api)",
+			[]queryToken{
+				{tokenWord, "label", 0}, {tokenWord, "in", 6}, {tokenLParen, "(", 9},
+				{tokenWord, "ui", 10}, {tokenComma, ",", 12}, {tokenWord, "api", 13}, {tokenRParen, ")", 16},
+			},
+		},
+		{
+			"created > -7d",
+			[]queryToken{{tokenWord, "created", 0}, {tokenOperator, ">", 8}, {tokenWord, "-7d", 10}},
+		},
+		{
+			"título = ñ",
+			[]queryToken{{tokenWord, "título", 0}, {tokenOperator, "=", 8}, {tokenWord, "ñ", 10}},
+		},
+	}
+	for _, tt := range tests {
+		got, err := tokenizeQuery(tt.input)
+		if err != nil {
+			t.Errorf("tokenizeQuery(%q): %v", tt.input, err)
+			continue
+		}
+		want := append(tt.want, queryToken{kind: tokenEOF, pos: len(tt.input)})
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("tokenizeQuery(%q) =\n%v\nwant\n%v", tt.input, got, want)
+		}
+	}
+}
+
+func TestParseIssueQuerySQL(t *testing.T) {
+	tests := []struct {
+		input string
+		sql   string
+		args  []interface{}
+	}{
+		// AND binds tighter than OR
+		{
+			"status = open OR status = closed AND priority = high",
+			"(status = $1 OR (status = $2 AND priority = $3))",
+			[]interface{}{"open", "closed", "high"},
+		},
+		{
+			"(status = open OR status = closed) AND priority = high",
+			"((status = $1 OR status = $2) AND priority = $3)",
+			[]interface{}{"open", "closed", "high"},
+		},
+		{
+			"NOT status = open AND title ~ crash",
+			"(NOT (status = $1) AND title ILIKE $2)",
+			[]interface{}{"open", "%crash%"},
+		},
+		{
+			"not (status = open or status = done)",
+			"NOT ((status = $1 OR status = $2))",
+			[]interface{}{"open", "done"},
+		},
+		{
+			"status in (open, 'in progress') AND resolution not in (fixed)",
+			"(status IN ($1, $2) AND (resolution IS NULL OR NOT resolution IN ($3)))",
+			[]interface{}{"open", "in progress", "fixed"},
+		},
+		{
+			"priority >= high",
+			priorityRank + " >= $1",
+			[]interface{}{3},
+		},
+		{
+			"priority != LOW",
+			"(priority IS NULL OR priority <> $1)",
+			[]interface{}{"low"},
+		},
+		{
+			"assignee = me and reporter != " + queryTestUser,
+			"(assigned_to = $1 AND (created_by IS NULL OR created_by <> $2))",
+			[]interface{}{queryTestUser, queryTestUser},
+		},
+		{
+			"assignee is empty or description is not null",
+			"(assigned_to IS NULL OR (description IS NOT NULL AND description <> ''))",
+			nil,
+		},
+		{
+			"created > -7d AND updated <= 2024-01-31",
+			"(created_at > $1 AND updated_at <= $2)",
+			[]interface{}{queryTestNow.Add(-7 * 24 * time.Hour), time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			`title !~ "50%_off\\"`,
+			"NOT COALESCE(title ILIKE $1, false)",
+			[]interface{}{`%50\%\_off\\%`},
+		},
+		{
+			`text ~ "login failed"`,
+			"search_vector @@ to_tsquery('english', $1)",
+			[]interface{}{"login & failed"},
+		},
+		{
+			"label in (Bug, UI)",
+			labelExistsSQL("LOWER(l.name) IN ($1, $2)"),
+			[]interface{}{"bug", "ui"},
+		},
+		{
+			"label != wontfix",
+			"NOT " + labelExistsSQL("LOWER(l.name) IN ($1)"),
+			[]interface{}{"wontfix"},
+		},
+	}
+	for _, tt := range tests {
+		query, err := parseIssueQuery(tt.input, queryTestUser, queryTestNow)
+		if err != nil {
+			t.Errorf("parseIssueQuery(%q): %v", tt.input, err)
+			continue
+		}
+		b := &sqlBuilder{}
+		if got := query.where.sql(b); got != tt.sql {
+			t.Errorf("parseIssueQuery(%q) SQL =\n%s\nwant\n%s", tt.input, got, tt.sql)
+		}
+		if !reflect.DeepEqual(b.args, tt.args) {
+			t.Errorf("parseIssueQuery(%q) args = %#v, want %#v", tt.input, b.args, tt.args)
+		}
+	}
+}
+
+func TestParseIssueQueryOrder(t *testing.T) {
+	tests := []struct {
+		input string
+		where bool
+		order string
+	}{
+		{"", false, ""},
+		{"ORDER BY updated DESC", false, "updated_at DESC, id"},
+		{"status = open order by priority desc, title asc, created", true, priorityRank + " DESC, title, created_at, id"},
+	}
+	for _, tt := range tests {
+		query, err := parseIssueQuery(tt.input, queryTestUser, queryTestNow)
+		if err != nil {
+			t.Errorf("parseIssueQuery(%q): %v", tt.input, err)
+			continue
+		}
+		if (query.where != nil) != tt.where {
+			t.Errorf("parseIssueQuery(%q) where = %v, want a condition: %v", tt.input, query.where, tt.where)
+		}
+		if got := query.orderSQL(); got != tt.order {
+			t.Errorf("parseIssueQuery(%q) order = %q, want %q", tt.input, got, tt.order)
+		}
+	}
+}
+
+func TestParseIssueQueryErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{`title ~ "open`, "unterminated string at position 8"},
+		{"status ! open", "unexpected '!' at position 7"},
+		{"status = #1", `unexpected character '#' at position 9`},
+		{"colour = red", "unknown field 'colour' at position 0"},
+		{"status open", "expected an operator but found 'open' at position 7"},
+		{"status =", "expected a value but found end of query at position 8"},
+		{"(status = open", "expected ')' but found end of query at position 14"},
+		{"status = open priority = high", "expected AND, OR or ORDER BY but found 'priority' at position 14"},
+		{"status = open AND", "expected a field name but found end of query at position 17"},
+		{"status in (open done)", "expected ',' or ')' but found 'done' at position 16"},
+		{"status in open", "expected '(' but found 'open' at position 10"},
+		{"status not like x", "expected IN but found 'like' at position 11"},
+		{"assignee is missing", "expected EMPTY but found 'missing' at position 12"},
+		{"status > open", "operator '>' is not supported for status at position 7"},
+		{"status is empty", "operator 'IS EMPTY' is not supported for status at position 7"},
+		{"created = -1d", "operator '=' is not supported for created at position 8"},
+		{"priority = urgent", "priority must be one of low, medium, high, critical at position 11"},
+		{"assignee = bob", "assignee must be a user ID or me at position 11"},
+		{"milestone = 7", "milestone must be an ID at position 12"},
+		{"created > yesterday", "created must be a date such as 2024-01-31 or a relative time such as -7d at position 10"},
+		{"text ~ '!!'", "text must contain at least one word at position 7"},
+		{"ORDER updated", "expected BY but found 'updated' at position 6"},
+		{"ORDER BY description", "cannot order by description at position 9"},
+	}
+	for _, tt := range tests {
+		_, err := parseIssueQuery(tt.input, queryTestUser, queryTestNow)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("parseIssueQuery(%q) error = %v, want %q", tt.input, err, tt.err)
+		}
+	}
+}
+
+func TestParseQueryDate(t *testing.T) {
+	tests := []struct {
+		text string
+		want time.Time
+		ok   bool
+	}{
+		{"2024-01-31", time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC), true},
+		{"2024-01-31T08:30:00Z", time.Date(2024, 1, 31, 8, 30, 0, 0, time.UTC), true},
+		{"-30m", queryTestNow.Add(-30 * time.Minute), true},
+		{"+4h", queryTestNow.Add(4 * time.Hour), true},
+		{"-2w", queryTestNow.Add(-14 * 24 * time.Hour), true},
+		{"-5200w", queryTestNow.Add(-5200 * 7 * 24 * time.Hour), true},
+		{"-36500d", queryTestNow.Add(-36500 * 24 * time.Hour), true},
+		// Large offsets would overflow a time.Duration
+		{"-36501d", time.Time{}, false},
+		{"-999999999w", time.Time{}, false},
+		{"-99999999999999999999d", time.Time{}, false},
+		{"--1d", time.Time{}, false},
+		{"-7y", time.Time{}, false},
+		{"7d", time.Time{}, false},
+		{"-d", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseQueryDate(tt.text, queryTestNow)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("parseQueryDate(%q) = %v, %v; want %v, %v", tt.text, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	liveBufferSize   = 64
+	liveHeartbeat    = 25 * time.Second
+	liveStreamMaxAge = 10 * time.Minute
+	liveRetryMillis  = 3000
+)
+
+// Live event fan-out for connected clients
+var broker eventBroker = newMemoryBroker()
+
+// liveEvent is an issue, comment or project event as sent to streams. Payload
+// is the same JSON document webhooks receive.
+type liveEvent struct {
+	ID        string
+	Event     string
+	ProjectID string
+	Payload   []byte
+}
+
+// eventBroker fans events out to subscribers. The in-memory broker only
+// reaches clients of this process; a Postgres LISTEN/NOTIFY broker can take
+// its place when several replicas run behind a load balancer.
+type eventBroker interface {
+	Publish(event liveEvent)
+	// Subscribe returns a channel of events and a function that stops the
+	// subscription. The channel is closed if the subscriber falls behind.
+	Subscribe() (<-chan liveEvent, func())
+}
+
+type memoryBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan liveEvent]struct{}
+}
+
+func newMemoryBroker() *memoryBroker {
+	return &memoryBroker{subscribers: make(map[chan liveEvent]struct{})}
+}
+
+// Publish never blocks; subscribers with a full buffer are dropped so one
+// slow client cannot hold up the request that published the event.
+func (b *memoryBroker) Publish(event liveEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+func (b *memoryBroker) Subscribe() (<-chan liveEvent, func()) {
+	ch := make(chan liveEvent, liveBufferSize)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// streamEventsHandler streams events from every project the user can see, or
+// from one project with ?project_id=, as Server-Sent Events. The session is
+// checked again and the cached project roles dropped on every heartbeat, so a
+// user removed from a project stops receiving its events within
+// liveHeartbeat. Streams end after liveStreamMaxAge so clients reconnect and
+// are authorized again.
+func streamEventsHandler(c *gin.Context) {
+	principal := currentPrincipal(c)
+	projectID := c.Query("project_id")
+	if projectID != "" && !authorize(c, projectID, "project:view") {
+		return
+	}
+
+	events, unsubscribe := broker.Subscribe()
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", liveRetryMillis)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(liveHeartbeat)
+	defer heartbeat.Stop()
+	expired := time.NewTimer(liveStreamMaxAge)
+	defer expired.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-expired.C:
+			return false
+		case <-heartbeat.C:
+			if active, err := isSessionActive(principal.SessionID, principal.ID); err != nil || !active {
+				return false
+			}
+			principal.forgetProjectRoles()
+			fmt.Fprint(w, ": ping\n\n")
+			return true
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			if projectID != "" && event.ProjectID != projectID {
+				return true
+			}
+			if ok, err := principal.Can(event.ProjectID, "project:view"); err != nil || !ok {
+				return true
+			}
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Event, event.Payload)
+			return true
+		}
+	})
+}
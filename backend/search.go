@@ -0,0 +1,196 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ts_headline options for search snippets. Matches are wrapped in <mark>.
+const headlineOptions = `StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=25, MinWords=8, FragmentDelimiter=" … "`
+
+// buildTSQuery turns search box input into a to_tsquery expression. Words
+// must all match, "quoted phrases" match adjacent words, a trailing * makes a
+// prefix match, a leading - excludes a term and OR between terms matches
+// either. Anything that is not a letter or digit is discarded, so the result
+// is always safe to pass to to_tsquery. An empty result means there was
+// nothing to search for.
+func buildTSQuery(input string) string {
+	var query strings.Builder
+	pendingOr := false
+	rest := strings.TrimSpace(input)
+
+	for rest != "" {
+		var token string
+		phrase := false
+		if rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				token, rest = rest[1:], ""
+			} else {
+				token, rest = rest[1:end+1], rest[end+2:]
+			}
+			phrase = true
+		} else {
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				token, rest = rest, ""
+			} else {
+				token, rest = rest[:end], rest[end:]
+			}
+		}
+		rest = strings.TrimSpace(rest)
+
+		if !phrase && token == "OR" {
+			pendingOr = query.Len() > 0
+			continue
+		}
+
+		negate := !phrase && strings.HasPrefix(token, "-")
+		prefix := !phrase && strings.HasSuffix(token, "*")
+		words := searchLexemes(token)
+		if len(words) == 0 {
+			continue
+		}
+		if prefix {
+			words[len(words)-1] += ":*"
+		}
+		term := strings.Join(words, " <-> ")
+		if len(words) > 1 {
+			term = "(" + term + ")"
+		}
+		if negate {
+			term = "!" + term
+		}
+
+		if query.Len() > 0 {
+			if pendingOr {
+				query.WriteString(" | ")
+			} else {
+				query.WriteString(" & ")
+			}
+		}
+		pendingOr = false
+		query.WriteString(term)
+	}
+	return query.String()
+}
+
+// searchLexemes splits text into lowercase runs of letters and digits.
+func searchLexemes(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// escapeHTMLSQL wraps a SQL text expression so that it is HTML-escaped before
+// ts_headline adds its <mark> tags.
+func escapeHTMLSQL(expr string) string {
+	return `replace(replace(replace(` + expr + `, '&', '&amp;'), '<', '&lt;'), '>', '&gt;')`
+}
+
+func searchHandler(c *gin.Context) {
+	tsQuery := buildTSQuery(c.Query("q"))
+	if tsQuery == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Search query must contain at least one word"})
+		return
+	}
+
+	searchType := c.DefaultQuery("type", "all")
+	if searchType != "all" && searchType != "issues" && searchType != "comments" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Type must be one of all, issues or comments"})
+		return
+	}
+
+	limit := 20
+	offset := 0
+	if l := c.Query("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if v, err := strconv.Atoi(o); err == nil && v >= 0 {
+			offset = v
+		}
+	}
+
+	// Restrict results to one project, or to every project the caller can see
+	args := []interface{}{tsQuery}
+	scope := ""
+	if projectID := c.Query("project_id"); projectID != "" {
+		if !authorize(c, projectID, "project:view") {
+			return
+		}
+		args = append(args, projectID)
+		scope = ` AND i.project_id = $2`
+	} else {
+		principal := currentPrincipal(c)
+		global, err := principal.Can("", "project:view")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			return
+		}
+		if !global {
+			args = append(args, principal.User.ID)
+			scope = ` AND i.project_id IN (SELECT project_id FROM project_members WHERE user_id = $2)`
+		}
+	}
+
+	var parts []string
+	if searchType != "comments" {
+		parts = append(parts, `
+		SELECT 'issue' AS type, i.id, i.id AS issue_id, i.project_id, i.title AS issue_title,
+			ts_headline('english', `+escapeHTMLSQL(`i.title || ' — ' || COALESCE(i.description, '')`)+`, q.query, '`+headlineOptions+`') AS snippet,
+			ts_rank_cd(i.search_vector, q.query) AS rank, i.updated_at
+		FROM issues i, q
+		WHERE i.search_vector @@ q.query`+scope)
+	}
+	if searchType != "issues" {
+		parts = append(parts, `
+		SELECT 'comment' AS type, cm.id, cm.issue_id, i.project_id, i.title AS issue_title,
+			ts_headline('english', `+escapeHTMLSQL(`cm.content`)+`, q.query, '`+headlineOptions+`') AS snippet,
+			ts_rank_cd(cm.search_vector, q.query) AS rank, cm.updated_at
+		FROM comments cm
+		JOIN issues i ON i.id = cm.issue_id, q
+		WHERE cm.search_vector @@ q.query`+scope)
+	}
+	hits := `WITH q AS (SELECT to_tsquery('english', $1) AS query) ` + strings.Join(parts, " UNION ALL ")
+
+	var total int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM (`+hits+`) hits`, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search"})
+		return
+	}
+
+	idx := len(args) + 1
+	query := hits + ` ORDER BY rank DESC, updated_at DESC LIMIT $` + strconv.Itoa(idx) + ` OFFSET $` + strconv.Itoa(idx+1)
+	args = append(args, limit, offset)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search"})
+		return
+	}
+	defer rows.Close()
+
+	results := []SearchHit{}
+	for rows.Next() {
+		var hit SearchHit
+		if err := rows.Scan(&hit.Type, &hit.ID, &hit.IssueID, &hit.ProjectID, &hit.IssueTitle, &hit.Snippet, &hit.Rank, &hit.UpdatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read search results"})
+			return
+		}
+		results = append(results, hit)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results": results,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+		"query":   tsQuery,
+	})
+}
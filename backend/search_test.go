@@ -0,0 +1,73 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+// tsQuerySyntax matches the to_tsquery expressions buildTSQuery may produce:
+// lexemes, optionally prefix matched, alone or in a phrase, possibly negated,
+// joined by & or |.
+var tsQuerySyntax = func() *regexp.Regexp {
+	lexeme := `[\p{L}\p{N}]+(?::\*)?`
+	term := `!?(?:` + lexeme + `|\(` + lexeme + `(?: <-> ` + lexeme + `)+\))`
+	return regexp.MustCompile(`^(?:` + term + `(?: [&|] ` + term + `)*)?$`)
+}()
+
+func TestBuildTSQuery(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"login page", "login & page"},
+		{"  Login   PAGE  ", "login & page"},
+		{"", ""},
+
+		// Quotes
+		{`"login page"`, "(login <-> page)"},
+		{`"login page" crash`, "(login <-> page) & crash"},
+		{`"login page`, "(login <-> page)"},
+		{`"" crash`, "crash"},
+		{`"-crash* OR"`, "(crash <-> or)"},
+
+		// Prefix terms
+		{"log*", "log:*"},
+		{"foo-bar*", "(foo <-> bar:*)"},
+		{"*", ""},
+		{"a**", "a:*"},
+
+		// Negation
+		{"-crash", "!crash"},
+		{"login -crash", "login & !crash"},
+		{"-log*", "!log:*"},
+		{"-foo-bar", "!(foo <-> bar)"},
+		{"-", ""},
+		{"-OR", "!or"},
+
+		// OR
+		{"crash OR panic", "crash | panic"},
+		{"crash OR -panic", "crash | !panic"},
+		{"OR crash", "crash"},
+		{"crash OR", "crash"},
+		{"crash OR OR panic", "crash | panic"},
+		{"crash or panic", "crash & or & panic"},
+
+		// Punctuation and tsquery operators are dropped
+		{"a & b | !c", "a & b & c"},
+		{"foo:* (bar) <-> 'baz'", "foo:* & bar & baz"},
+		{`\ : ! & | ( ) <-> '`, ""},
+		{"user@example.com", "(user <-> example <-> com)"},
+		{"don't", "(don <-> t)"},
+		{"x:A", "(x <-> a)"},
+		{"Ünïcode ÄPI", "ünïcode & äpi"},
+	}
+	for _, tt := range tests {
+		got := buildTSQuery(tt.input)
+		if got != tt.want {
+			t.Errorf("buildTSQuery(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+		if !tsQuerySyntax.MatchString(got) {
+			t.Errorf("buildTSQuery(%q) = %q, which is not a valid tsquery", tt.input, got)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var errInvalidRefreshToken = errors.New("invalid refresh token")
+
+func refreshHandler(c *gin.Context) {
+	var body struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, refreshToken, err := rotateSession(body.RefreshToken)
+	if err != nil {
+		if errors.Is(err, errInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	token, err := generateJWT(session.UserID, session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int(accessTokenTTL.Seconds()),
+	})
+}
+
+func logoutHandler(c *gin.Context) {
+	sessionID := c.GetString("session_id")
+	if err := revokeSession(sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+func logoutAllHandler(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if err := revokeUserSessions(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "All sessions logged out successfully"})
+}
+
+func getSessionsHandler(c *gin.Context) {
+	userID := c.GetString("user_id")
+	sessions, err := getActiveSessionsByUser(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+	if sessions == nil {
+		sessions = []Session{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"sessions":        sessions,
+		"current_session": c.GetString("session_id"),
+	})
+}
+
+// newRefreshToken returns an opaque random token and the hash that is stored
+// in its place. The raw token is only ever handed to the client.
+func newRefreshToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func createSession(userID, userAgent, ipAddress string) (Session, string, error) {
+	token, tokenHash, err := newRefreshToken()
+	if err != nil {
+		return Session{}, "", err
+	}
+
+	now := time.Now()
+	session := Session{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		UserAgent:  userAgent,
+		IPAddress:  ipAddress,
+		ExpiresAt:  now.Add(refreshTokenTTL).Format(time.RFC3339),
+		CreatedAt:  now.Format(time.RFC3339),
+		LastUsedAt: now.Format(time.RFC3339),
+	}
+
+	query := `
+	INSERT INTO sessions (id, user_id, refresh_token_hash, user_agent, ip_address, expires_at, created_at, last_used_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err = db.Exec(query, session.ID, session.UserID, tokenHash, session.UserAgent, session.IPAddress, session.ExpiresAt, session.CreatedAt, session.LastUsedAt)
+	if err != nil {
+		log.Printf("Database error creating session: %v", err)
+		return Session{}, "", err
+	}
+	return session, token, nil
+}
+
+// rotateSession exchanges a refresh token for a new one. Presenting a token
+// that was already rotated out is treated as theft and revokes the session.
+func rotateSession(refreshToken string) (Session, string, error) {
+	tokenHash := hashToken(refreshToken)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Session{}, "", err
+	}
+	defer tx.Rollback()
+
+	var session Session
+	var currentHash string
+	var expired bool
+	query := `
+	SELECT id, user_id, refresh_token_hash, COALESCE(user_agent, ''), COALESCE(ip_address, ''), expires_at, expires_at <= NOW(), revoked_at, created_at, last_used_at
+	FROM sessions
+	WHERE refresh_token_hash = $1 OR previous_token_hash = $1
+	FOR UPDATE
+	`
+	err = tx.QueryRow(query, tokenHash).Scan(&session.ID, &session.UserID, &currentHash, &session.UserAgent, &session.IPAddress, &session.ExpiresAt, &expired, &session.RevokedAt, &session.CreatedAt, &session.LastUsedAt)
+	if err == sql.ErrNoRows {
+		return Session{}, "", errInvalidRefreshToken
+	}
+	if err != nil {
+		return Session{}, "", err
+	}
+
+	if session.RevokedAt != nil {
+		return Session{}, "", errInvalidRefreshToken
+	}
+
+	if currentHash != tokenHash {
+		log.Printf("Refresh token reuse detected for session %s, revoking", session.ID)
+		if _, err := tx.Exec(`UPDATE sessions SET revoked_at = NOW() WHERE id = $1`, session.ID); err != nil {
+			return Session{}, "", err
+		}
+		if err := tx.Commit(); err != nil {
+			return Session{}, "", err
+		}
+		return Session{}, "", errInvalidRefreshToken
+	}
+
+	if expired {
+		return Session{}, "", errInvalidRefreshToken
+	}
+
+	newToken, newHash, err := newRefreshToken()
+	if err != nil {
+		return Session{}, "", err
+	}
+
+	session.LastUsedAt = time.Now().Format(time.RFC3339)
+	update := `
+	UPDATE sessions
+	SET refresh_token_hash = $1, previous_token_hash = $2, last_used_at = $3
+	WHERE id = $4
+	`
+	if _, err := tx.Exec(update, newHash, tokenHash, session.LastUsedAt, session.ID); err != nil {
+		return Session{}, "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return Session{}, "", err
+	}
+	return session, newToken, nil
+}
+
+func isSessionActive(sessionID, userID string) (bool, error) {
+	var active bool
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM sessions
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > NOW()
+	)
+	`
+	err := db.QueryRow(query, sessionID, userID).Scan(&active)
+	return active, err
+}
+
+func getActiveSessionsByUser(userID string) ([]Session, error) {
+	query := `
+	SELECT id, user_id, COALESCE(user_agent, ''), COALESCE(ip_address, ''), expires_at, created_at, last_used_at
+	FROM sessions
+	WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+	ORDER BY last_used_at DESC
+	`
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IPAddress, &session.ExpiresAt, &session.CreatedAt, &session.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func revokeSession(sessionID string) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`
+	_, err := db.Exec(query, sessionID)
+	if err != nil {
+		log.Printf("Database error revoking session: %v", err)
+	}
+	return err
+}
+
+func revokeUserSessions(userID string) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	_, err := db.Exec(query, userID)
+	if err != nil {
+		log.Printf("Database error revoking sessions: %v", err)
+	}
+	return err
+}
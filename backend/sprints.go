@@ -0,0 +1,585 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var (
+	errSprintNotActive   = errors.New("sprint is not active")
+	errSprintActive      = errors.New("project already has an active sprint")
+	errInvalidNextSprint = errors.New("next sprint must be a planned sprint in the project")
+	errIssueNotInProject = errors.New("issue does not belong to the project")
+)
+
+func getSprintsHandler(c *gin.Context) {
+	projectID := c.Param("id")
+	state := c.DefaultQuery("state", "all")
+	if state != "all" && state != "planned" && state != "active" && state != "completed" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "State must be one of all, planned, active or completed"})
+		return
+	}
+
+	sprints, err := getSprintsByProject(projectID, state)
+	if err == nil {
+		err = attachSprintProgress(projectID, sprints)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sprints"})
+		return
+	}
+	if sprints == nil {
+		sprints = []Sprint{}
+	}
+	c.JSON(http.StatusOK, gin.H{"sprints": sprints})
+}
+
+func getSprintHandler(c *gin.Context) {
+	sprint, ok := loadSprint(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, sprint)
+}
+
+func createSprintHandler(c *gin.Context) {
+	var body struct {
+		Name      string  `json:"name" binding:"required"`
+		Goal      string  `json:"goal"`
+		StartDate *string `json:"start_date"`
+		EndDate   *string `json:"end_date"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sprint := Sprint{
+		ID:        uuid.New().String(),
+		ProjectID: c.Param("id"),
+		Name:      strings.TrimSpace(body.Name),
+		Goal:      body.Goal,
+		StartDate: nilIfEmpty(body.StartDate),
+		EndDate:   nilIfEmpty(body.EndDate),
+		State:     "planned",
+		CreatedBy: strPtr(c.GetString("user_id")),
+	}
+	if !validateSprint(c, sprint) {
+		return
+	}
+
+	query := `
+	INSERT INTO sprints (id, project_id, name, goal, start_date, end_date, state, created_by)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := db.Exec(query, sprint.ID, sprint.ProjectID, sprint.Name, sprint.Goal, sprint.StartDate, sprint.EndDate, sprint.State, sprint.CreatedBy)
+	if err != nil {
+		log.Printf("Database error creating sprint: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sprint"})
+		return
+	}
+	respondWithSprint(c, http.StatusCreated, sprint.ProjectID, sprint.ID)
+}
+
+func updateSprintHandler(c *gin.Context) {
+	sprint, ok := loadSprint(c)
+	if !ok {
+		return
+	}
+
+	// Only the fields present in the body are changed; empty dates clear them
+	var body struct {
+		Name      *string `json:"name"`
+		Goal      *string `json:"goal"`
+		StartDate *string `json:"start_date"`
+		EndDate   *string `json:"end_date"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if body.Name != nil {
+		sprint.Name = strings.TrimSpace(*body.Name)
+	}
+	if body.Goal != nil {
+		sprint.Goal = *body.Goal
+	}
+	if body.StartDate != nil {
+		sprint.StartDate = nilIfEmpty(body.StartDate)
+	}
+	if body.EndDate != nil {
+		sprint.EndDate = nilIfEmpty(body.EndDate)
+	}
+	if !validateSprint(c, sprint) {
+		return
+	}
+
+	query := `
+	UPDATE sprints
+	SET name = $1, goal = $2, start_date = $3, end_date = $4, updated_at = NOW()
+	WHERE id = $5
+	`
+	if _, err := db.Exec(query, sprint.Name, sprint.Goal, sprint.StartDate, sprint.EndDate, sprint.ID); err != nil {
+		log.Printf("Database error updating sprint: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update sprint"})
+		return
+	}
+	respondWithSprint(c, http.StatusOK, sprint.ProjectID, sprint.ID)
+}
+
+// deleteSprintHandler deletes a planned or completed sprint. Its issues move
+// back to the backlog.
+func deleteSprintHandler(c *gin.Context) {
+	sprint, ok := loadSprint(c)
+	if !ok {
+		return
+	}
+	if sprint.State == "active" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Complete the sprint before deleting it"})
+		return
+	}
+	if _, err := db.Exec(`DELETE FROM sprints WHERE id = $1`, sprint.ID); err != nil {
+		log.Printf("Database error deleting sprint: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete sprint"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Sprint deleted successfully"})
+}
+
+// startSprintHandler makes a planned sprint the project's active sprint.
+func startSprintHandler(c *gin.Context) {
+	sprint, ok := loadSprint(c)
+	if !ok {
+		return
+	}
+	if sprint.State != "planned" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only planned sprints can be started"})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	err := withTx(func(tx *Tx) error {
+		// Lock the project so two sprints cannot be started at once
+		if _, err := tx.Exec(`SELECT id FROM projects WHERE id = $1 FOR UPDATE`, sprint.ProjectID); err != nil {
+			return err
+		}
+		var active int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM sprints WHERE project_id = $1 AND state = 'active'`, sprint.ProjectID).Scan(&active); err != nil {
+			return err
+		}
+		if active > 0 {
+			return errSprintActive
+		}
+
+		query := `
+		UPDATE sprints
+		SET state = 'active', started_at = NOW(), start_date = COALESCE(start_date, CURRENT_DATE), updated_at = NOW()
+		WHERE id = $1 AND state = 'planned'
+		`
+		if _, err := tx.Exec(query, sprint.ID); err != nil {
+			log.Printf("Database error starting sprint: %v", err)
+			return err
+		}
+		return enqueueWebhookEvent(tx, sprint.ProjectID, userID, "sprint.started", gin.H{"sprint_id": sprint.ID})
+	})
+	if errors.Is(err, errSprintActive) {
+		c.JSON(http.StatusConflict, gin.H{"error": "The project already has an active sprint"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sprint"})
+		return
+	}
+	respondWithSprint(c, http.StatusOK, sprint.ProjectID, sprint.ID)
+}
+
+// completeSprintHandler closes the active sprint. Issues that are not done
+// roll over to next_sprint_id, or to the earliest planned sprint if none is
+// given, or back to the backlog if there is no planned sprint.
+func completeSprintHandler(c *gin.Context) {
+	sprint, ok := loadSprint(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		NextSprintID *string `json:"next_sprint_id"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	nextSprintID := nilIfEmpty(body.NextSprintID)
+	if nextSprintID != nil {
+		if _, err := uuid.Parse(*nextSprintID); err != nil || *nextSprintID == sprint.ID {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Next sprint must be a planned sprint in the project"})
+			return
+		}
+	}
+
+	workflow, err := getProjectWorkflow(sprint.ProjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load workflow"})
+		return
+	}
+	userID := c.GetString("user_id")
+	err = withTx(func(tx *Tx) error {
+		var state string
+		if err := tx.QueryRow(`SELECT state FROM sprints WHERE id = $1 FOR UPDATE`, sprint.ID).Scan(&state); err != nil {
+			return err
+		}
+		if state != "active" {
+			return errSprintNotActive
+		}
+
+		if nextSprintID == nil {
+			query := `
+			SELECT id FROM sprints
+			WHERE project_id = $1 AND state = 'planned'
+			ORDER BY start_date ASC NULLS LAST, created_at ASC
+			LIMIT 1
+			`
+			var next string
+			err := tx.QueryRow(query, sprint.ProjectID).Scan(&next)
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+			if err == nil {
+				nextSprintID = &next
+			}
+		} else {
+			var nextState string
+			err := tx.QueryRow(`SELECT state FROM sprints WHERE id = $1 AND project_id = $2`, *nextSprintID, sprint.ProjectID).Scan(&nextState)
+			if err == sql.ErrNoRows || (err == nil && nextState != "planned") {
+				return errInvalidNextSprint
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		unfinished, err := queryIDs(tx, `SELECT id FROM issues WHERE sprint_id = $1 AND NOT (status = ANY($2))`, sprint.ID, pq.Array(workflow.DoneStatuses()))
+		if err != nil {
+			return err
+		}
+		for _, issueID := range unfinished {
+			if err := setIssueSprint(tx, issueID, &sprint.ID, nextSprintID, userID); err != nil {
+				return err
+			}
+		}
+
+		query := `
+		UPDATE sprints
+		SET state = 'completed', completed_at = NOW(), end_date = COALESCE(end_date, CURRENT_DATE),
+			completed_issue_count = (SELECT COUNT(*) FROM issues WHERE sprint_id = $1),
+			carried_over_issue_count = $2, updated_at = NOW()
+		WHERE id = $1
+		`
+		if _, err := tx.Exec(query, sprint.ID, len(unfinished)); err != nil {
+			log.Printf("Database error completing sprint: %v", err)
+			return err
+		}
+		return enqueueWebhookEvent(tx, sprint.ProjectID, userID, "sprint.completed", gin.H{
+			"sprint_id":      sprint.ID,
+			"next_sprint_id": nextSprintID,
+			"carried_over":   nonNilIDs(unfinished),
+		})
+	})
+	switch {
+	case errors.Is(err, errSprintNotActive):
+		c.JSON(http.StatusConflict, gin.H{"error": "Only the active sprint can be completed"})
+		return
+	case errors.Is(err, errInvalidNextSprint):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Next sprint must be a planned sprint in the project"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete sprint"})
+		return
+	}
+	respondWithSprint(c, http.StatusOK, sprint.ProjectID, sprint.ID)
+}
+
+// addSprintIssuesHandler moves issues from the backlog or another sprint
+// into a sprint.
+func addSprintIssuesHandler(c *gin.Context) {
+	sprint, ok := loadSprint(c)
+	if !ok {
+		return
+	}
+	if sprint.State == "completed" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Issues cannot be added to a completed sprint"})
+		return
+	}
+	moveIssuesToSprint(c, sprint.ProjectID, &sprint.ID)
+}
+
+// moveToBacklogHandler takes issues out of their sprints.
+func moveToBacklogHandler(c *gin.Context) {
+	moveIssuesToSprint(c, c.Param("id"), nil)
+}
+
+// getBacklogHandler lists the project's unfinished issues that are not in a
+// sprint, highest priority first.
+func getBacklogHandler(c *gin.Context) {
+	projectID := c.Param("id")
+	limit := 10
+	offset := 0
+	if l := c.Query("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if v, err := strconv.Atoi(o); err == nil && v >= 0 {
+			offset = v
+		}
+	}
+
+	workflow, err := getProjectWorkflow(projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load workflow"})
+		return
+	}
+	filter := issueFilter{ProjectID: projectID, Sprint: "none", ExcludeStatuses: workflow.DoneStatuses()}
+	filter.Queries = []*issueQuery{{orderBy: []queryOrder{{field: queryFields["priority"], desc: true}, {field: queryFields["created"]}}}}
+
+	total, err := countIssues(filter)
+	var issues []Issue
+	if err == nil {
+		issues, err = getIssuesPaginated(filter, limit, offset)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch backlog"})
+		return
+	}
+	if issues == nil {
+		issues = []Issue{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"issues":  issues,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+		"message": "Backlog fetched successfully",
+	})
+}
+
+// moveIssuesToSprint moves the issues listed in the request body into a
+// sprint, or to the backlog when sprintID is nil.
+func moveIssuesToSprint(c *gin.Context, projectID string, sprintID *string) {
+	var body struct {
+		IssueIDs []string `json:"issue_ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	issueIDs := uniqueStrings(body.IssueIDs)
+	for _, id := range issueIDs {
+		if _, err := uuid.Parse(id); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid issue ID: " + id})
+			return
+		}
+	}
+
+	userID := c.GetString("user_id")
+	moved := 0
+	err := withTx(func(tx *Tx) error {
+		rows, err := tx.Query(`SELECT id, sprint_id FROM issues WHERE project_id = $1 AND id = ANY($2::uuid[]) FOR UPDATE`, projectID, pq.Array(issueIDs))
+		if err != nil {
+			return err
+		}
+		current := map[string]*string{}
+		for rows.Next() {
+			var id string
+			var previous *string
+			if err := rows.Scan(&id, &previous); err != nil {
+				rows.Close()
+				return err
+			}
+			current[id] = previous
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(current) != len(issueIDs) {
+			return errIssueNotInProject
+		}
+
+		for _, id := range issueIDs {
+			if sameStringPtr(current[id], sprintID) {
+				continue
+			}
+			if err := setIssueSprint(tx, id, current[id], sprintID, userID); err != nil {
+				return err
+			}
+			moved++
+		}
+		return nil
+	})
+	if errors.Is(err, errIssueNotInProject) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "All issues must belong to the project"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move issues"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Issues moved successfully", "moved": moved})
+}
+
+// setIssueSprint moves an issue between sprints, or to or from the backlog,
+// as part of the caller's transaction.
+func setIssueSprint(tx *Tx, issueID string, previous, sprintID *string, changedBy string) error {
+	query := `UPDATE issues SET sprint_id = $1, updated_at = NOW() WHERE id = $2`
+	if _, err := tx.Exec(query, sprintID, issueID); err != nil {
+		log.Printf("Database error moving issue to sprint: %v", err)
+		return err
+	}
+	err := recordIssueEvent(tx, IssueEvent{
+		IssueID:   issueID,
+		ActorID:   strPtr(changedBy),
+		EventType: eventFieldChanged,
+		Field:     strPtr("sprint_id"),
+		OldValue:  previous,
+		NewValue:  sprintID,
+	})
+	if err != nil {
+		return err
+	}
+	return emitIssueWebhook(tx, issueID, changedBy, "issue.updated", gin.H{"changes": []string{"sprint_id"}})
+}
+
+// loadSprint loads the sprint named by the :sid parameter with its
+// progress. It writes the error response and returns false if it fails.
+func loadSprint(c *gin.Context) (Sprint, bool) {
+	projectID := c.Param("id")
+	sprint, err := getSprintByID(projectID, c.Param("sid"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sprint not found"})
+		return sprint, false
+	}
+	sprints := []Sprint{sprint}
+	if err := attachSprintProgress(projectID, sprints); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute sprint progress"})
+		return sprint, false
+	}
+	return sprints[0], true
+}
+
+func respondWithSprint(c *gin.Context, status int, projectID, sprintID string) {
+	sprint, err := getSprintByID(projectID, sprintID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sprint"})
+		return
+	}
+	sprints := []Sprint{sprint}
+	if err := attachSprintProgress(projectID, sprints); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute sprint progress"})
+		return
+	}
+	c.JSON(status, sprints[0])
+}
+
+// validateSprint checks a sprint's fields. It writes the error response and
+// returns false if the sprint is invalid.
+func validateSprint(c *gin.Context, sprint Sprint) bool {
+	if sprint.Name == "" || len(sprint.Name) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name must be between 1 and 255 characters"})
+		return false
+	}
+	var dates []time.Time
+	for _, date := range []*string{sprint.StartDate, sprint.EndDate} {
+		if date == nil {
+			continue
+		}
+		t, err := time.Parse("2006-01-02", *date)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Dates must look like 2024-01-31"})
+			return false
+		}
+		dates = append(dates, t)
+	}
+	if len(dates) == 2 && dates[1].Before(dates[0]) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "End date must not be before start date"})
+		return false
+	}
+	return true
+}
+
+// attachSprintProgress counts each sprint's issues by whether they are done.
+func attachSprintProgress(projectID string, sprints []Sprint) error {
+	if len(sprints) == 0 {
+		return nil
+	}
+	ids := make([]string, len(sprints))
+	for i, sprint := range sprints {
+		ids[i] = sprint.ID
+	}
+	progress, err := getIssueProgress(projectID, "sprint_id", ids)
+	if err != nil {
+		return err
+	}
+	for i := range sprints {
+		sprints[i].Progress = progress[sprints[i].ID]
+	}
+	return nil
+}
+
+const sprintColumns = `id, project_id, name, goal, to_char(start_date, 'YYYY-MM-DD'), to_char(end_date, 'YYYY-MM-DD'), state,
+	started_at, completed_at, completed_issue_count, carried_over_issue_count, created_by, created_at, updated_at`
+
+func scanSprint(row rowScanner) (Sprint, error) {
+	var s Sprint
+	err := row.Scan(&s.ID, &s.ProjectID, &s.Name, &s.Goal, &s.StartDate, &s.EndDate, &s.State,
+		&s.StartedAt, &s.CompletedAt, &s.CompletedIssues, &s.CarriedOverIssues, &s.CreatedBy, &s.CreatedAt, &s.UpdatedAt)
+	return s, err
+}
+
+func getSprintByID(projectID, sprintID string) (Sprint, error) {
+	query := `SELECT ` + sprintColumns + ` FROM sprints WHERE id = $1 AND project_id = $2`
+	return scanSprint(db.QueryRow(query, sprintID, projectID))
+}
+
+// getSprintsByProject lists sprints in the order they run, with undated
+// planned sprints last.
+func getSprintsByProject(projectID, state string) ([]Sprint, error) {
+	query := `SELECT ` + sprintColumns + ` FROM sprints WHERE project_id = $1`
+	args := []interface{}{projectID}
+	if state != "all" {
+		query += ` AND state = $2`
+		args = append(args, state)
+	}
+	query += ` ORDER BY start_date ASC NULLS LAST, created_at ASC`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sprints []Sprint
+	for rows.Next() {
+		sprint, err := scanSprint(rows)
+		if err != nil {
+			return nil, err
+		}
+		sprints = append(sprints, sprint)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sprints, nil
+}
@@ -0,0 +1,739 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	webhookMaxAttempts  = 8
+	webhookPollInterval = 5 * time.Second
+	webhookBatchSize    = 20
+	webhookTimeout      = 10 * time.Second
+	webhookLease        = time.Minute
+)
+
+// Events that webhooks can subscribe to
+var webhookEvents = map[string]bool{
+	"issue.created":      true,
+	"issue.updated":      true,
+	"issue.transitioned": true,
+	"issue.assigned":     true,
+	"issue.labeled":      true,
+	"issue.unlabeled":    true,
+	"issue.linked":       true,
+	"issue.unlinked":     true,
+	"issue.deleted":      true,
+	"comment.created":    true,
+	"comment.updated":    true,
+	"comment.deleted":    true,
+	"project.updated":    true,
+	"sprint.started":     true,
+	"sprint.completed":   true,
+}
+
+// webhookPayload is the JSON body POSTed to subscribers.
+type webhookPayload struct {
+	ID         string      `json:"id"`
+	Event      string      `json:"event"`
+	ProjectID  string      `json:"project_id"`
+	ActorID    string      `json:"actor_id"`
+	OccurredAt string      `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+func getWebhooksHandler(c *gin.Context) {
+	webhooks, err := getWebhooksByProject(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhooks"})
+		return
+	}
+	if webhooks == nil {
+		webhooks = []Webhook{}
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": webhooks})
+}
+
+func getWebhookHandler(c *gin.Context) {
+	webhook, err := getWebhookByID(c.Param("id"), c.Param("hookId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	c.JSON(http.StatusOK, webhook)
+}
+
+func createWebhookHandler(c *gin.Context) {
+	var body struct {
+		URL    string   `json:"url" binding:"required"`
+		Secret string   `json:"secret"`
+		Events []string `json:"events"`
+		Active *bool    `json:"active"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateWebhook(body.URL, body.Events); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Generate a signing secret if the caller did not supply one
+	if body.Secret == "" {
+		buf := make([]byte, 24)
+		if _, err := rand.Read(buf); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+			return
+		}
+		body.Secret = hex.EncodeToString(buf)
+	}
+
+	webhook := Webhook{
+		ID:        uuid.New().String(),
+		ProjectID: c.Param("id"),
+		URL:       body.URL,
+		Secret:    body.Secret,
+		Events:    body.Events,
+		Active:    body.Active == nil || *body.Active,
+		CreatedBy: strPtr(c.GetString("user_id")),
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+	webhook.UpdatedAt = webhook.CreatedAt
+	if webhook.Events == nil {
+		webhook.Events = []string{}
+	}
+
+	if err := createWebhook(webhook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+
+	// The secret is only ever returned when the webhook is created
+	c.JSON(http.StatusCreated, webhook)
+}
+
+func updateWebhookHandler(c *gin.Context) {
+	webhook, err := getWebhookByID(c.Param("id"), c.Param("hookId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	var body struct {
+		URL    *string  `json:"url"`
+		Secret *string  `json:"secret"`
+		Events []string `json:"events"`
+		Active *bool    `json:"active"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if body.URL != nil {
+		webhook.URL = *body.URL
+	}
+	if body.Events != nil {
+		webhook.Events = body.Events
+	}
+	if body.Active != nil {
+		webhook.Active = *body.Active
+	}
+	if err := validateWebhook(webhook.URL, webhook.Events); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := updateWebhook(webhook, body.Secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook"})
+		return
+	}
+
+	webhook, err = getWebhookByID(webhook.ProjectID, webhook.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch updated webhook"})
+		return
+	}
+	c.JSON(http.StatusOK, webhook)
+}
+
+func deleteWebhookHandler(c *gin.Context) {
+	query := `DELETE FROM webhooks WHERE project_id = $1 AND id = $2`
+	result, err := db.Exec(query, c.Param("id"), c.Param("hookId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+func getWebhookDeliveriesHandler(c *gin.Context) {
+	webhook, err := getWebhookByID(c.Param("id"), c.Param("hookId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	status := c.Query("status")
+	limit := 20
+	offset := 0
+	if l := c.Query("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if v, err := strconv.Atoi(o); err == nil && v >= 0 {
+			offset = v
+		}
+	}
+
+	total, err := countWebhookDeliveries(webhook.ID, status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count deliveries"})
+		return
+	}
+	deliveries, err := getWebhookDeliveriesPaginated(webhook.ID, status, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deliveries"})
+		return
+	}
+	if deliveries == nil {
+		deliveries = []WebhookDelivery{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries": deliveries,
+		"total":      total,
+		"limit":      limit,
+		"offset":     offset,
+	})
+}
+
+// redeliverWebhookHandler queues a fresh copy of a past delivery so the
+// original attempt stays in the log.
+func redeliverWebhookHandler(c *gin.Context) {
+	webhook, err := getWebhookByID(c.Param("id"), c.Param("hookId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	newID := uuid.New().String()
+	query := `
+	INSERT INTO webhook_deliveries (id, webhook_id, event, payload, status, attempts, next_attempt_at, created_at)
+	SELECT $1, webhook_id, event, payload, 'pending', 0, NOW(), NOW()
+	FROM webhook_deliveries
+	WHERE id = $2 AND webhook_id = $3
+	`
+	result, err := db.Exec(query, newID, c.Param("deliveryId"), webhook.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue redelivery"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+
+	delivery, err := getWebhookDeliveryByID(newID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch delivery"})
+		return
+	}
+	c.JSON(http.StatusAccepted, delivery)
+}
+
+func validateWebhook(rawURL string, events []string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if !allowPrivateWebhooks() && !isPublicWebhookHost(u.Hostname()) {
+		return fmt.Errorf("url must not point at a private or local address")
+	}
+	for _, event := range events {
+		if !webhookEvents[event] {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	return nil
+}
+
+func createWebhook(webhook Webhook) error {
+	query := `
+	INSERT INTO webhooks (id, project_id, url, secret, events, active, created_by, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err := db.Exec(query, webhook.ID, webhook.ProjectID, webhook.URL, webhook.Secret, pq.Array(webhook.Events), webhook.Active, webhook.CreatedBy, webhook.CreatedAt, webhook.UpdatedAt)
+	if err != nil {
+		log.Printf("Database error creating webhook: %v", err)
+	}
+	return err
+}
+
+// updateWebhook saves the webhook, rotating the secret only when one is given.
+func updateWebhook(webhook Webhook, secret *string) error {
+	query := `
+	UPDATE webhooks
+	SET url = $1, events = $2, active = $3, secret = COALESCE($4, secret)
+	WHERE id = $5
+	`
+	_, err := db.Exec(query, webhook.URL, pq.Array(webhook.Events), webhook.Active, secret, webhook.ID)
+	if err != nil {
+		log.Printf("Database error updating webhook: %v", err)
+	}
+	return err
+}
+
+func scanWebhook(row rowScanner) (Webhook, error) {
+	var webhook Webhook
+	err := row.Scan(&webhook.ID, &webhook.ProjectID, &webhook.URL, pq.Array(&webhook.Events), &webhook.Active, &webhook.CreatedBy, &webhook.CreatedAt, &webhook.UpdatedAt)
+	if webhook.Events == nil {
+		webhook.Events = []string{}
+	}
+	return webhook, err
+}
+
+func getWebhookByID(projectID, webhookID string) (Webhook, error) {
+	query := `
+	SELECT id, project_id, url, events, active, created_by, created_at, updated_at
+	FROM webhooks
+	WHERE project_id = $1 AND id = $2
+	`
+	return scanWebhook(db.QueryRow(query, projectID, webhookID))
+}
+
+func getWebhooksByProject(projectID string) ([]Webhook, error) {
+	query := `
+	SELECT id, project_id, url, events, active, created_by, created_at, updated_at
+	FROM webhooks
+	WHERE project_id = $1
+	ORDER BY created_at ASC
+	`
+	rows, err := db.Query(query, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []Webhook
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, nil
+}
+
+const webhookDeliveryColumns = `id, webhook_id, event, payload, status, attempts, next_attempt_at, last_status_code, last_error, created_at, delivered_at`
+
+func scanWebhookDelivery(row rowScanner) (WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	var payload []byte
+	err := row.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &payload, &delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastStatusCode, &delivery.LastError, &delivery.CreatedAt, &delivery.DeliveredAt)
+	delivery.Payload = json.RawMessage(payload)
+	return delivery, err
+}
+
+func getWebhookDeliveryByID(deliveryID string) (WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries WHERE id = $1`
+	return scanWebhookDelivery(db.QueryRow(query, deliveryID))
+}
+
+func countWebhookDeliveries(webhookID, status string) (int, error) {
+	query := `SELECT COUNT(*) FROM webhook_deliveries WHERE webhook_id = $1`
+	args := []interface{}{webhookID}
+	if status != "" {
+		query += ` AND status = $2`
+		args = append(args, status)
+	}
+	var total int
+	err := db.QueryRow(query, args...).Scan(&total)
+	return total, err
+}
+
+func getWebhookDeliveriesPaginated(webhookID, status string, limit, offset int) ([]WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries WHERE webhook_id = $1`
+	args := []interface{}{webhookID}
+	idx := 2
+	if status != "" {
+		query += ` AND status = $` + strconv.Itoa(idx)
+		args = append(args, status)
+		idx++
+	}
+	query += ` ORDER BY created_at DESC LIMIT $` + strconv.Itoa(idx) + ` OFFSET $` + strconv.Itoa(idx+1)
+	args = append(args, limit, offset)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// enqueueWebhookEvent queues a delivery for every active webhook on the
+// project subscribed to the event. It runs inside the mutation's transaction
+// so deliveries exist exactly when the change they describe does. The same
+// payload is pushed to live event streams once the transaction commits.
+func enqueueWebhookEvent(tx *Tx, projectID, actorID, event string, data interface{}) error {
+	eventID := uuid.New().String()
+	payload, err := json.Marshal(webhookPayload{
+		ID:         eventID,
+		Event:      event,
+		ProjectID:  projectID,
+		ActorID:    actorID,
+		OccurredAt: time.Now().Format(time.RFC3339),
+		Data:       data,
+	})
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO webhook_deliveries (id, webhook_id, event, payload, status, next_attempt_at, created_at)
+	SELECT uuid_generate_v4(), id, $2, $3, 'pending', NOW(), NOW()
+	FROM webhooks
+	WHERE project_id = $1 AND active AND (cardinality(events) = 0 OR $2 = ANY(events))
+	`
+	if _, err := tx.Exec(query, projectID, event, payload); err != nil {
+		log.Printf("Database error queueing webhook deliveries: %v", err)
+		return err
+	}
+
+	tx.AfterCommit(func() {
+		broker.Publish(liveEvent{ID: eventID, Event: event, ProjectID: projectID, Payload: payload})
+	})
+	return nil
+}
+
+// emitIssueWebhook queues an issue event with the issue's current state and
+// the IDs of its watchers.
+func emitIssueWebhook(tx *Tx, issueID, actorID, event string, extra gin.H) error {
+	issue, err := scanIssue(tx.QueryRow(`SELECT `+issueColumns+` FROM issues WHERE id = $1`, issueID))
+	if err != nil {
+		return err
+	}
+	issues := []Issue{issue}
+	if err := attachIssueLabels(tx, issues); err != nil {
+		return err
+	}
+	issue = issues[0]
+	watchers, err := issueWatcherIDs(tx, issueID)
+	if err != nil {
+		return err
+	}
+	data := gin.H{"issue": issue, "watchers": nonNilIDs(watchers)}
+	for k, v := range extra {
+		data[k] = v
+	}
+	return enqueueWebhookEvent(tx, issue.ProjectID, actorID, event, data)
+}
+
+// emitCommentWebhook queues a comment event for the comment's project along
+// with the IDs of the issue's watchers.
+func emitCommentWebhook(tx *Tx, comment Comment, actorID, event string) error {
+	var projectID string
+	if err := tx.QueryRow(`SELECT project_id FROM issues WHERE id = $1`, comment.IssueID).Scan(&projectID); err != nil {
+		return err
+	}
+	watchers, err := issueWatcherIDs(tx, comment.IssueID)
+	if err != nil {
+		return err
+	}
+	return enqueueWebhookEvent(tx, projectID, actorID, event, gin.H{"comment": comment, "watchers": nonNilIDs(watchers)})
+}
+
+// signWebhookPayload returns the value of the X-TrackMyBugs-Signature header.
+func signWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// queueLease returns when a lease on a queued webhook, email or import job
+// taken now runs out. It round-trips through Postgres unchanged, so a worker
+// can tell whether the row still holds the lease it set.
+func queueLease(d time.Duration) time.Time {
+	return time.Now().Add(d).Truncate(time.Microsecond)
+}
+
+// retryBackoff returns the delay before the next attempt of a queued webhook
+// or email: 30s, 1m, 2m, ... capped at one hour.
+func retryBackoff(attempts int) time.Duration {
+	delay := 30 * time.Second
+	for i := 1; i < attempts && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > time.Hour {
+		delay = time.Hour
+	}
+	return delay
+}
+
+// errPrivateWebhookAddress is returned when a webhook URL resolves to an
+// address inside the deployment's own network.
+var errPrivateWebhookAddress = errors.New("webhook address is not public")
+
+// allowPrivateWebhooks reports whether webhooks may target private and
+// loopback addresses, which is only meant for local development.
+func allowPrivateWebhooks() bool {
+	return os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true"
+}
+
+// isPublicWebhookHost rejects hosts that are obviously local. Names are only
+// resolved when sending, where newWebhookClient checks every address dialed.
+func isPublicWebhookHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return isPublicIP(ip)
+	}
+	return true
+}
+
+var carrierGradeNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || carrierGradeNAT.Contains(ip))
+}
+
+// newWebhookClient returns the client deliveries are sent with. Unless
+// allowPrivate is set it refuses to connect to non-public addresses, which
+// also covers names that resolve to them and redirects that lead to them.
+// Proxies are not used, since the check would only see the proxy's address.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return errPrivateWebhookAddress
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: webhookTimeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     time.Minute,
+		},
+	}
+}
+
+// startWebhookDispatcher polls the delivery queue in the background.
+func startWebhookDispatcher() {
+	client := newWebhookClient(allowPrivateWebhooks())
+	go func() {
+		ticker := time.NewTicker(webhookPollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := dispatchWebhooks(client); err != nil {
+				log.Printf("Webhook dispatch error: %v", err)
+			}
+		}
+	}()
+}
+
+type pendingDelivery struct {
+	id       string
+	event    string
+	payload  []byte
+	attempts int
+	url      string
+	secret   string
+	// lease is the next_attempt_at this dispatcher last set on the row
+	lease time.Time
+}
+
+// dispatchWebhooks claims a batch of due deliveries and sends them. Claimed
+// rows are leased by pushing next_attempt_at forward, so several backend
+// replicas can share the queue without sending the same delivery twice. The
+// lease is renewed before each send, since the whole batch can take longer
+// than one lease, and a delivery whose lease has already been taken over by
+// another replica is left to it.
+func dispatchWebhooks(client *http.Client) error {
+	var batch []pendingDelivery
+	err := withTx(func(tx *Tx) error {
+		query := `
+		SELECT d.id, d.event, d.payload, d.attempts, w.url, w.secret
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = 'pending' AND d.next_attempt_at <= NOW()
+		ORDER BY d.next_attempt_at ASC
+		LIMIT $1
+		FOR UPDATE OF d SKIP LOCKED
+		`
+		rows, err := tx.Query(query, webhookBatchSize)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var d pendingDelivery
+			if err := rows.Scan(&d.id, &d.event, &d.payload, &d.attempts, &d.url, &d.secret); err != nil {
+				return err
+			}
+			batch = append(batch, d)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		lease := queueLease(webhookLease)
+		for i := range batch {
+			query := `UPDATE webhook_deliveries SET next_attempt_at = $1 WHERE id = $2`
+			if _, err := tx.Exec(query, lease, batch[i].id); err != nil {
+				return err
+			}
+			batch[i].lease = lease
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, d := range batch {
+		held, err := renewWebhookLease(&d)
+		if err != nil {
+			return err
+		}
+		if !held {
+			continue
+		}
+		statusCode, sendErr := sendWebhook(client, d)
+		if err := recordWebhookAttempt(d, statusCode, sendErr); err != nil {
+			log.Printf("Database error recording webhook attempt: %v", err)
+		}
+	}
+	return nil
+}
+
+// renewWebhookLease extends the lease on a claimed delivery for one more
+// send. It reports false when the lease lapsed and another dispatcher has
+// claimed the row since.
+func renewWebhookLease(d *pendingDelivery) (bool, error) {
+	lease := queueLease(webhookLease)
+	query := `
+	UPDATE webhook_deliveries SET next_attempt_at = $1
+	WHERE id = $2 AND status = 'pending' AND next_attempt_at = $3
+	`
+	result, err := db.Exec(query, lease, d.id, d.lease)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	d.lease = lease
+	return true, nil
+}
+
+func sendWebhook(client *http.Client, d pendingDelivery) (int, error) {
+	// Stay well inside the lease even if the client has no timeout of its own
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(d.payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "TrackMyBugs-Webhooks/1.0")
+	req.Header.Set("X-TrackMyBugs-Event", d.event)
+	req.Header.Set("X-TrackMyBugs-Delivery", d.id)
+	req.Header.Set("X-TrackMyBugs-Signature", signWebhookPayload(d.secret, d.payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// The body is not kept: it may hold whatever the receiver chose to
+	// answer with, and the delivery log is visible to project members
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("receiver responded %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func recordWebhookAttempt(d pendingDelivery, statusCode int, sendErr error) error {
+	attempts := d.attempts + 1
+	var code *int
+	if statusCode != 0 {
+		code = &statusCode
+	}
+
+	if sendErr == nil {
+		query := `
+		UPDATE webhook_deliveries
+		SET status = 'succeeded', attempts = $1, last_status_code = $2, last_error = NULL, delivered_at = NOW(), next_attempt_at = NULL
+		WHERE id = $3 AND next_attempt_at = $4
+		`
+		_, err := db.Exec(query, attempts, code, d.id, d.lease)
+		return err
+	}
+
+	status := "pending"
+	var next *time.Time
+	if attempts >= webhookMaxAttempts {
+		status = "failed"
+	} else {
+		t := time.Now().Add(retryBackoff(attempts))
+		next = &t
+	}
+	query := `
+	UPDATE webhook_deliveries
+	SET status = $1, attempts = $2, last_status_code = $3, last_error = $4, next_attempt_at = $5
+	WHERE id = $6 AND next_attempt_at = $7
+	`
+	_, err := db.Exec(query, status, attempts, code, sendErr.Error(), next, d.id, d.lease)
+	return err
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// receivedWebhook is what the test receiver saw of one delivery.
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+func newWebhookReceiver(t *testing.T, status int, reply string) (*httptest.Server, <-chan receivedWebhook) {
+	t.Helper()
+	received := make(chan receivedWebhook, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- receivedWebhook{header: r.Header.Clone(), body: body}
+		w.WriteHeader(status)
+		io.WriteString(w, reply)
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+func TestSendWebhookSignsDelivery(t *testing.T) {
+	server, received := newWebhookReceiver(t, http.StatusNoContent, "")
+	d := pendingDelivery{
+		id:      "d1",
+		event:   "issue.created",
+		payload: []byte(`{"event":"issue.created"}`),
+		url:     server.URL + "/hook",
+		secret:  "s3cret",
+	}
+
+	code, err := sendWebhook(newWebhookClient(true), d)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("sendWebhook = %d, %v; want 204, nil", code, err)
+	}
+	got := <-received
+	if string(got.body) != string(d.payload) {
+		t.Errorf("body = %s, want %s", got.body, d.payload)
+	}
+	for name, want := range map[string]string{
+		"Content-Type":           "application/json",
+		"X-Trackmybugs-Event":    "issue.created",
+		"X-Trackmybugs-Delivery": "d1",
+	} {
+		if value := got.header.Get(name); value != want {
+			t.Errorf("%s = %q, want %q", name, value, want)
+		}
+	}
+
+	// Verify the signature the way a receiver would
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(got.body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if sig := got.header.Get("X-TrackMyBugs-Signature"); !hmac.Equal([]byte(sig), []byte(want)) {
+		t.Errorf("signature = %q, want %q", sig, want)
+	}
+}
+
+func TestSendWebhookErrorOmitsResponseBody(t *testing.T) {
+	server, _ := newWebhookReceiver(t, http.StatusInternalServerError, "db password is hunter2")
+	d := pendingDelivery{id: "d2", event: "issue.updated", payload: []byte(`{}`), url: server.URL}
+
+	code, err := sendWebhook(newWebhookClient(true), d)
+	if code != http.StatusInternalServerError || err == nil {
+		t.Fatalf("sendWebhook = %d, %v; want 500 and an error", code, err)
+	}
+	if strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("error %q includes the response body", err)
+	}
+}
+
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	server, received := newWebhookReceiver(t, http.StatusOK, "")
+	d := pendingDelivery{id: "d3", event: "issue.created", payload: []byte(`{}`), url: server.URL}
+
+	_, err := sendWebhook(newWebhookClient(false), d)
+	if !errors.Is(err, errPrivateWebhookAddress) {
+		t.Fatalf("sendWebhook to %s = %v, want errPrivateWebhookAddress", server.URL, err)
+	}
+	select {
+	case <-received:
+		t.Error("the receiver was reached")
+	default:
+	}
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE", "")
+	for rawURL, ok := range map[string]bool{
+		"https://ci.example.com/hook":      true,
+		"http://93.184.216.34/hook":        true,
+		"ftp://example.com/hook":           false,
+		"http://localhost:8080/hook":       false,
+		"http://api.localhost/hook":        false,
+		"http://127.0.0.1/hook":            false,
+		"http://10.0.0.5/hook":             false,
+		"http://169.254.169.254/latest":    false,
+		"http://[::1]/hook":                false,
+		"http://[::ffff:192.168.1.1]/hook": false,
+		"http://100.64.0.1/hook":           false,
+	} {
+		err := validateWebhook(rawURL, []string{"issue.created"})
+		if (err == nil) != ok {
+			t.Errorf("validateWebhook(%q) = %v, want ok=%v", rawURL, err, ok)
+		}
+	}
+}
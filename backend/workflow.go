@@ -0,0 +1,420 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Projects without a custom workflow use these statuses, with every
+// transition allowed.
+var defaultWorkflowStatuses = []WorkflowStatus{
+	{Name: "open", Category: "todo", Position: 0, Initial: true},
+	{Name: "in_progress", Category: "in_progress", Position: 1},
+	{Name: "closed", Category: "done", Position: 2},
+}
+
+var (
+	workflowStatusName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+	workflowCategories = map[string]bool{"todo": true, "in_progress": true, "done": true}
+	transitionFields   = map[string]bool{"resolution": true, "assigned_to": true, "description": true}
+)
+
+// transitionError describes why an issue cannot move between two statuses.
+type transitionError struct {
+	From          string
+	To            string
+	Allowed       []string
+	MissingFields []string
+}
+
+func (e *transitionError) Error() string {
+	if len(e.MissingFields) > 0 {
+		return fmt.Sprintf("transition from %s to %s requires %s", e.From, e.To, strings.Join(e.MissingFields, ", "))
+	}
+	return fmt.Sprintf("transition from %s to %s is not allowed", e.From, e.To)
+}
+
+func defaultWorkflow(projectID string) Workflow {
+	w := Workflow{ProjectID: projectID, Statuses: defaultWorkflowStatuses}
+	for _, from := range defaultWorkflowStatuses {
+		for _, to := range defaultWorkflowStatuses {
+			if from.Name != to.Name {
+				w.Transitions = append(w.Transitions, WorkflowTransition{From: from.Name, To: to.Name, RequiredFields: []string{}})
+			}
+		}
+	}
+	return w
+}
+
+func (w Workflow) Status(name string) (WorkflowStatus, bool) {
+	for _, status := range w.Statuses {
+		if status.Name == name {
+			return status, true
+		}
+	}
+	return WorkflowStatus{}, false
+}
+
+func (w Workflow) InitialStatus() string {
+	for _, status := range w.Statuses {
+		if status.Initial {
+			return status.Name
+		}
+	}
+	return w.Statuses[0].Name
+}
+
+func (w Workflow) Transition(from, to string) (WorkflowTransition, bool) {
+	for _, t := range w.Transitions {
+		if t.From == from && t.To == to {
+			return t, true
+		}
+	}
+	return WorkflowTransition{}, false
+}
+
+// NextStatuses lists the statuses reachable from a status in one step.
+func (w Workflow) NextStatuses(from string) []string {
+	next := []string{}
+	for _, t := range w.Transitions {
+		if t.From == from {
+			next = append(next, t.To)
+		}
+	}
+	return next
+}
+
+// IsDone reports whether a status belongs to the done category.
+func (w Workflow) IsDone(name string) bool {
+	status, ok := w.Status(name)
+	return ok && status.Category == "done"
+}
+
+// DoneStatuses lists the statuses in the done category.
+func (w Workflow) DoneStatuses() []string {
+	done := []string{}
+	for _, status := range w.Statuses {
+		if status.Category == "done" {
+			done = append(done, status.Name)
+		}
+	}
+	return done
+}
+
+// CheckTransition validates moving an issue from a status to the status it
+// now holds, including the fields the transition requires.
+func (w Workflow) CheckTransition(from string, issue Issue) *transitionError {
+	t, ok := w.Transition(from, issue.Status)
+	if !ok {
+		return &transitionError{From: from, To: issue.Status, Allowed: w.NextStatuses(from)}
+	}
+
+	var missing []string
+	for _, field := range t.RequiredFields {
+		switch field {
+		case "resolution":
+			if issue.Resolution == nil || *issue.Resolution == "" {
+				missing = append(missing, field)
+			}
+		case "assigned_to":
+			if issue.AssignedTo == nil {
+				missing = append(missing, field)
+			}
+		case "description":
+			if issue.Description == "" {
+				missing = append(missing, field)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return &transitionError{From: from, To: issue.Status, Allowed: w.NextStatuses(from), MissingFields: missing}
+	}
+	return nil
+}
+
+// validate checks a workflow submitted by a client before it is stored.
+func (w Workflow) validate() error {
+	if len(w.Statuses) == 0 {
+		return fmt.Errorf("at least one status is required")
+	}
+
+	names := map[string]bool{}
+	initial := 0
+	for _, status := range w.Statuses {
+		if !workflowStatusName.MatchString(status.Name) {
+			return fmt.Errorf("invalid status name %q", status.Name)
+		}
+		if names[status.Name] {
+			return fmt.Errorf("duplicate status %q", status.Name)
+		}
+		if !workflowCategories[status.Category] {
+			return fmt.Errorf("status %q has invalid category %q", status.Name, status.Category)
+		}
+		names[status.Name] = true
+		if status.Initial {
+			initial++
+		}
+	}
+	if initial != 1 {
+		return fmt.Errorf("exactly one status must be marked initial")
+	}
+
+	seen := map[string]bool{}
+	for _, t := range w.Transitions {
+		if !names[t.From] || !names[t.To] {
+			return fmt.Errorf("transition %s -> %s references an unknown status", t.From, t.To)
+		}
+		if t.From == t.To {
+			return fmt.Errorf("transition %s -> %s must change status", t.From, t.To)
+		}
+		key := t.From + "->" + t.To
+		if seen[key] {
+			return fmt.Errorf("duplicate transition %s -> %s", t.From, t.To)
+		}
+		seen[key] = true
+		for _, field := range t.RequiredFields {
+			if !transitionFields[field] {
+				return fmt.Errorf("transition %s -> %s requires unknown field %q", t.From, t.To, field)
+			}
+		}
+	}
+	return nil
+}
+
+// writeTransitionError reports a rejected transition as a 422.
+func writeTransitionError(c *gin.Context, err *transitionError) {
+	body := gin.H{
+		"error":               "Illegal status transition: " + err.Error(),
+		"from":                err.From,
+		"to":                  err.To,
+		"allowed_transitions": err.Allowed,
+	}
+	if len(err.MissingFields) > 0 {
+		body["missing_fields"] = err.MissingFields
+	}
+	c.JSON(http.StatusUnprocessableEntity, body)
+}
+
+func getWorkflowHandler(c *gin.Context) {
+	workflow, err := getProjectWorkflow(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch workflow"})
+		return
+	}
+	c.JSON(http.StatusOK, workflow)
+}
+
+func updateWorkflowHandler(c *gin.Context) {
+	projectID := c.Param("id")
+	var workflow Workflow
+	if err := c.ShouldBindJSON(&workflow); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	workflow.ProjectID = projectID
+	for i := range workflow.Transitions {
+		if workflow.Transitions[i].RequiredFields == nil {
+			workflow.Transitions[i].RequiredFields = []string{}
+		}
+	}
+
+	if err := workflow.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := saveProjectWorkflow(workflow); err != nil {
+		writeWorkflowSaveError(c, err, "Failed to update workflow")
+		return
+	}
+
+	workflow, err := getProjectWorkflow(projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch workflow"})
+		return
+	}
+	c.JSON(http.StatusOK, workflow)
+}
+
+func resetWorkflowHandler(c *gin.Context) {
+	projectID := c.Param("id")
+	err := withTx(func(tx *Tx) error {
+		if err := checkStatusesInUse(tx, defaultWorkflow(projectID)); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM workflow_statuses WHERE project_id = $1`, projectID)
+		return err
+	})
+	if err != nil {
+		writeWorkflowSaveError(c, err, "Failed to reset workflow")
+		return
+	}
+	c.JSON(http.StatusOK, defaultWorkflow(projectID))
+}
+
+// statusesInUseError lists statuses a workflow would remove while issues
+// still use them.
+type statusesInUseError struct {
+	Statuses []string
+}
+
+func (e *statusesInUseError) Error() string {
+	return "workflow removes statuses that issues are still using: " + strings.Join(e.Statuses, ", ")
+}
+
+// writeWorkflowSaveError answers a failed workflow save, with a conflict if
+// it would have stranded issues.
+func writeWorkflowSaveError(c *gin.Context, err error, message string) {
+	var inUse *statusesInUseError
+	if errors.As(err, &inUse) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":    "Workflow removes statuses that issues are still using",
+			"statuses": inUse.Statuses,
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
+
+// lockProject takes the project row lock that serializes changes to the
+// project's workflow and issue tree with the checks made against them.
+func lockProject(tx *Tx, projectID string) error {
+	_, err := tx.Exec(`SELECT 1 FROM projects WHERE id = $1 FOR UPDATE`, projectID)
+	return err
+}
+
+// checkStatusesInUse rejects a workflow that would strand existing issues in
+// a status it no longer defines. The project's issues stay locked until the
+// transaction ends, so none can move into a removed status in the meantime.
+func checkStatusesInUse(tx *Tx, workflow Workflow) error {
+	if err := lockProject(tx, workflow.ProjectID); err != nil {
+		return err
+	}
+	rows, err := tx.Query(`SELECT status FROM issues WHERE project_id = $1 FOR SHARE`, workflow.ProjectID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var stranded []string
+	for rows.Next() {
+		var status string
+		if err := rows.Scan(&status); err != nil {
+			return err
+		}
+		if _, ok := workflow.Status(status); !ok {
+			stranded = append(stranded, status)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if stranded = uniqueStrings(stranded); len(stranded) > 0 {
+		return &statusesInUseError{Statuses: stranded}
+	}
+	return nil
+}
+
+// getProjectWorkflow returns the project's custom workflow, or the default
+// one if it has none.
+func getProjectWorkflow(projectID string) (Workflow, error) {
+	query := `
+	SELECT name, category, position, is_initial
+	FROM workflow_statuses
+	WHERE project_id = $1
+	ORDER BY position ASC, name ASC
+	`
+	rows, err := db.Query(query, projectID)
+	if err != nil {
+		return Workflow{}, err
+	}
+	defer rows.Close()
+
+	workflow := Workflow{ProjectID: projectID, Custom: true}
+	for rows.Next() {
+		var status WorkflowStatus
+		if err := rows.Scan(&status.Name, &status.Category, &status.Position, &status.Initial); err != nil {
+			return Workflow{}, err
+		}
+		workflow.Statuses = append(workflow.Statuses, status)
+	}
+	if err := rows.Err(); err != nil {
+		return Workflow{}, err
+	}
+	if len(workflow.Statuses) == 0 {
+		return defaultWorkflow(projectID), nil
+	}
+
+	query = `
+	SELECT from_status, to_status, required_fields
+	FROM workflow_transitions
+	WHERE project_id = $1
+	`
+	trows, err := db.Query(query, projectID)
+	if err != nil {
+		return Workflow{}, err
+	}
+	defer trows.Close()
+
+	workflow.Transitions = []WorkflowTransition{}
+	for trows.Next() {
+		var t WorkflowTransition
+		if err := trows.Scan(&t.From, &t.To, pq.Array(&t.RequiredFields)); err != nil {
+			return Workflow{}, err
+		}
+		if t.RequiredFields == nil {
+			t.RequiredFields = []string{}
+		}
+		workflow.Transitions = append(workflow.Transitions, t)
+	}
+	sort.Slice(workflow.Transitions, func(i, j int) bool {
+		a, b := workflow.Transitions[i], workflow.Transitions[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.To < b.To
+	})
+	return workflow, trows.Err()
+}
+
+func saveProjectWorkflow(workflow Workflow) error {
+	return withTx(func(tx *Tx) error {
+		if err := checkStatusesInUse(tx, workflow); err != nil {
+			return err
+		}
+
+		// Deleting the statuses cascades to their transitions
+		if _, err := tx.Exec(`DELETE FROM workflow_statuses WHERE project_id = $1`, workflow.ProjectID); err != nil {
+			return err
+		}
+		for i, status := range workflow.Statuses {
+			query := `
+			INSERT INTO workflow_statuses (project_id, name, category, position, is_initial)
+			VALUES ($1, $2, $3, $4, $5)
+			`
+			if _, err := tx.Exec(query, workflow.ProjectID, status.Name, status.Category, i, status.Initial); err != nil {
+				log.Printf("Database error saving workflow status: %v", err)
+				return err
+			}
+		}
+		for _, t := range workflow.Transitions {
+			query := `
+			INSERT INTO workflow_transitions (project_id, from_status, to_status, required_fields)
+			VALUES ($1, $2, $3, $4)
+			`
+			if _, err := tx.Exec(query, workflow.ProjectID, t.From, t.To, pq.Array(t.RequiredFields)); err != nil {
+				log.Printf("Database error saving workflow transition: %v", err)
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -16,12 +16,90 @@ CREATE TABLE IF NOT EXISTS users (
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Sessions table (one row per refresh token family)
+CREATE TABLE IF NOT EXISTS sessions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    refresh_token_hash VARCHAR(64) UNIQUE NOT NULL,
+    previous_token_hash VARCHAR(64),
+    user_agent TEXT,
+    ip_address VARCHAR(64),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Projects table
 CREATE TABLE IF NOT EXISTS projects (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    key VARCHAR(10) NOT NULL UNIQUE CHECK (key ~ '^[A-Z][A-Z0-9]{1,9}$'),
     name VARCHAR(255) NOT NULL,
     description TEXT,
     created_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    attachment_quota BIGINT NOT NULL DEFAULT 1073741824,
+    prevent_close_with_open_blockers BOOLEAN NOT NULL DEFAULT false,
+    parent_close_rule VARCHAR(20) NOT NULL DEFAULT 'none' CHECK (parent_close_rule IN ('none', 'block', 'auto_close')),
+    -- Last issue number handed out; issues are numbered KEY-1, KEY-2, ...
+    issue_counter INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Project members table
+CREATE TABLE IF NOT EXISTS project_members (
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL DEFAULT 'viewer' CHECK (role IN ('owner', 'maintainer', 'reporter', 'viewer')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id, user_id)
+);
+
+-- Permissions table
+CREATE TABLE IF NOT EXISTS permissions (
+    name VARCHAR(64) PRIMARY KEY,
+    description TEXT NOT NULL
+);
+
+-- Role to permission mappings. Global roles (admin, user) apply everywhere,
+-- project roles (owner, maintainer, reporter, viewer) apply within a project.
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role VARCHAR(20) NOT NULL,
+    permission VARCHAR(64) NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+    PRIMARY KEY (role, permission)
+);
+
+-- Milestones group a project's issues by release
+CREATE TABLE IF NOT EXISTS milestones (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    due_date DATE,
+    state VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (state IN ('open', 'closed')),
+    closed_at TIMESTAMP WITH TIME ZONE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Sprints are time-boxed iterations. A project runs at most one active
+-- sprint at a time; completing it records how many issues were finished and
+-- how many carried over.
+CREATE TABLE IF NOT EXISTS sprints (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    goal TEXT NOT NULL DEFAULT '',
+    start_date DATE,
+    end_date DATE,
+    state VARCHAR(20) NOT NULL DEFAULT 'planned' CHECK (state IN ('planned', 'active', 'completed')),
+    started_at TIMESTAMP WITH TIME ZONE,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    completed_issue_count INTEGER,
+    carried_over_issue_count INTEGER,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
@@ -29,17 +107,128 @@ CREATE TABLE IF NOT EXISTS projects (
 -- Issues table
 CREATE TABLE IF NOT EXISTS issues (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    number INTEGER NOT NULL,
     title VARCHAR(255) NOT NULL,
     description TEXT,
-    status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'in_progress', 'closed')),
+    status VARCHAR(50) NOT NULL DEFAULT 'open',
     priority VARCHAR(20) NOT NULL DEFAULT 'medium' CHECK (priority IN ('low', 'medium', 'high', 'critical')),
+    resolution VARCHAR(50),
     project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
     created_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
     assigned_to UUID REFERENCES users(id) ON DELETE SET NULL,
+    milestone_id UUID REFERENCES milestones(id) ON DELETE SET NULL,
+    sprint_id UUID REFERENCES sprints(id) ON DELETE SET NULL,
+    parent_id UUID REFERENCES issues(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    search_vector TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+        setweight(to_tsvector('english', COALESCE(description, '')), 'B')
+    ) STORED,
+    UNIQUE (project_id, number)
+);
+
+-- Per-project workflow statuses. Projects without rows here use the built-in
+-- open -> in_progress -> closed workflow.
+CREATE TABLE IF NOT EXISTS workflow_statuses (
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    category VARCHAR(20) NOT NULL CHECK (category IN ('todo', 'in_progress', 'done')),
+    position INTEGER NOT NULL DEFAULT 0,
+    is_initial BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (project_id, name)
+);
+
+-- Allowed status transitions, with fields that must be set to make them
+CREATE TABLE IF NOT EXISTS workflow_transitions (
+    project_id UUID NOT NULL,
+    from_status VARCHAR(50) NOT NULL,
+    to_status VARCHAR(50) NOT NULL,
+    required_fields TEXT[] NOT NULL DEFAULT '{}',
+    PRIMARY KEY (project_id, from_status, to_status),
+    FOREIGN KEY (project_id, from_status) REFERENCES workflow_statuses(project_id, name) ON DELETE CASCADE,
+    FOREIGN KEY (project_id, to_status) REFERENCES workflow_statuses(project_id, name) ON DELETE CASCADE
+);
+
+-- Issue assignment history
+CREATE TABLE IF NOT EXISTS issue_assignments (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    issue_id UUID NOT NULL REFERENCES issues(id) ON DELETE CASCADE,
+    previous_assignee UUID REFERENCES users(id) ON DELETE SET NULL,
+    assignee UUID REFERENCES users(id) ON DELETE SET NULL,
+    changed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Issue activity log. One row per mutation, written in the same transaction.
+CREATE TABLE IF NOT EXISTS issue_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    issue_id UUID NOT NULL REFERENCES issues(id) ON DELETE CASCADE,
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    event_type VARCHAR(50) NOT NULL,
+    field VARCHAR(50),
+    old_value TEXT,
+    new_value TEXT,
+    comment_id UUID,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    -- Insertion order, since several events often share a timestamp
+    seq BIGSERIAL NOT NULL
+);
+
+-- Typed links between issues, stored in one direction: the source blocks,
+-- duplicates or relates to the target. Blocking links never form a cycle.
+CREATE TABLE IF NOT EXISTS issue_links (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    source_issue_id UUID NOT NULL REFERENCES issues(id) ON DELETE CASCADE,
+    target_issue_id UUID NOT NULL REFERENCES issues(id) ON DELETE CASCADE,
+    link_type VARCHAR(20) NOT NULL CHECK (link_type IN ('blocks', 'duplicates', 'relates_to')),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (source_issue_id, target_issue_id, link_type),
+    CHECK (source_issue_id <> target_issue_id)
+);
+
+-- Commits that mention an issue, recorded from Git host webhooks
+CREATE TABLE IF NOT EXISTS issue_commits (
+    issue_id UUID NOT NULL REFERENCES issues(id) ON DELETE CASCADE,
+    sha VARCHAR(64) NOT NULL,
+    repository VARCHAR(255) NOT NULL DEFAULT '',
+    branch VARCHAR(255) NOT NULL DEFAULT '',
+    message TEXT NOT NULL DEFAULT '',
+    url TEXT NOT NULL DEFAULT '',
+    author_name VARCHAR(255) NOT NULL DEFAULT '',
+    author_email VARCHAR(255) NOT NULL DEFAULT '',
+    committed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (issue_id, sha)
+);
+
+-- Project-scoped labels and the issues they are applied to
+CREATE TABLE IF NOT EXISTS labels (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    color VARCHAR(7) NOT NULL DEFAULT '#6b7280',
+    description TEXT NOT NULL DEFAULT '',
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE TABLE IF NOT EXISTS issue_labels (
+    issue_id UUID NOT NULL REFERENCES issues(id) ON DELETE CASCADE,
+    label_id UUID NOT NULL REFERENCES labels(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (issue_id, label_id)
+);
+
+-- Users following an issue for notifications
+CREATE TABLE IF NOT EXISTS issue_watchers (
+    issue_id UUID NOT NULL REFERENCES issues(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (issue_id, user_id)
+);
+
 -- Comments table
 CREATE TABLE IF NOT EXISTS comments (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -47,15 +236,213 @@ CREATE TABLE IF NOT EXISTS comments (
     created_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
     content TEXT NOT NULL,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    search_vector TSVECTOR GENERATED ALWAYS AS (to_tsvector('english', content)) STORED
+);
+
+-- Users mentioned in comments
+CREATE TABLE IF NOT EXISTS comment_mentions (
+    comment_id UUID NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (comment_id, user_id)
+);
+
+-- Outgoing webhook subscriptions. An empty events array subscribes to all events.
+CREATE TABLE IF NOT EXISTS webhooks (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    events TEXT[] NOT NULL DEFAULT '{}',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Inbound webhooks from Git hosts. Each one has its own secret that the
+-- host uses to sign (GitHub, Gitea) or accompany (GitLab) its payloads.
+CREATE TABLE IF NOT EXISTS git_hooks (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    provider VARCHAR(20) NOT NULL CHECK (provider IN ('github', 'gitlab', 'gitea')),
+    secret VARCHAR(255) NOT NULL,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Webhook delivery queue and log
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_status_code INTEGER,
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP WITH TIME ZONE
+);
+
+-- In-app notification inbox
+CREATE TABLE IF NOT EXISTS notifications (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason VARCHAR(30) NOT NULL,
+    issue_id UUID NOT NULL REFERENCES issues(id) ON DELETE CASCADE,
+    comment_id UUID REFERENCES comments(id) ON DELETE CASCADE,
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    old_value TEXT,
+    new_value TEXT,
+    read_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Per-user notification settings. Users without a row get every email.
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    email_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    on_assigned BOOLEAN NOT NULL DEFAULT TRUE,
+    on_mentioned BOOLEAN NOT NULL DEFAULT TRUE,
+    on_status_changed BOOLEAN NOT NULL DEFAULT TRUE,
+    on_commented BOOLEAN NOT NULL DEFAULT TRUE,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Outgoing notification emails, sent by the background mailer
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    to_address VARCHAR(255) NOT NULL,
+    subject TEXT NOT NULL,
+    text_body TEXT NOT NULL,
+    html_body TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Files attached to issues and comments. The contents live in the configured
+-- blob store under storage_key.
+CREATE TABLE IF NOT EXISTS attachments (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    issue_id UUID NOT NULL REFERENCES issues(id) ON DELETE CASCADE,
+    comment_id UUID REFERENCES comments(id) ON DELETE CASCADE,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    checksum CHAR(64) NOT NULL,
+    storage_key TEXT NOT NULL,
+    uploaded_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Quota held by attachment uploads that are still being stored
+CREATE TABLE IF NOT EXISTS attachment_reservations (
+    id UUID PRIMARY KEY,
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    size BIGINT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Saved issue filters. A filter is private to its owner unless it is shared
+-- with the members of its project.
+CREATE TABLE IF NOT EXISTS saved_filters (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    project_id UUID REFERENCES projects(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    query TEXT NOT NULL DEFAULT '',
+    shared BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (NOT shared OR project_id IS NOT NULL)
+);
+
+-- Background issue imports. The uploaded file is kept in payload until the
+-- job finishes.
+CREATE TABLE IF NOT EXISTS import_jobs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    source VARCHAR(20) NOT NULL CHECK (source IN ('csv', 'github', 'jira_csv', 'jira_xml')),
+    filename VARCHAR(255) NOT NULL DEFAULT '',
+    idempotency_key VARCHAR(255) NOT NULL,
+    dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+    mapping JSONB NOT NULL DEFAULT '{}',
+    payload BYTEA,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    total_count INTEGER NOT NULL DEFAULT 0,
+    processed_count INTEGER NOT NULL DEFAULT 0,
+    created_count INTEGER NOT NULL DEFAULT 0,
+    skipped_count INTEGER NOT NULL DEFAULT 0,
+    failed_count INTEGER NOT NULL DEFAULT 0,
+    errors JSONB NOT NULL DEFAULT '[]',
+    unmapped_users JSONB NOT NULL DEFAULT '[]',
+    error TEXT,
+    lease_until TIMESTAMP WITH TIME ZONE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Issues created by imports, keyed by the idempotency key and the issue's ID
+-- in the source so that running an import again does not duplicate them
+CREATE TABLE IF NOT EXISTS imported_issues (
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    idempotency_key VARCHAR(255) NOT NULL,
+    external_id VARCHAR(500) NOT NULL,
+    issue_id UUID NOT NULL REFERENCES issues(id) ON DELETE CASCADE,
+    job_id UUID REFERENCES import_jobs(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id, idempotency_key, external_id)
+);
+
 -- Create indexes for better performance
 CREATE INDEX IF NOT EXISTS idx_issues_project_id ON issues(project_id);
 CREATE INDEX IF NOT EXISTS idx_issues_status ON issues(status);
 CREATE INDEX IF NOT EXISTS idx_issues_assigned_to ON issues(assigned_to);
+CREATE INDEX IF NOT EXISTS idx_issues_milestone_id ON issues(milestone_id);
+CREATE INDEX IF NOT EXISTS idx_milestones_project_id ON milestones(project_id);
+CREATE INDEX IF NOT EXISTS idx_issues_sprint_id ON issues(sprint_id);
+CREATE INDEX IF NOT EXISTS idx_issues_parent_id ON issues(parent_id);
+CREATE INDEX IF NOT EXISTS idx_sprints_project_id ON sprints(project_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sprints_one_active ON sprints(project_id) WHERE state = 'active';
+CREATE INDEX IF NOT EXISTS idx_issue_assignments_issue_id ON issue_assignments(issue_id);
+CREATE INDEX IF NOT EXISTS idx_issue_events_issue_id ON issue_events(issue_id, seq);
+CREATE INDEX IF NOT EXISTS idx_issues_search_vector ON issues USING GIN (search_vector);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_labels_project_name ON labels(project_id, LOWER(name));
+CREATE INDEX IF NOT EXISTS idx_issue_labels_label_id ON issue_labels(label_id);
+CREATE INDEX IF NOT EXISTS idx_issue_links_target ON issue_links(target_issue_id, link_type);
+CREATE INDEX IF NOT EXISTS idx_issue_watchers_user_id ON issue_watchers(user_id);
 CREATE INDEX IF NOT EXISTS idx_comments_issue_id ON comments(issue_id);
+CREATE INDEX IF NOT EXISTS idx_comments_search_vector ON comments USING GIN (search_vector);
 CREATE INDEX IF NOT EXISTS idx_comments_created_by ON comments(created_by);
+CREATE INDEX IF NOT EXISTS idx_comment_mentions_user_id ON comment_mentions(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_webhooks_project_id ON webhooks(project_id);
+CREATE INDEX IF NOT EXISTS idx_git_hooks_project_id ON git_hooks(project_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_pending ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_previous_token_hash ON sessions(previous_token_hash);
+CREATE INDEX IF NOT EXISTS idx_project_members_user_id ON project_members(user_id);
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications(user_id) WHERE read_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_email_outbox_pending ON email_outbox(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_attachments_issue_id ON attachments(issue_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_project_id ON attachments(project_id);
+CREATE INDEX IF NOT EXISTS idx_attachment_reservations_project_id ON attachment_reservations(project_id);
+CREATE INDEX IF NOT EXISTS idx_saved_filters_owner_id ON saved_filters(owner_id);
+CREATE INDEX IF NOT EXISTS idx_saved_filters_shared ON saved_filters(project_id) WHERE shared;
+CREATE INDEX IF NOT EXISTS idx_import_jobs_project_id ON import_jobs(project_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_import_jobs_queued ON import_jobs(created_at) WHERE status IN ('pending', 'running');
 
 -- Create updated_at trigger function
 CREATE OR REPLACE FUNCTION update_updated_at_column()
@@ -70,7 +457,96 @@ $$ language 'plpgsql';
 CREATE TRIGGER update_users_updated_at BEFORE UPDATE ON users FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 CREATE TRIGGER update_projects_updated_at BEFORE UPDATE ON projects FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 CREATE TRIGGER update_issues_updated_at BEFORE UPDATE ON issues FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_project_members_updated_at BEFORE UPDATE ON project_members FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 CREATE TRIGGER update_comments_updated_at BEFORE UPDATE ON comments FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_webhooks_updated_at BEFORE UPDATE ON webhooks FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_milestones_updated_at BEFORE UPDATE ON milestones FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_sprints_updated_at BEFORE UPDATE ON sprints FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_labels_updated_at BEFORE UPDATE ON labels FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_saved_filters_updated_at BEFORE UPDATE ON saved_filters FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Seed permissions and default role mappings
+INSERT INTO permissions (name, description) VALUES
+    ('project:create', 'Create new projects'),
+    ('project:view', 'View a project and its issues and comments'),
+    ('project:update', 'Edit project details'),
+    ('project:delete', 'Delete a project'),
+    ('project:manage_members', 'Invite, change and remove project members'),
+    ('project:manage_owners', 'Grant or revoke project ownership'),
+    ('project:manage_workflow', 'Configure the project issue workflow'),
+    ('project:manage_webhooks', 'Manage project webhooks and inspect deliveries'),
+    ('project:manage_quota', 'Change a project''s attachment storage quota'),
+    ('project:manage_labels', 'Create, edit and delete project labels'),
+    ('project:manage_milestones', 'Create, edit, close and delete milestones'),
+    ('project:manage_sprints', 'Plan, start and complete sprints and manage the backlog'),
+    ('project:import', 'Import issues from CSV, GitHub and Jira exports'),
+    ('issue:create', 'Create issues'),
+    ('issue:update', 'Edit any issue'),
+    ('issue:update_own', 'Edit issues you reported'),
+    ('issue:delete', 'Delete any issue'),
+    ('issue:delete_own', 'Delete issues you reported'),
+    ('issue:assign', 'Assign issues to project members'),
+    ('comment:create', 'Comment on issues'),
+    ('comment:moderate', 'Edit or delete other users'' comments'),
+    ('attachment:create', 'Attach files to issues and comments'),
+    ('attachment:delete', 'Delete other users'' attachments'),
+    ('user:manage_roles', 'Change global user roles')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission)
+SELECT 'admin', name FROM permissions
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('user', 'project:create'),
+    ('owner', 'project:view'),
+    ('owner', 'project:update'),
+    ('owner', 'project:manage_workflow'),
+    ('owner', 'project:manage_webhooks'),
+    ('owner', 'project:manage_labels'),
+    ('owner', 'project:manage_milestones'),
+    ('owner', 'project:manage_sprints'),
+    ('owner', 'project:import'),
+    ('owner', 'project:delete'),
+    ('owner', 'project:manage_members'),
+    ('owner', 'project:manage_owners'),
+    ('owner', 'issue:create'),
+    ('owner', 'issue:update'),
+    ('owner', 'issue:update_own'),
+    ('owner', 'issue:delete'),
+    ('owner', 'issue:delete_own'),
+    ('owner', 'issue:assign'),
+    ('owner', 'comment:create'),
+    ('owner', 'comment:moderate'),
+    ('owner', 'attachment:create'),
+    ('owner', 'attachment:delete'),
+    ('maintainer', 'project:view'),
+    ('maintainer', 'project:update'),
+    ('maintainer', 'project:manage_workflow'),
+    ('maintainer', 'project:manage_webhooks'),
+    ('maintainer', 'project:manage_labels'),
+    ('maintainer', 'project:manage_milestones'),
+    ('maintainer', 'project:manage_sprints'),
+    ('maintainer', 'project:import'),
+    ('maintainer', 'project:manage_members'),
+    ('maintainer', 'issue:create'),
+    ('maintainer', 'issue:update'),
+    ('maintainer', 'issue:update_own'),
+    ('maintainer', 'issue:delete'),
+    ('maintainer', 'issue:delete_own'),
+    ('maintainer', 'issue:assign'),
+    ('maintainer', 'comment:create'),
+    ('maintainer', 'comment:moderate'),
+    ('maintainer', 'attachment:create'),
+    ('maintainer', 'attachment:delete'),
+    ('reporter', 'project:view'),
+    ('reporter', 'issue:create'),
+    ('reporter', 'issue:update_own'),
+    ('reporter', 'issue:delete_own'),
+    ('reporter', 'comment:create'),
+    ('reporter', 'attachment:create'),
+    ('viewer', 'project:view')
+ON CONFLICT DO NOTHING;
 
 -- Insert some sample data for development
 INSERT INTO users (email, password_hash, first_name, last_name, role) VALUES
@@ -79,13 +555,23 @@ INSERT INTO users (email, password_hash, first_name, last_name, role) VALUES
 ON CONFLICT (email) DO NOTHING;
 
 -- Insert sample project
-INSERT INTO projects (name, description, created_by) VALUES
-    ('Sample Project', 'A sample project for testing', (SELECT id FROM users WHERE email = 'admin@trackmybugs.com' LIMIT 1))
+INSERT INTO projects (key, name, description, created_by, issue_counter) VALUES
+    ('SP', 'Sample Project', 'A sample project for testing', (SELECT id FROM users WHERE email = 'admin@trackmybugs.com' LIMIT 1), 1)
+ON CONFLICT DO NOTHING;
+
+-- Make the sample project's creator its owner
+INSERT INTO project_members (project_id, user_id, role)
+SELECT id, created_by, 'owner' FROM projects
 ON CONFLICT DO NOTHING;
 
 -- Insert sample issue
-INSERT INTO issues (title, description, status, priority, project_id, created_by) VALUES
-    ('Sample Bug', 'This is a sample bug for testing purposes', 'open', 'medium', 
+INSERT INTO issues (number, title, description, status, priority, project_id, created_by) VALUES
+    (1, 'Sample Bug', 'This is a sample bug for testing purposes', 'open', 'medium', 
      (SELECT id FROM projects LIMIT 1), 
      (SELECT id FROM users WHERE email = 'admin@trackmybugs.com' LIMIT 1))
-ON CONFLICT DO NOTHING; 
\ No newline at end of file
+ON CONFLICT DO NOTHING; 
+
+-- The sample issue's reporter watches it
+INSERT INTO issue_watchers (issue_id, user_id)
+SELECT id, created_by FROM issues
+ON CONFLICT DO NOTHING;
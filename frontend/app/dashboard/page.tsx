@@ -92,8 +92,20 @@ export default function DashboardPage() {
     }
   }
 
-  const handleLogout = () => {
+  const handleLogout = async () => {
+    const token = localStorage.getItem('token')
+    if (token) {
+      try {
+        await fetch('http://localhost:8080/api/v1/auth/logout', {
+          method: 'POST',
+          headers: { 'Authorization': `Bearer ${token}` },
+        })
+      } catch (err) {
+        // Clear local state even if the server cannot be reached
+      }
+    }
     localStorage.removeItem('token')
+    localStorage.removeItem('refresh_token')
     localStorage.removeItem('user')
     router.push('/login')
   }
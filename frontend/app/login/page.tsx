@@ -34,6 +34,7 @@ export default function LoginPage() {
 
       if (response.ok) {
         localStorage.setItem('token', result.token);
+        localStorage.setItem('refresh_token', result.refresh_token);
         localStorage.setItem('user', JSON.stringify(result.user));
         router.push('/dashboard');
       } else {
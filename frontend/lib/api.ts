@@ -15,9 +15,30 @@ class ApiClient {
     }
   }
 
+  // Exchange the stored refresh token for a new token pair
+  private async refreshSession(): Promise<boolean> {
+    const refreshToken = localStorage.getItem('refresh_token')
+    if (!refreshToken) return false
+    try {
+      const response = await fetch(`${API_BASE_URL}/auth/refresh`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ refresh_token: refreshToken }),
+      })
+      if (!response.ok) return false
+      const data = await response.json()
+      localStorage.setItem('token', data.token)
+      localStorage.setItem('refresh_token', data.refresh_token)
+      return true
+    } catch (error) {
+      return false
+    }
+  }
+
   private async request<T>(
     endpoint: string,
-    options: RequestInit = {}
+    options: RequestInit = {},
+    retry = true
   ): Promise<ApiResponse<T>> {
     try {
       const url = `${API_BASE_URL}${endpoint}`
@@ -26,12 +47,17 @@ class ApiClient {
         headers: this.getAuthHeaders(),
       })
 
+      if (response.status === 401 && retry && (await this.refreshSession())) {
+        return this.request<T>(endpoint, options, false)
+      }
+
       const data = await response.json()
 
       if (!response.ok) {
         if (response.status === 401) {
           // Handle unauthorized - redirect to login
           localStorage.removeItem('token')
+          localStorage.removeItem('refresh_token')
           localStorage.removeItem('user')
           window.location.href = '/login'
           return { error: 'Unauthorized' }
@@ -65,6 +91,14 @@ class ApiClient {
     })
   }
 
+  async logout() {
+    const result = await this.request('/auth/logout', { method: 'POST' }, false)
+    localStorage.removeItem('token')
+    localStorage.removeItem('refresh_token')
+    localStorage.removeItem('user')
+    return result
+  }
+
   // Project endpoints
   async getProjects() {
     return this.request<{ projects: any[] }>('/projects')
@@ -141,6 +175,17 @@ class ApiClient {
     })
   }
 
+  async getIssueActivity(id: string, limit?: number, offset?: number) {
+    let endpoint = `/issues/${id}/activity`;
+    const params = [];
+    if (typeof limit === 'number') params.push(`limit=${limit}`);
+    if (typeof offset === 'number') params.push(`offset=${offset}`);
+    if (params.length > 0) {
+      endpoint += '?' + params.join('&');
+    }
+    return this.request<{ activity: any[]; total: number; limit: number; offset: number }>(endpoint)
+  }
+
   // Comment endpoints
   async getComments(issueId: string, limit?: number, offset?: number) {
     let endpoint = `/comments/issue/${issueId}`;